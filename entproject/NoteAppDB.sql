@@ -1,26 +1,32 @@
-INSERT INTO "User" VALUES 
-    (DEFAULT,'Ezra','Adkins','password'),
-    (DEFAULT,'Kasper','Richard','password'),
-    (DEFAULT,'Mason','Bush','password'),
-    (DEFAULT,'Jerry','Martinez','password'),
-    (DEFAULT,'Carla','Petersen','password'),
-    (DEFAULT,'Deacon','Rios','password'),
-    (DEFAULT,'Odysseus','Pickett','password'),
-    (DEFAULT,'Quintessa','Lee','password'),
-    (DEFAULT,'Sophia','Thornton','password'),
-    (DEFAULT,'Chiquita','Bass','password');
+-- Passwords are seeded as plaintext for testing. Each one is replaced with a bcrypt hash the first time that user logs in.
+INSERT INTO "User" (GivenName, FamilyName, Password) VALUES
+    ('Ezra','Adkins','password'),
+    ('Kasper','Richard','password'),
+    ('Mason','Bush','password'),
+    ('Jerry','Martinez','password'),
+    ('Carla','Petersen','password'),
+    ('Deacon','Rios','password'),
+    ('Odysseus','Pickett','password'),
+    ('Quintessa','Lee','password'),
+    ('Sophia','Thornton','password'),
+    ('Chiquita','Bass','password');
 
-INSERT INTO Note VALUES 
-    (DEFAULT, 1, 'This is a title.', 'Contents of the first note', DATE('now'), DATE('now')),
-    (DEFAULT, 1, 'Second title.', 'Contents of the second note', DATE('now'), DATE('now')),
-    (DEFAULT, 3, 'Third title.', 'Some contents of a note blah blah', DATE('now'), DATE('now')),
-    (DEFAULT, 5, 'Fourth title.', 'This is some contents', DATE('now'), DATE('now')),
-    (DEFAULT, 10, 'Fifth title.', 'BBQ shapes', DATE('now'), DATE('now'));
+INSERT INTO Note (UserID, Title, Contents, DateCreated, DateUpdated) VALUES
+    (1, 'This is a title.', 'Contents of the first note', now(), now()),
+    (1, 'Second title.', 'Contents of the second note', now(), now()),
+    (3, 'Third title.', 'Some contents of a note blah blah', now(), now()),
+    (5, 'Fourth title.', 'This is some contents', now(), now()),
+    (10, 'Fifth title.', 'BBQ shapes', now(), now());
 
-INSERT INTO NoteAccess VALUES
-	(DEFAULT, 1, 2, true, true),
-	(DEFAULT, 1, 3, true, true);
+-- Note 1 is shared with users 2 and 3 as editors by its owner
+INSERT INTO NoteAccess (NoteID, UserID, Role, GrantedBy, DateGranted) VALUES
+	(1, 2, 'editor', 1, now()),
+	(1, 3, 'editor', 1, now());
 
-INSERT INTO SharedSettings VALUES
-	(DEFAULT, 1, 2, true, true, 'SharedSettings Test'),
-	(DEFAULT, 1, 3, true, true, 'SharedSettings Test');
\ No newline at end of file
+INSERT INTO SharedSettings (OwnerID, SharedUserID, Role, Name) VALUES
+	(1, 2, 'editor', 'SharedSettings Test'),
+	(1, 3, 'editor', 'SharedSettings Test');
+
+-- Every note starts its history from its first revision
+INSERT INTO NoteRevision (NoteID, UserID, Title, Contents, DateCreated, Version)
+	SELECT NoteID, UserID, Title, Contents, DateUpdated, Version FROM Note ORDER BY NoteID;
@@ -0,0 +1,307 @@
+package main
+
+import (
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+//Words read per minute, used to estimate how long a note takes to read
+const readingWordsPerMinute = 200
+
+//Most words counted when no top value is given, and the most that can be asked for
+const (
+	defaultTopWords = 10
+	maxTopWords     = 100
+)
+
+//Longest regular expression a term can be
+const maxPatternLength = 200
+
+//Most matches shown in context. Every match is still counted
+const maxTermMatches = 100
+
+//Characters of context shown either side of a match
+const contextChars = 40
+
+//Common words left out of word frequencies
+var stopWords = map[string]bool{}
+
+func init() {
+	for _, word := range strings.Fields(`a about above after again against all am an and any are as at be because been
+		before being below between both but by can could did do does doing down during each few for from further had
+		has have having he her here hers herself him himself his how i if in into is it its itself just me more most my
+		myself no nor not now of off on once only or other our ours ourselves out over own same she should so some such
+		than that the their theirs them themselves then there these they this those through to too under until up very
+		was we were what when where which while who whom why will with would you your yours yourself yourselves`) {
+		stopWords[word] = true
+	}
+}
+
+//How often a word is used
+type wordCount struct {
+	Word  string `json:"word"`
+	Count int    `json:"count"`
+}
+
+//One place a term was found, with the text either side of it
+type termMatch struct {
+	Before string `json:"before"`
+	Match  string `json:"match"`
+	After  string `json:"after"`
+}
+
+//Counts of a term in a note and where it was found
+type termAnalysis struct {
+	Term string `json:"term"`
+	//"word" for whole words or "regex" for a regular expression, both ignoring case
+	Mode    string      `json:"mode"`
+	Count   int         `json:"count"`
+	Matches []termMatch `json:"matches"`
+}
+
+//Statistics about a notes contents
+type noteAnalysis struct {
+	NoteID     int `json:"noteID"`
+	Words      int `json:"words"`
+	Characters int `json:"characters"`
+	//Characters other than spaces, tabs and new lines
+	CharactersNoSpaces int `json:"charactersNoSpaces"`
+	Sentences          int `json:"sentences"`
+	//Estimated minutes to read the note, rounded up
+	ReadingMinutes int           `json:"readingMinutes"`
+	TopWords       []wordCount   `json:"topWords"`
+	Term           *termAnalysis `json:"term,omitempty"`
+}
+
+//Works out the statistics for some text and its top most used words, leaving out stop words
+func analyseText(text string, top int) noteAnalysis {
+	words := searchWords(text)
+	analysis := noteAnalysis{
+		Words:          len(words),
+		Characters:     utf8.RuneCountInString(text),
+		Sentences:      countSentences(text),
+		ReadingMinutes: (len(words) + readingWordsPerMinute - 1) / readingWordsPerMinute,
+		TopWords:       topWords(words, top),
+	}
+	for _, r := range text {
+		if !unicode.IsSpace(r) {
+			analysis.CharactersNoSpaces++
+		}
+	}
+	return analysis
+}
+
+//Counts the sentences in some text. A sentence is any run of words ended by . ! or ?, or by the end of the text
+func countSentences(text string) int {
+	sentences := 0
+	inSentence := false
+	for _, r := range text {
+		switch {
+		case isWordRune(r):
+			inSentence = true
+		case (r == '.' || r == '!' || r == '?') && inSentence:
+			sentences++
+			inSentence = false
+		}
+	}
+	if inSentence {
+		sentences++
+	}
+	return sentences
+}
+
+//Gets the top most used words, most used first, leaving out stop words and numbers
+func topWords(words []string, top int) []wordCount {
+	counts := make(map[string]int)
+	for _, word := range words {
+		if stopWords[word] || strings.IndexFunc(word, unicode.IsLetter) < 0 {
+			continue
+		}
+		counts[word]++
+	}
+	result := []wordCount{}
+	for word, count := range counts {
+		result = append(result, wordCount{word, count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].Count != result[j].Count {
+			return result[i].Count > result[j].Count
+		}
+		return result[i].Word < result[j].Word
+	})
+	if len(result) > top {
+		result = result[:top]
+	}
+	return result
+}
+
+//Finds a term in some text, ignoring case. In "word" mode the term only matches whole words, so "cat" does not match
+//"category". In "regex" mode the term is a regular expression
+func analyseTerm(text string, term string, mode string) (*termAnalysis, error) {
+	if mode == "" {
+		mode = "word"
+	}
+	var found [][]int
+	switch mode {
+	case "word":
+		found = findWords(text, term)
+	case "regex":
+		if len(term) > maxPatternLength {
+			return nil, badRequest("The pattern can be at most " + strconv.Itoa(maxPatternLength) + " characters long.")
+		}
+		pattern, err := regexp.Compile("(?i)" + term)
+		if err != nil {
+			return nil, badRequest("The pattern is not a valid regular expression.")
+		}
+		for _, match := range pattern.FindAllStringIndex(text, -1) {
+			//Patterns like a* also match nothing in between every character, which is not worth counting
+			if match[1] > match[0] {
+				found = append(found, match)
+			}
+		}
+	default:
+		return nil, badRequest("mode should be word or regex")
+	}
+
+	analysis := &termAnalysis{Term: term, Mode: mode, Count: len(found), Matches: []termMatch{}}
+	for i, match := range found {
+		if i == maxTermMatches {
+			break
+		}
+		analysis.Matches = append(analysis.Matches, termMatch{
+			Before: contextBefore(text[:match[0]]),
+			Match:  text[match[0]:match[1]],
+			After:  contextAfter(text[match[1]:]),
+		})
+	}
+	return analysis, nil
+}
+
+//Finds where the words of term appear together in text as whole words, ignoring case
+func findWords(text string, term string) [][]int {
+	termWords := searchWords(term)
+	if len(termWords) == 0 {
+		return nil
+	}
+	spans := wordSpans(text)
+	var found [][]int
+	for i := 0; i+len(termWords) <= len(spans); i++ {
+		matched := true
+		for j, termWord := range termWords {
+			span := spans[i+j]
+			if !strings.EqualFold(text[span.start:span.end], termWord) {
+				matched = false
+				break
+			}
+		}
+		if matched {
+			found = append(found, []int{spans[i].start, spans[i+len(termWords)-1].end})
+			i += len(termWords) - 1
+		}
+	}
+	return found
+}
+
+//Gets the end of the text before a match, on one line
+func contextBefore(text string) string {
+	//Only the end is needed. No character is longer than utf8.UTFMax bytes, so this keeps one more than is shown,
+	//enough to tell whether the text goes on, and the cut is moved forward to the start of a character
+	if limit := (contextChars + 1) * utf8.UTFMax; len(text) > limit {
+		start := len(text) - limit
+		for !utf8.RuneStart(text[start]) {
+			start++
+		}
+		text = text[start:]
+	}
+	runes := []rune(oneLine(text))
+	if len(runes) <= contextChars {
+		return string(runes)
+	}
+	return "…" + string(runes[len(runes)-contextChars:])
+}
+
+//Gets the start of the text after a match, on one line
+func contextAfter(text string) string {
+	//The cut is moved back to the start of a character so the last one is not split
+	if limit := (contextChars + 1) * utf8.UTFMax; len(text) > limit {
+		end := limit
+		for !utf8.RuneStart(text[end]) {
+			end--
+		}
+		text = text[:end]
+	}
+	runes := []rune(oneLine(text))
+	if len(runes) <= contextChars {
+		return string(runes)
+	}
+	return string(runes[:contextChars]) + "…"
+}
+
+//Replaces new lines and tabs with spaces
+func oneLine(text string) string {
+	return strings.Map(func(r rune) rune {
+		if unicode.IsSpace(r) {
+			return ' '
+		}
+		return r
+	}, text)
+}
+
+//Reads the top value from a request, defaulting to defaultTopWords
+func parseTop(value string) (int, error) {
+	if value == "" {
+		return defaultTopWords, nil
+	}
+	top, err := strconv.Atoi(value)
+	if err != nil || top < 1 || top > maxTopWords {
+		return 0, badRequest("top should be a number from 1 to " + strconv.Itoa(maxTopWords))
+	}
+	return top, nil
+}
+
+//Analyses a note, and the search term if one is given
+func analyseNoteContents(note Note, top string, term string, mode string) (noteAnalysis, error) {
+	n, err := parseTop(top)
+	if err != nil {
+		return noteAnalysis{}, err
+	}
+	analysis := analyseText(note.Contents, n)
+	analysis.NoteID = note.NoteID
+	if term != "" {
+		analysis.Term, err = analyseTerm(note.Contents, term, mode)
+		if err != nil {
+			return noteAnalysis{}, err
+		}
+	}
+	return analysis, nil
+}
+
+//Shows statistics about a note and counts a term in it
+func analyseNote(w http.ResponseWriter, r *http.Request) error {
+	//Checks if a user is already logged in
+	session, err := requireSession(w, r)
+	if session == nil {
+		return err
+	}
+	note, _ := routeNote(r)
+	//Analyses the Note with the given input
+	analysis, err := analyseNoteContents(note, r.FormValue("top"), r.FormValue("search"), r.FormValue("mode"))
+	if err != nil {
+		return err
+	}
+
+	//Analyse notes template
+	t, err := parseTemplate("analyseNote.html")
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, struct {
+		Note     Note
+		Analysis noteAnalysis
+	}{note, analysis})
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+	"unicode/utf8"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAnalyseText(t *testing.T) {
+	analysis := analyseText("The cat sat. The cat ran!\nDid the dog see it? Café 42", 2)
+	assert.Equal(t, 13, analysis.Words)
+	assert.Equal(t, 53, analysis.Characters)
+	assert.Equal(t, 41, analysis.CharactersNoSpaces)
+	assert.Equal(t, 4, analysis.Sentences)
+	assert.Equal(t, 1, analysis.ReadingMinutes)
+	//Stop words and numbers are left out, and ties are in alphabetical order
+	assert.Equal(t, []wordCount{{"cat", 2}, {"café", 1}}, analysis.TopWords)
+
+	empty := analyseText("", 10)
+	assert.Zero(t, empty.Words)
+	assert.Zero(t, empty.Sentences)
+	assert.Zero(t, empty.ReadingMinutes)
+	assert.Empty(t, empty.TopWords)
+
+	assert.Equal(t, 2, analyseText(strings.Repeat("word ", readingWordsPerMinute+1), 10).ReadingMinutes)
+}
+
+func TestCountSentences(t *testing.T) {
+	assert.Equal(t, 2, countSentences("Wait... what"))
+	assert.Equal(t, 2, countSentences("Really?! Yes."))
+	assert.Equal(t, 0, countSentences("... !"))
+}
+
+func TestAnalyseTerm(t *testing.T) {
+	text := "Cat, category and CAT.\nThe cat sat"
+
+	//Whole words, ignoring case
+	analysis, err := analyseTerm(text, "cat", "")
+	assert.NoError(t, err)
+	assert.Equal(t, "word", analysis.Mode)
+	assert.Equal(t, 3, analysis.Count)
+	assert.Equal(t, termMatch{Before: "", Match: "Cat", After: ", category and CAT. The cat sat"}, analysis.Matches[0])
+	assert.Equal(t, "CAT", analysis.Matches[1].Match)
+
+	analysis, err = analyseTerm(text, "the CAT", "word")
+	assert.NoError(t, err)
+	assert.Equal(t, 1, analysis.Count)
+	assert.Equal(t, "The cat", analysis.Matches[0].Match)
+
+	//Regular expressions, also ignoring case
+	analysis, err = analyseTerm(text, `cat\w*`, "regex")
+	assert.NoError(t, err)
+	assert.Equal(t, 4, analysis.Count)
+	assert.Equal(t, "category", analysis.Matches[1].Match)
+	analysis, err = analyseTerm(text, "x*", "regex")
+	assert.NoError(t, err)
+	assert.Zero(t, analysis.Count, "empty matches should not be counted")
+
+	_, err = analyseTerm(text, "(", "regex")
+	assert.Error(t, err)
+	_, err = analyseTerm(text, strings.Repeat("a", maxPatternLength+1), "regex")
+	assert.Error(t, err)
+	_, err = analyseTerm(text, "cat", "glob")
+	assert.Error(t, err)
+}
+
+func TestAnalyseTermContext(t *testing.T) {
+	long := strings.Repeat("é", contextChars+10)
+	analysis, err := analyseTerm(long+" needle "+long, "needle", "word")
+	assert.NoError(t, err)
+	assert.Equal(t, "…"+strings.Repeat("é", contextChars-1)+" ", analysis.Matches[0].Before)
+	assert.Equal(t, " "+strings.Repeat("é", contextChars-1)+"…", analysis.Matches[0].After)
+
+	//Cutting long text by bytes never splits a character, whatever its length
+	for padding := 0; padding < utf8.UTFMax; padding++ {
+		emoji := strings.Repeat("😀", contextChars*2)
+		pad := strings.Repeat("x", padding)
+		analysis, err = analyseTerm(pad+emoji+" needle "+emoji+pad, "needle", "word")
+		assert.NoError(t, err)
+		assert.Equal(t, "…"+strings.Repeat("😀", contextChars-1)+" ", analysis.Matches[0].Before)
+		assert.Equal(t, " "+strings.Repeat("😀", contextChars-1)+"…", analysis.Matches[0].After)
+		assert.NotContains(t, analysis.Matches[0].Before+analysis.Matches[0].After, string(utf8.RuneError))
+	}
+
+	//Every match is counted, but only some are shown
+	analysis, err = analyseTerm(strings.Repeat("a ", maxTermMatches+5), "a", "word")
+	assert.NoError(t, err)
+	assert.Equal(t, maxTermMatches+5, analysis.Count)
+	assert.Len(t, analysis.Matches, maxTermMatches)
+}
+
+func TestAnalyseNotePage(t *testing.T) {
+	owner, err := registerUser("Analyse", "Owner", "password")
+	assert.NoError(t, err)
+	stranger, err := registerUser("Analyse", "Stranger", "password")
+	assert.NoError(t, err)
+	note, err := saveNewNote(owner.UserID, "analyse", "Apples <b>and</b> pears. Apples again", "")
+	assert.NoError(t, err)
+	path := "/Notes/Analyse/" + strconv.Itoa(note.NoteID)
+
+	rec := formRequest(path, owner.UserID, url.Values{"search": {"apples"}})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	body := rec.Body.String()
+	assert.Contains(t, body, "Matching text pattern count: 2")
+	assert.Contains(t, body, "<mark>Apples</mark> &lt;b&gt;and")
+	assert.NotContains(t, body, "<b>and</b>", "note contents should be escaped")
+
+	rec = formRequest(path, owner.UserID, url.Values{"search": {"("}, "mode": {"regex"}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	//Notes that have not been shared can not be analysed
+	rec = apiRequest("GET", path, stranger.UserID, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = apiRequest("GET", "/api/v1/notes/"+strconv.Itoa(note.NoteID)+"/analysis?term=pears&top=1", owner.UserID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var analysis noteAnalysis
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &analysis))
+	assert.Equal(t, []wordCount{{"apples", 2}}, analysis.TopWords)
+	if assert.NotNil(t, analysis.Term) {
+		assert.Equal(t, 1, analysis.Term.Count)
+	}
+	rec = apiRequest("GET", "/api/v1/notes/"+strconv.Itoa(note.NoteID)+"/analysis?top=1000", owner.UserID, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
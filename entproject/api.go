@@ -0,0 +1,977 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/mux"
+)
+
+//Body of every JSON error response
+type apiError struct {
+	Error string `json:"error"`
+}
+
+//Body accepted when creating or updating a note
+type noteRequest struct {
+	Title         string `json:"title"`
+	Contents      string `json:"contents"`
+	SharedSetting string `json:"sharedSetting"`
+	//The version being edited, when updating without an If-Match header
+	Version int `json:"version,omitempty"`
+	//Replaces the notes tags. Leaving it out keeps the tags a note already has
+	Tags *[]string `json:"tags,omitempty"`
+}
+
+//Tidies up the tags in a note request, if it has any
+func (body noteRequest) tags() ([]string, error) {
+	if body.Tags == nil {
+		return nil, nil
+	}
+	return normaliseTags(*body.Tags)
+}
+
+//Body of the response when a note was changed by someone else since the client loaded it
+type apiConflict struct {
+	Error   string `json:"error"`
+	Current Note   `json:"current"`
+}
+
+//Body accepted when creating a user
+type userRequest struct {
+	GivenName  string `json:"givenName"`
+	FamilyName string `json:"familyName"`
+	Password   string `json:"password"`
+}
+
+//Body accepted when sharing a note or changing a users access. Read and write are the flags used before roles, and
+//are only looked at when no role is given
+type accessRequest struct {
+	UserID int    `json:"userID"`
+	Role   string `json:"role"`
+	Read   bool   `json:"read"`
+	Write  bool   `json:"write"`
+}
+
+//The role asked for. Write maps to editor and read to viewer, so older clients keep working
+func (body accessRequest) role() (Role, error) {
+	value := body.Role
+	if value == "" {
+		if body.Write {
+			value = string(roleEditor)
+		} else if body.Read {
+			value = string(roleViewer)
+		}
+	}
+	role, err := parseRole(value)
+	if err != nil {
+		return "", badRequest("role must be one of viewer, commenter, editor or co-owner")
+	}
+	return role, nil
+}
+
+//Body accepted when saving a notes access as a shared setting
+type sharedSettingRequest struct {
+	Name string `json:"name"`
+}
+
+//Body accepted when creating a notebook
+type notebookRequest struct {
+	Name string `json:"name"`
+	//The notebook to create it in, or 0 for the top level
+	ParentID int `json:"parentID"`
+}
+
+//Body accepted when moving a note
+type moveRequest struct {
+	//The notebook to move the note into, or 0 to take it out of its notebook
+	NotebookID int `json:"notebookID"`
+}
+
+//Sent after leaving a note that is still shared with the user through a notebook
+type leaveResponse struct {
+	NotebookRole Role `json:"notebookRole"`
+}
+
+//Body accepted when giving a note to another user
+type transferRequest struct {
+	UserID int `json:"userID"`
+	//Whether the old owner keeps editor access
+	KeepAccess bool `json:"keepAccess"`
+}
+
+//Notebooks listed for the logged in user
+type notebookList struct {
+	Owned  []Notebook `json:"owned"`
+	Shared []Notebook `json:"shared"`
+}
+
+//Path every JSON API route starts with
+const apiPrefix = "/api/v1"
+
+//Builds the router for the JSON API. It is a separate router mounted under /api/ rather than a subrouter, because
+//routes on a mux subrouter answer 404 instead of 405 when the path matches but the method does not
+func apiRouter() *mux.Router {
+	r := mux.NewRouter()
+	r.Handle(apiPrefix+"/notes", apiHandler(apiGetNotes)).Methods("GET")
+	r.Handle(apiPrefix+"/notes", apiHandler(apiCreateNote)).Methods("POST")
+	r.Handle(apiPrefix+"/notes/search", apiHandler(apiSearchNotes)).Methods("GET")
+	r.Handle(apiPrefix+"/notes/{NoteID:[0-9]{1,9}}", apiHandler(apiGetNote)).Methods("GET")
+	r.Handle(apiPrefix+"/notes/{NoteID:[0-9]{1,9}}", apiHandler(apiUpdateNote)).Methods("PUT")
+	r.Handle(apiPrefix+"/notes/{NoteID:[0-9]{1,9}}", apiHandler(apiDeleteNote)).Methods("DELETE")
+	r.Handle(apiPrefix+"/notes/{NoteID:[0-9]{1,9}}/revisions", apiHandler(apiGetRevisions)).Methods("GET")
+	r.Handle(apiPrefix+"/notes/{NoteID:[0-9]{1,9}}/revisions/{RevisionID:[0-9]{1,9}}", apiHandler(apiGetRevision)).Methods("GET")
+	r.Handle(apiPrefix+"/notes/{NoteID:[0-9]{1,9}}/revisions/{RevisionID:[0-9]{1,9}}/restore", apiHandler(apiRestoreRevision)).Methods("POST")
+	r.Handle(apiPrefix+"/notes/{NoteID:[0-9]{1,9}}/diff", apiHandler(apiDiffRevisions)).Methods("GET")
+	r.Handle(apiPrefix+"/notes/{NoteID:[0-9]{1,9}}/analysis", apiHandler(apiAnalyseNote)).Methods("GET")
+	r.Handle(apiPrefix+"/notes/{NoteID:[0-9]{1,9}}/access", apiHandler(apiGetAccess)).Methods("GET")
+	r.Handle(apiPrefix+"/notes/{NoteID:[0-9]{1,9}}/access", apiHandler(apiShareNote)).Methods("POST")
+	r.Handle(apiPrefix+"/notes/{NoteID:[0-9]{1,9}}/access/{UserID:[0-9]{1,9}}", apiHandler(apiEditAccess)).Methods("PUT")
+	r.Handle(apiPrefix+"/notes/{NoteID:[0-9]{1,9}}/access/{UserID:[0-9]{1,9}}", apiHandler(apiRevokeAccess)).Methods("DELETE")
+	r.Handle(apiPrefix+"/notes/{NoteID:[0-9]{1,9}}/attachments", apiHandler(apiGetAttachments)).Methods("GET")
+	r.Handle(apiPrefix+"/notes/{NoteID:[0-9]{1,9}}/attachments", apiHandler(apiAddAttachment)).Methods("POST")
+	r.Handle(apiPrefix+"/notes/{NoteID:[0-9]{1,9}}/attachments/{AttachmentID:[0-9]{1,9}}", apiHandler(apiDownloadAttachment)).Methods("GET")
+	r.Handle(apiPrefix+"/notes/{NoteID:[0-9]{1,9}}/attachments/{AttachmentID:[0-9]{1,9}}", apiHandler(apiDeleteAttachment)).Methods("DELETE")
+	r.Handle(apiPrefix+"/notes/{NoteID:[0-9]{1,9}}/sharedsettings", apiHandler(apiSaveSharedSetting)).Methods("POST")
+	r.Handle(apiPrefix+"/trash", apiHandler(apiGetTrash)).Methods("GET")
+	r.Handle(apiPrefix+"/trash/{NoteID:[0-9]{1,9}}", apiHandler(apiPurgeNote)).Methods("DELETE")
+	r.Handle(apiPrefix+"/trash/{NoteID:[0-9]{1,9}}/restore", apiHandler(apiRestoreNote)).Methods("POST")
+	r.Handle(apiPrefix+"/users", apiHandler(apiGetUsers)).Methods("GET")
+	r.Handle(apiPrefix+"/users", apiHandler(apiCreateUser)).Methods("POST")
+	r.Handle(apiPrefix+"/users/{UserID:[0-9]{1,9}}", apiHandler(apiGetUser)).Methods("GET")
+	r.Handle(apiPrefix+"/sharedsettings", apiHandler(apiGetSharedSettings)).Methods("GET")
+	r.Handle(apiPrefix+"/dashboard", apiHandler(apiDashboard)).Methods("GET")
+	r.Handle(apiPrefix+"/tags", apiHandler(apiGetTags)).Methods("GET")
+	r.Handle(apiPrefix+"/notebooks", apiHandler(apiGetNotebooks)).Methods("GET")
+	r.Handle(apiPrefix+"/notebooks", apiHandler(apiCreateNotebook)).Methods("POST")
+	r.Handle(apiPrefix+"/notebooks/{NotebookID:[0-9]{1,9}}", apiHandler(apiGetNotebook)).Methods("GET")
+	r.Handle(apiPrefix+"/notebooks/{NotebookID:[0-9]{1,9}}", apiHandler(apiDeleteNotebook)).Methods("DELETE")
+	r.Handle(apiPrefix+"/notebooks/{NotebookID:[0-9]{1,9}}/access", apiHandler(apiGetNotebookAccess)).Methods("GET")
+	r.Handle(apiPrefix+"/notebooks/{NotebookID:[0-9]{1,9}}/access", apiHandler(apiShareNotebook)).Methods("PUT")
+	r.Handle(apiPrefix+"/notebooks/{NotebookID:[0-9]{1,9}}/access/{UserID:[0-9]{1,9}}", apiHandler(apiRevokeNotebookAccess)).Methods("DELETE")
+	r.Handle(apiPrefix+"/notes/{NoteID:[0-9]{1,9}}/notebook", apiHandler(apiMoveNote)).Methods("PUT")
+	r.Handle(apiPrefix+"/notes/{NoteID:[0-9]{1,9}}/transfer", apiHandler(apiTransferNote)).Methods("POST")
+	r.Handle(apiPrefix+"/notes/{NoteID:[0-9]{1,9}}/leave", apiHandler(apiLeaveNote)).Methods("POST")
+
+	//Checks the logged in user may use the note in a route before its handler runs
+	r.Use(authoriseNoteRoutes(true))
+
+	r.NotFoundHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSONError(w, http.StatusNotFound, "resource not found")
+	})
+	r.MethodNotAllowedHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		writeJSONError(w, http.StatusMethodNotAllowed, "method not allowed")
+	})
+	return r
+}
+
+//Writes v as the JSON response body with the given status
+func writeJSON(w http.ResponseWriter, status int, v interface{}) error {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	return json.NewEncoder(w).Encode(v)
+}
+
+//Writes a JSON error body with the given status
+func writeJSONError(w http.ResponseWriter, status int, message string) {
+	writeJSON(w, status, apiError{Error: message})
+}
+
+//Largest JSON request body read. Leaves room for a note of maxNoteContentsLength characters with every one escaped
+const maxJSONBodyBytes = 2 << 20
+
+//Decodes the JSON request body into v. Returns a 400 error if the body is invalid, or a 413 error if it is too large
+func readJSON(r *http.Request, v interface{}) error {
+	decoder := json.NewDecoder(http.MaxBytesReader(nil, r.Body, maxJSONBodyBytes))
+	decoder.DisallowUnknownFields()
+	if err := decoder.Decode(v); err != nil {
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			return &appError{Code: http.StatusRequestEntityTooLarge, Message: "request body is larger than " + strconv.Itoa(maxJSONBodyBytes) + " bytes"}
+		}
+		return badRequest("invalid JSON body: " + err.Error())
+	}
+	return nil
+}
+
+//Gets the logged in users ID. Returns a 401 error if nobody is logged in
+func apiUser(r *http.Request) (int, error) {
+	session, err := checkLoggedIn(r)
+	if err != nil {
+		return 0, err
+	}
+	if session == nil {
+		return 0, &appError{Code: http.StatusUnauthorized, Message: "not logged in"}
+	}
+	return session.UserID, nil
+}
+
+//Sets the ETag header to the notes version, so clients can send it back in If-Match when they save
+func setNoteETag(w http.ResponseWriter, note Note) {
+	w.Header().Set("ETag", `"`+strconv.Itoa(note.Version)+`"`)
+}
+
+//Gets the note version from an If-Match header. Only single strong ETags set by setNoteETag are understood
+func parseNoteETag(header string) (int, bool) {
+	if len(header) < 2 || header[0] != '"' || header[len(header)-1] != '"' {
+		return 0, false
+	}
+	version, err := parseID(header[1 : len(header)-1])
+	return version, err == nil
+}
+
+//Writes the note as it is now saved, with the given conflict status
+func writeNoteConflict(w http.ResponseWriter, status int, noteID int) error {
+	current, err := store.GetNote(noteID)
+	if err != nil {
+		return err
+	}
+	setNoteETag(w, current)
+	return writeJSON(w, status, apiConflict{Error: "note was changed by someone else, merge your changes into current and try again", Current: current})
+}
+
+//GET /api/v1/notes?tags= lists the notes the logged in user owns or can read, only those with every one of the
+//comma separated tags if given
+func apiGetNotes(w http.ResponseWriter, r *http.Request) error {
+	userID, err := apiUser(r)
+	if err != nil {
+		return err
+	}
+	tags, err := parseTags(r.URL.Query().Get("tags"))
+	if err != nil {
+		return err
+	}
+	notes, err := store.GetUserNotes(userID)
+	if err != nil {
+		return err
+	}
+	notes = filterByTags(notes, tags)
+	if notes == nil {
+		notes = []Note{}
+	}
+	return writeJSON(w, http.StatusOK, notes)
+}
+
+//POST /api/v1/notes creates a note owned by the logged in user
+func apiCreateNote(w http.ResponseWriter, r *http.Request) error {
+	userID, err := apiUser(r)
+	if err != nil {
+		return err
+	}
+	var body noteRequest
+	if err := readJSON(r, &body); err != nil {
+		return err
+	}
+	if strings.TrimSpace(body.Title) == "" {
+		return badRequest("title is required")
+	}
+	tags, err := body.tags()
+	if err != nil {
+		return err
+	}
+	note, err := saveNewNote(userID, body.Title, body.Contents, body.SharedSetting)
+	if err != nil {
+		return err
+	}
+	if tags != nil {
+		err = store.SetNoteTags(note.NoteID, tags)
+		if err != nil {
+			return err
+		}
+		note.Tags = tags
+	}
+	w.Header().Set("Location", apiPrefix+"/notes/"+strconv.Itoa(note.NoteID))
+	setNoteETag(w, note)
+	return writeJSON(w, http.StatusCreated, note)
+}
+
+//GET /api/v1/notes/search?q= searches the notes the logged in user can read, best match first. q uses the same
+//syntax as the search page, and the search page filters can be given as query parameters as well as or instead of q
+func apiSearchNotes(w http.ResponseWriter, r *http.Request) error {
+	userID, err := apiUser(r)
+	if err != nil {
+		return err
+	}
+	values := r.URL.Query()
+	query := parseSearchQuery(values.Get("q"))
+	query.Filter, err = parseSearchFilter(values)
+	if err != nil {
+		return err
+	}
+	if values.Get("q") == "" && query.Filter.empty() {
+		return badRequest("query parameter q or a filter is required")
+	}
+	results, err := store.SearchNotes(userID, query)
+	if err != nil {
+		return err
+	}
+	if results == nil {
+		results = []SearchResult{}
+	}
+	return writeJSON(w, http.StatusOK, results)
+}
+
+//GET /api/v1/notes/{NoteID} gets a single note
+func apiGetNote(w http.ResponseWriter, r *http.Request) error {
+	note, _ := routeNote(r)
+	setNoteETag(w, note)
+	return writeJSON(w, http.StatusOK, note)
+}
+
+//PUT /api/v1/notes/{NoteID} replaces a notes title and contents, and its tags if given. The version being edited must be sent in If-Match,
+//which answers 412 if the note has changed since, or in the body, which answers 409
+func apiUpdateNote(w http.ResponseWriter, r *http.Request) error {
+	userID, err := apiUser(r)
+	if err != nil {
+		return err
+	}
+	note, _ := routeNote(r)
+	var body noteRequest
+	if err := readJSON(r, &body); err != nil {
+		return err
+	}
+	if strings.TrimSpace(body.Title) == "" {
+		return badRequest("title is required")
+	}
+	if err := validateNote(body.Title, body.Contents); err != nil {
+		return err
+	}
+	tags, err := body.tags()
+	if err != nil {
+		return err
+	}
+	conflictStatus := http.StatusConflict
+	switch ifMatch := r.Header.Get("If-Match"); {
+	case ifMatch == "*":
+		//Any version will do, so the client is choosing to overwrite whatever is saved
+		body.Version = note.Version
+		conflictStatus = http.StatusPreconditionFailed
+	case ifMatch != "":
+		version, ok := parseNoteETag(ifMatch)
+		if !ok {
+			return writeNoteConflict(w, http.StatusPreconditionFailed, note.NoteID)
+		}
+		body.Version = version
+		conflictStatus = http.StatusPreconditionFailed
+	case body.Version == 0:
+		return &appError{Code: http.StatusPreconditionRequired, Message: "send the version being edited in If-Match or the version field, so changes made by others are not overwritten"}
+	}
+	note.Title = body.Title
+	note.Contents = body.Contents
+	note.DateUpdated = time.Now()
+	note.Version = body.Version
+	err = store.UpdateNote(note, userID)
+	if err == errConflict {
+		return writeNoteConflict(w, conflictStatus, note.NoteID)
+	}
+	if err != nil {
+		return err
+	}
+	if tags != nil {
+		err = store.SetNoteTags(note.NoteID, tags)
+		if err != nil {
+			return err
+		}
+	}
+	note, err = store.GetNote(note.NoteID)
+	if err != nil {
+		return err
+	}
+	setNoteETag(w, note)
+	return writeJSON(w, http.StatusOK, note)
+}
+
+//DELETE /api/v1/notes/{NoteID} moves a note to its owners trash
+func apiDeleteNote(w http.ResponseWriter, r *http.Request) error {
+	userID, err := apiUser(r)
+	if err != nil {
+		return err
+	}
+	note, _ := routeNote(r)
+	if err := trashNote(userID, note.NoteID); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+//GET /api/v1/notes/{NoteID}/revisions lists every revision of a note, newest first
+func apiGetRevisions(w http.ResponseWriter, r *http.Request) error {
+	note, _ := routeNote(r)
+	revisions, err := store.GetRevisions(note.NoteID)
+	if err != nil {
+		return err
+	}
+	if revisions == nil {
+		revisions = []NoteRevision{}
+	}
+	return writeJSON(w, http.StatusOK, revisions)
+}
+
+//GET /api/v1/notes/{NoteID}/revisions/{RevisionID} gets a single revision
+func apiGetRevision(w http.ResponseWriter, r *http.Request) error {
+	note, _ := routeNote(r)
+	revision, err := store.GetRevision(note.NoteID, routeID(r, "RevisionID"))
+	if err == errNotFound {
+		return notFound("revision not found")
+	}
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, revision)
+}
+
+//POST /api/v1/notes/{NoteID}/revisions/{RevisionID}/restore puts a note back to one of its revisions, saving the
+//restore as a new revision
+func apiRestoreRevision(w http.ResponseWriter, r *http.Request) error {
+	userID, err := apiUser(r)
+	if err != nil {
+		return err
+	}
+	note, _ := routeNote(r)
+	_, err = restoreRevision(note, routeID(r, "RevisionID"), userID)
+	if err == errNotFound {
+		return notFound("revision not found")
+	}
+	if err != nil {
+		return err
+	}
+	note, err = store.GetNote(note.NoteID)
+	if err != nil {
+		return err
+	}
+	setNoteETag(w, note)
+	return writeJSON(w, http.StatusOK, note)
+}
+
+//GET /api/v1/notes/{NoteID}/diff?from=&to=&mode= compares two revisions of a note. to defaults to the newest
+//revision, from to the one before it and mode to line
+func apiDiffRevisions(w http.ResponseWriter, r *http.Request) error {
+	note, _ := routeNote(r)
+	revisions, err := store.GetRevisions(note.NoteID)
+	if err != nil {
+		return err
+	}
+	query := r.URL.Query()
+	from, to, err := pickRevisions(revisions, query.Get("from"), query.Get("to"))
+	if err == errNotFound {
+		return notFound("revision not found")
+	}
+	if err != nil {
+		return err
+	}
+	changes, err := compareRevisions(note.NoteID, from, to, query.Get("mode"))
+	if err == errNotFound {
+		return notFound("revision not found")
+	}
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, changes)
+}
+
+//GET /api/v1/notes/{NoteID}/analysis?top=&term=&mode= gets statistics about a note, and counts term in it if given
+func apiAnalyseNote(w http.ResponseWriter, r *http.Request) error {
+	note, _ := routeNote(r)
+	query := r.URL.Query()
+	analysis, err := analyseNoteContents(note, query.Get("top"), query.Get("term"), query.Get("mode"))
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, analysis)
+}
+
+//GET /api/v1/notes/{NoteID}/access lists who a note is shared with
+func apiGetAccess(w http.ResponseWriter, r *http.Request) error {
+	note, _ := routeNote(r)
+	matches, err := readAccess(note.NoteID)
+	if err != nil {
+		return err
+	}
+	if matches == nil {
+		matches = []NoteAccess{}
+	}
+	return writeJSON(w, http.StatusOK, matches)
+}
+
+//POST /api/v1/notes/{NoteID}/access shares a note with another user, or changes the access they already have
+func apiShareNote(w http.ResponseWriter, r *http.Request) error {
+	userID, err := apiUser(r)
+	if err != nil {
+		return err
+	}
+	note, _ := routeNote(r)
+	var body accessRequest
+	if err := readJSON(r, &body); err != nil {
+		return err
+	}
+	if _, err := parseID(strconv.Itoa(body.UserID)); err != nil {
+		return badRequest("userID must be a positive whole number")
+	}
+	role, err := body.role()
+	if err != nil {
+		return err
+	}
+	noteAccess, created, err := shareNoteWith(note, userID, body.UserID, role)
+	if err != nil {
+		return err
+	}
+	if !created {
+		return writeJSON(w, http.StatusOK, noteAccess)
+	}
+	return writeJSON(w, http.StatusCreated, noteAccess)
+}
+
+//PUT /api/v1/notes/{NoteID}/access/{UserID} changes the access one user has on a note
+func apiEditAccess(w http.ResponseWriter, r *http.Request) error {
+	userID, err := apiUser(r)
+	if err != nil {
+		return err
+	}
+	note, _ := routeNote(r)
+	var body accessRequest
+	if err := readJSON(r, &body); err != nil {
+		return err
+	}
+	role, err := body.role()
+	if err != nil {
+		return err
+	}
+	sharedUserID := routeID(r, "UserID")
+	err = changeAccess(note.NoteID, sharedUserID, role, userID)
+	if err != nil {
+		return err
+	}
+	noteAccess, err := store.GetUserAccess(note.NoteID, sharedUserID)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, noteAccess)
+}
+
+//DELETE /api/v1/notes/{NoteID}/access/{UserID} stops sharing a note with one user
+func apiRevokeAccess(w http.ResponseWriter, r *http.Request) error {
+	note, _ := routeNote(r)
+	err := revokeAccess(note.NoteID, routeID(r, "UserID"))
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+//POST /api/v1/notes/{NoteID}/sharedsettings saves a notes access rows as a named shared setting
+func apiSaveSharedSetting(w http.ResponseWriter, r *http.Request) error {
+	userID, err := apiUser(r)
+	if err != nil {
+		return err
+	}
+	note, _ := routeNote(r)
+	var body sharedSettingRequest
+	if err := readJSON(r, &body); err != nil {
+		return err
+	}
+	if strings.TrimSpace(body.Name) == "" {
+		return badRequest("name is required")
+	}
+	if err := saveSharedSetting(body.Name, note.NoteID, userID); err != nil {
+		return err
+	}
+	settings, err := store.GetSharedSettings(userID)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusCreated, settings)
+}
+
+//GET /api/v1/sharedsettings lists the logged in users saved shared settings
+func apiGetSharedSettings(w http.ResponseWriter, r *http.Request) error {
+	userID, err := apiUser(r)
+	if err != nil {
+		return err
+	}
+	settings, err := store.GetSharedSettings(userID)
+	if err != nil {
+		return err
+	}
+	if settings == nil {
+		settings = []SharedSettings{}
+	}
+	return writeJSON(w, http.StatusOK, settings)
+}
+
+//GET /api/v1/users lists every user
+func apiGetUsers(w http.ResponseWriter, r *http.Request) error {
+	if _, err := apiUser(r); err != nil {
+		return err
+	}
+	users, err := store.GetUsers()
+	if err != nil {
+		return err
+	}
+	if users == nil {
+		users = []User{}
+	}
+	return writeJSON(w, http.StatusOK, users)
+}
+
+//POST /api/v1/users creates an account. Does not need a logged in user
+func apiCreateUser(w http.ResponseWriter, r *http.Request) error {
+	var body userRequest
+	if err := readJSON(r, &body); err != nil {
+		return err
+	}
+	if body.GivenName == "" || body.FamilyName == "" || body.Password == "" {
+		return badRequest("givenName, familyName and password are required")
+	}
+	if len(body.Password) > maxPasswordLength {
+		return badRequest("password must be at most " + strconv.Itoa(maxPasswordLength) + " bytes")
+	}
+	newUser, err := registerUser(body.GivenName, body.FamilyName, body.Password)
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Location", apiPrefix+"/users/"+strconv.Itoa(newUser.UserID))
+	return writeJSON(w, http.StatusCreated, newUser)
+}
+
+//GET /api/v1/users/{UserID} gets a single user
+func apiGetUser(w http.ResponseWriter, r *http.Request) error {
+	if _, err := apiUser(r); err != nil {
+		return err
+	}
+	user, err := store.GetUser(routeID(r, "UserID"))
+	if err == errNotFound {
+		return notFound("user not found")
+	}
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, user)
+}
+
+//GET /api/v1/dashboard?weeks=&top= gets statistics across every note the logged in user can read
+func apiDashboard(w http.ResponseWriter, r *http.Request) error {
+	userID, err := apiUser(r)
+	if err != nil {
+		return err
+	}
+	result, err := requestDashboard(r, userID)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, result)
+}
+
+//GET /api/v1/tags counts how many of the notes the logged in user can read have each tag
+func apiGetTags(w http.ResponseWriter, r *http.Request) error {
+	userID, err := apiUser(r)
+	if err != nil {
+		return err
+	}
+	counts, err := store.GetTagCounts(userID)
+	if err != nil {
+		return err
+	}
+	if counts == nil {
+		counts = []tagCount{}
+	}
+	return writeJSON(w, http.StatusOK, counts)
+}
+
+//GET /api/v1/notebooks lists every notebook the logged in user owns and the notebooks shared with them
+func apiGetNotebooks(w http.ResponseWriter, r *http.Request) error {
+	userID, err := apiUser(r)
+	if err != nil {
+		return err
+	}
+	owned, err := store.GetUserNotebooks(userID)
+	if err != nil {
+		return err
+	}
+	shared, err := store.GetSharedNotebooks(userID)
+	if err != nil {
+		return err
+	}
+	result := notebookList{Owned: owned, Shared: shared}
+	if result.Owned == nil {
+		result.Owned = []Notebook{}
+	}
+	if result.Shared == nil {
+		result.Shared = []Notebook{}
+	}
+	return writeJSON(w, http.StatusOK, result)
+}
+
+//POST /api/v1/notebooks creates a notebook owned by the logged in user
+func apiCreateNotebook(w http.ResponseWriter, r *http.Request) error {
+	userID, err := apiUser(r)
+	if err != nil {
+		return err
+	}
+	var body notebookRequest
+	if err := readJSON(r, &body); err != nil {
+		return err
+	}
+	if body.ParentID < 0 {
+		return badRequest("parentID must be a positive whole number, or 0 for the top level")
+	}
+	notebook, err := newNotebook(userID, body.Name, body.ParentID)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusCreated, notebook)
+}
+
+//GET /api/v1/notebooks/{NotebookID} gets a notebook with the notebooks and notes directly inside it
+func apiGetNotebook(w http.ResponseWriter, r *http.Request) error {
+	userID, err := apiUser(r)
+	if err != nil {
+		return err
+	}
+	contents, err := readableNotebook(routeID(r, "NotebookID"), userID)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, contents)
+}
+
+//DELETE /api/v1/notebooks/{NotebookID} deletes an empty notebook
+func apiDeleteNotebook(w http.ResponseWriter, r *http.Request) error {
+	userID, err := apiUser(r)
+	if err != nil {
+		return err
+	}
+	_, err = deleteEmptyNotebook(userID, routeID(r, "NotebookID"))
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+//GET /api/v1/notebooks/{NotebookID}/access lists who a notebook is shared with
+func apiGetNotebookAccess(w http.ResponseWriter, r *http.Request) error {
+	userID, err := apiUser(r)
+	if err != nil {
+		return err
+	}
+	notebook, err := ownedNotebook(routeID(r, "NotebookID"), userID)
+	if err != nil {
+		return err
+	}
+	accessRows, err := store.GetNotebookAccess(notebook.NotebookID)
+	if err != nil {
+		return err
+	}
+	if accessRows == nil {
+		accessRows = []NotebookAccess{}
+	}
+	return writeJSON(w, http.StatusOK, accessRows)
+}
+
+//PUT /api/v1/notebooks/{NotebookID}/access shares a notebook with a user, or changes the access they already have
+func apiShareNotebook(w http.ResponseWriter, r *http.Request) error {
+	userID, err := apiUser(r)
+	if err != nil {
+		return err
+	}
+	var body accessRequest
+	if err := readJSON(r, &body); err != nil {
+		return err
+	}
+	if _, err := parseID(strconv.Itoa(body.UserID)); err != nil {
+		return badRequest("userID must be a positive whole number")
+	}
+	role, err := body.role()
+	if err != nil {
+		return err
+	}
+	access, err := shareNotebookWith(userID, routeID(r, "NotebookID"), body.UserID, role)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusOK, access)
+}
+
+//DELETE /api/v1/notebooks/{NotebookID}/access/{UserID} stops sharing a notebook with one user
+func apiRevokeNotebookAccess(w http.ResponseWriter, r *http.Request) error {
+	userID, err := apiUser(r)
+	if err != nil {
+		return err
+	}
+	err = revokeNotebookAccess(userID, routeID(r, "NotebookID"), routeID(r, "UserID"))
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+//PUT /api/v1/notes/{NoteID}/notebook moves a note into one of the logged in users notebooks, or out of its notebook
+func apiMoveNote(w http.ResponseWriter, r *http.Request) error {
+	userID, err := apiUser(r)
+	if err != nil {
+		return err
+	}
+	var body moveRequest
+	if err := readJSON(r, &body); err != nil {
+		return err
+	}
+	if body.NotebookID < 0 {
+		return badRequest("notebookID must be a positive whole number, or 0 to take the note out of its notebook")
+	}
+	err = moveNoteTo(userID, routeID(r, "NoteID"), body.NotebookID)
+	if err != nil {
+		return err
+	}
+	note, err := store.GetNote(routeID(r, "NoteID"))
+	if err != nil {
+		return err
+	}
+	setNoteETag(w, note)
+	return writeJSON(w, http.StatusOK, note)
+}
+
+//POST /api/v1/notes/{NoteID}/transfer gives a note to another user, who becomes its owner
+func apiTransferNote(w http.ResponseWriter, r *http.Request) error {
+	note, _ := routeNote(r)
+	var body transferRequest
+	if err := readJSON(r, &body); err != nil {
+		return err
+	}
+	if _, err := parseID(strconv.Itoa(body.UserID)); err != nil {
+		return badRequest("userID must be a positive whole number")
+	}
+	err := transferNote(note, body.UserID, body.KeepAccess)
+	if err != nil {
+		return err
+	}
+	note, err = store.GetNote(note.NoteID)
+	if err != nil {
+		return err
+	}
+	setNoteETag(w, note)
+	return writeJSON(w, http.StatusOK, note)
+}
+
+//POST /api/v1/notes/{NoteID}/leave takes the logged in user off a note that has been shared with them. Answers 204,
+//or 200 with the role they still have if the note is also shared with them through a notebook
+func apiLeaveNote(w http.ResponseWriter, r *http.Request) error {
+	userID, err := apiUser(r)
+	if err != nil {
+		return err
+	}
+	note, _ := routeNote(r)
+	remaining, err := leaveNote(note, userID)
+	if err != nil {
+		return err
+	}
+	if remaining != "" {
+		return writeJSON(w, http.StatusOK, leaveResponse{NotebookRole: remaining})
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+//GET /api/v1/notes/{NoteID}/attachments lists the files attached to a note, oldest first
+func apiGetAttachments(w http.ResponseWriter, r *http.Request) error {
+	note, _ := routeNote(r)
+	attachments, err := store.GetAttachments(note.NoteID)
+	if err != nil {
+		return err
+	}
+	if attachments == nil {
+		attachments = []Attachment{}
+	}
+	return writeJSON(w, http.StatusOK, attachments)
+}
+
+//POST /api/v1/notes/{NoteID}/attachments attaches the file in the multipart field "file" to a note
+func apiAddAttachment(w http.ResponseWriter, r *http.Request) error {
+	userID, err := apiUser(r)
+	if err != nil {
+		return err
+	}
+	note, _ := routeNote(r)
+	attachment, err := uploadAttachment(w, r, note.NoteID, userID)
+	if err != nil {
+		return err
+	}
+	return writeJSON(w, http.StatusCreated, attachment)
+}
+
+//GET /api/v1/notes/{NoteID}/attachments/{AttachmentID} downloads a file attached to a note
+func apiDownloadAttachment(w http.ResponseWriter, r *http.Request) error {
+	note, _ := routeNote(r)
+	attachment, err := noteAttachment(r, note)
+	if err != nil {
+		return err
+	}
+	return serveAttachment(w, r, attachment)
+}
+
+//DELETE /api/v1/notes/{NoteID}/attachments/{AttachmentID} deletes a file attached to a note
+func apiDeleteAttachment(w http.ResponseWriter, r *http.Request) error {
+	note, _ := routeNote(r)
+	attachment, err := noteAttachment(r, note)
+	if err != nil {
+		return err
+	}
+	if err := removeAttachment(attachment); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
+
+//GET /api/v1/trash lists the notes in the logged in users trash, most recently deleted first
+func apiGetTrash(w http.ResponseWriter, r *http.Request) error {
+	userID, err := apiUser(r)
+	if err != nil {
+		return err
+	}
+	trash, err := store.GetTrash(userID)
+	if err != nil {
+		return err
+	}
+	if trash == nil {
+		trash = []TrashedNote{}
+	}
+	return writeJSON(w, http.StatusOK, trash)
+}
+
+//POST /api/v1/trash/{NoteID}/restore takes a note out of the trash, shared as it was before it was deleted
+func apiRestoreNote(w http.ResponseWriter, r *http.Request) error {
+	userID, err := apiUser(r)
+	if err != nil {
+		return err
+	}
+	_, err = restoreTrashedNote(userID, routeID(r, "NoteID"))
+	if err != nil {
+		return err
+	}
+	note, err := store.GetNote(routeID(r, "NoteID"))
+	if err != nil {
+		return err
+	}
+	setNoteETag(w, note)
+	return writeJSON(w, http.StatusOK, note)
+}
+
+//DELETE /api/v1/trash/{NoteID} deletes a note in the trash for good, along with its attachments
+func apiPurgeNote(w http.ResponseWriter, r *http.Request) error {
+	userID, err := apiUser(r)
+	if err != nil {
+		return err
+	}
+	if err := purgeTrashedNote(userID, routeID(r, "NoteID")); err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusNoContent)
+	return nil
+}
@@ -0,0 +1,175 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//Sends a JSON request through the router as the given user (0 for logged out) and returns the response
+func apiRequest(method string, path string, userID int, body interface{}) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	if body != nil {
+		json.NewEncoder(&buf).Encode(body)
+	}
+	req := httptest.NewRequest(method, path, &buf)
+	req.Header.Set("Content-Type", "application/json")
+	if userID != 0 {
+		token, err := startSession(userID)
+		if err != nil {
+			panic(err)
+		}
+		req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+	}
+	rec := httptest.NewRecorder()
+	newRouter().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAPIRequiresLogIn(t *testing.T) {
+	rec := apiRequest("GET", "/api/v1/notes", 0, nil)
+
+	assert.Equal(t, http.StatusUnauthorized, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+	assert.JSONEq(t, `{"error":"not logged in"}`, rec.Body.String())
+}
+
+func TestAPIUnknownRoute(t *testing.T) {
+	rec := apiRequest("GET", "/api/v1/nothing", 1, nil)
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.JSONEq(t, `{"error":"resource not found"}`, rec.Body.String())
+}
+
+func TestAPINoteLifecycle(t *testing.T) {
+	owner, err := registerUser("API", "Owner", "password")
+	assert.NoError(t, err)
+	other, err := registerUser("API", "Other", "password")
+	assert.NoError(t, err)
+
+	//Create
+	rec := apiRequest("POST", "/api/v1/notes", owner.UserID, noteRequest{Title: "api title", Contents: "api contents"})
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var note Note
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &note))
+	assert.NotZero(t, note.NoteID)
+	assert.Equal(t, owner.UserID, note.UserID)
+	path := "/api/v1/notes/" + strconv.Itoa(note.NoteID)
+	assert.Equal(t, path, rec.Header().Get("Location"))
+
+	//Read
+	rec = apiRequest("GET", path, owner.UserID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	//Users the note is not shared with cannot see it
+	rec = apiRequest("GET", path, other.UserID, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	//Share read only, then the other user can read but not write
+	rec = apiRequest("POST", path+"/access", owner.UserID, accessRequest{UserID: other.UserID, Read: true})
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	rec = apiRequest("GET", path, other.UserID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = apiRequest("PUT", path, other.UserID, noteRequest{Title: "hijacked"})
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	//Grant write, then the other user can update
+	rec = apiRequest("PUT", path+"/access/"+strconv.Itoa(other.UserID), owner.UserID, accessRequest{Write: true})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var access NoteAccess
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &access))
+	assert.Equal(t, owner.UserID, access.GrantedBy)
+	assert.False(t, access.DateGranted.IsZero())
+	rec = apiRequest("PUT", path, other.UserID, noteRequest{Title: "new title", Contents: "new contents", Version: note.Version})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &note))
+	assert.Equal(t, "new title", note.Title)
+
+	//Access can only be revoked from users the note is shared with
+	rec = apiRequest("DELETE", path+"/access/"+strconv.Itoa(owner.UserID), owner.UserID, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Body.String(), "That note has not been shared with that user.")
+	rec = apiRequest("PUT", path+"/access/"+strconv.Itoa(owner.UserID), owner.UserID, accessRequest{Role: "viewer"})
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Body.String(), "That note has not been shared with that user.")
+
+	//An editor can not delete
+	rec = apiRequest("DELETE", path, other.UserID, nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = apiRequest("DELETE", path, owner.UserID, nil)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	rec = apiRequest("GET", path, owner.UserID, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestAPIInvalidBody(t *testing.T) {
+	req := httptest.NewRequest("POST", "/api/v1/notes", bytes.NewBufferString("{not json"))
+	token, err := startSession(1)
+	assert.NoError(t, err)
+	req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+	rec := httptest.NewRecorder()
+	newRouter().ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestAPIMethodNotAllowed(t *testing.T) {
+	rec := apiRequest("PATCH", "/api/v1/notes/1", 1, nil)
+
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+}
+
+func TestAPIUpdateConflicts(t *testing.T) {
+	owner, err := registerUser("API Conflict", "Owner", "password")
+	assert.NoError(t, err)
+	rec := apiRequest("POST", "/api/v1/notes", owner.UserID, noteRequest{Title: "title", Contents: "original"})
+	assert.Equal(t, `"1"`, rec.Header().Get("ETag"))
+	var note Note
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &note))
+	path := "/api/v1/notes/" + strconv.Itoa(note.NoteID)
+
+	//Saving without saying which version was edited could overwrite someone elses changes
+	rec = apiRequest("PUT", path, owner.UserID, noteRequest{Title: "title", Contents: "blind"})
+	assert.Equal(t, http.StatusPreconditionRequired, rec.Code)
+
+	//The first editor to save wins, the second is told what changed
+	rec = apiRequest("PUT", path, owner.UserID, noteRequest{Title: "title", Contents: "first", Version: 1})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `"2"`, rec.Header().Get("ETag"))
+	rec = apiRequest("PUT", path, owner.UserID, noteRequest{Title: "title", Contents: "second", Version: 1})
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	var conflict apiConflict
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &conflict))
+	assert.Equal(t, "first", conflict.Current.Contents)
+	assert.Equal(t, 2, conflict.Current.Version)
+
+	//The same through If-Match
+	put := func(ifMatch string) *httptest.ResponseRecorder {
+		var buf bytes.Buffer
+		json.NewEncoder(&buf).Encode(noteRequest{Title: "title", Contents: "if-match " + ifMatch})
+		req := httptest.NewRequest("PUT", path, &buf)
+		req.Header.Set("If-Match", ifMatch)
+		token, err := startSession(owner.UserID)
+		assert.NoError(t, err)
+		req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+		rec := httptest.NewRecorder()
+		newRouter().ServeHTTP(rec, req)
+		return rec
+	}
+	assert.Equal(t, http.StatusPreconditionFailed, put(`"1"`).Code)
+	assert.Equal(t, http.StatusPreconditionFailed, put(`W/"2"`).Code)
+	rec = put(`"2"`)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, `"3"`, rec.Header().Get("ETag"))
+	assert.Equal(t, http.StatusOK, put("*").Code)
+
+	saved, err := store.GetNote(note.NoteID)
+	assert.NoError(t, err)
+	assert.Equal(t, "if-match *", saved.Contents)
+	assert.Equal(t, 4, saved.Version)
+}
@@ -0,0 +1,266 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+//Largest file that can be attached to a note, and the longest a file name can be
+const (
+	maxAttachmentBytes      = 10 << 20
+	maxAttachmentNameLength = 255
+)
+
+//Room in an upload for the rest of the form around the file
+const attachmentFormOverhead = 1 << 20
+
+//Bytes http.DetectContentType looks at
+const sniffLength = 512
+
+//Error for a file over maxAttachmentBytes
+var errAttachmentTooLarge = &appError{Code: http.StatusRequestEntityTooLarge, Message: "Files can be at most " + strconv.Itoa(maxAttachmentBytes>>20) + " MB."}
+
+//Counts the bytes read through it
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (c *countingReader) Read(p []byte) (int, error) {
+	n, err := c.r.Read(p)
+	c.n += int64(n)
+	return n, err
+}
+
+//An attachments size in bytes, KB or MB, for showing on pages
+func (a Attachment) SizeText() string {
+	switch {
+	case a.Size >= 1<<20:
+		return strconv.FormatFloat(float64(a.Size)/(1<<20), 'f', 1, 64) + " MB"
+	case a.Size >= 1<<10:
+		return strconv.FormatFloat(float64(a.Size)/(1<<10), 'f', 1, 64) + " KB"
+	}
+	return strconv.FormatInt(a.Size, 10) + " bytes"
+}
+
+//Tidies up the name a file was uploaded with. Folders, control characters and anything past maxAttachmentNameLength
+//are dropped
+func cleanFileName(name string) string {
+	if slash := strings.LastIndexAny(name, `/\`); slash >= 0 {
+		name = name[slash+1:]
+	}
+	name = strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == utf8.RuneError {
+			return -1
+		}
+		return r
+	}, name))
+	if utf8.RuneCountInString(name) > maxAttachmentNameLength {
+		name = string([]rune(name)[:maxAttachmentNameLength])
+	}
+	if name == "" || name == "." || name == ".." {
+		return "attachment"
+	}
+	return name
+}
+
+//Saves a file to the blob store and attaches it to a note. The content type is sniffed from the start of the file,
+//because the one sent with an upload can be anything
+func saveAttachment(noteID int, userID int, fileName string, file io.Reader) (Attachment, error) {
+	key, err := newBlobKey()
+	if err != nil {
+		return Attachment{}, err
+	}
+	head := make([]byte, sniffLength)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return Attachment{}, attachmentReadError(err)
+	}
+	head = head[:n]
+
+	//Reads one byte past the limit, so a file that is too large can be told apart from one that is exactly the limit
+	counter := &countingReader{r: io.LimitReader(io.MultiReader(bytes.NewReader(head), file), maxAttachmentBytes+1)}
+	err = blobs.Put(key, counter)
+	if err != nil {
+		blobs.Delete(key)
+		return Attachment{}, attachmentReadError(err)
+	}
+	if counter.n > maxAttachmentBytes {
+		blobs.Delete(key)
+		return Attachment{}, errAttachmentTooLarge
+	}
+
+	attachment, err := store.AddAttachment(Attachment{
+		NoteID:      noteID,
+		UserID:      userID,
+		FileName:    cleanFileName(fileName),
+		ContentType: http.DetectContentType(head),
+		Size:        counter.n,
+		BlobKey:     key,
+		DateCreated: time.Now(),
+	})
+	if err != nil {
+		blobs.Delete(key)
+		return Attachment{}, err
+	}
+	return attachment, nil
+}
+
+//Turns an upload that was cut off for being too large into a 413 error
+func attachmentReadError(err error) error {
+	var tooLarge *http.MaxBytesError
+	if errors.As(err, &tooLarge) {
+		return errAttachmentTooLarge
+	}
+	return err
+}
+
+//Reads the file field of a multipart upload and attaches it to a note. The file is streamed to the blob store rather
+//than held in memory
+func uploadAttachment(w http.ResponseWriter, r *http.Request, noteID int, userID int) (Attachment, error) {
+	r.Body = http.MaxBytesReader(w, r.Body, maxAttachmentBytes+attachmentFormOverhead)
+	reader, err := r.MultipartReader()
+	if err != nil {
+		return Attachment{}, badRequest("Choose a file to attach.")
+	}
+	for {
+		part, err := reader.NextPart()
+		if err == io.EOF {
+			return Attachment{}, badRequest("Choose a file to attach.")
+		}
+		if err != nil {
+			return Attachment{}, attachmentReadError(err)
+		}
+		if part.FormName() == "file" && part.FileName() != "" {
+			defer part.Close()
+			return saveAttachment(noteID, userID, part.FileName(), part)
+		}
+		part.Close()
+	}
+}
+
+//Loads the attachment in the route and checks it is on the given note
+func noteAttachment(r *http.Request, note Note) (Attachment, error) {
+	attachment, err := store.GetAttachment(routeID(r, "AttachmentID"))
+	if err != nil && err != errNotFound {
+		return attachment, err
+	}
+	if err == errNotFound || attachment.NoteID != note.NoteID {
+		return attachment, notFound("That attachment does not exist.")
+	}
+	return attachment, nil
+}
+
+//Sends an attachment as a download. It is never shown in the page, so an uploaded HTML or SVG file can not run
+//scripts on this site
+func serveAttachment(w http.ResponseWriter, r *http.Request, attachment Attachment) error {
+	file, err := blobs.Open(attachment.BlobKey)
+	if err == errNotFound {
+		return notFound("The file for that attachment is missing.")
+	}
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	disposition := mime.FormatMediaType("attachment", map[string]string{"filename": attachment.FileName})
+	if disposition == "" {
+		disposition = "attachment"
+	}
+	w.Header().Set("Content-Type", attachment.ContentType)
+	w.Header().Set("Content-Length", strconv.FormatInt(attachment.Size, 10))
+	w.Header().Set("Content-Disposition", disposition)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	if _, err := io.Copy(w, file); err != nil {
+		//The headers have gone, so all that can be done is to log it
+		logWarn("request %s: sending attachment %d: %v", requestID(r), attachment.AttachmentID, err)
+	}
+	return nil
+}
+
+//Deletes an attachment and its file
+func removeAttachment(attachment Attachment) error {
+	err := store.DeleteAttachment(attachment.AttachmentID)
+	if err != nil {
+		return err
+	}
+	return blobs.Delete(attachment.BlobKey)
+}
+
+//Deletes a note along with the files attached to it. The files are deleted once the note is gone, and a file that can
+//not be deleted is only logged, as the note has already been deleted
+func deleteNoteAndAttachments(noteID int) error {
+	attachments, err := store.GetAttachments(noteID)
+	if err != nil {
+		return err
+	}
+	err = store.DeleteNote(noteID)
+	if err != nil {
+		return err
+	}
+	for _, attachment := range attachments {
+		if err := blobs.Delete(attachment.BlobKey); err != nil {
+			logWarn("deleting attachment %d of deleted note %d: %v", attachment.AttachmentID, noteID, err)
+		}
+	}
+	return nil
+}
+
+//Attaches an uploaded file to a note
+func attachFile(w http.ResponseWriter, r *http.Request) error {
+	//Checks if a user is already logged in
+	session, err := requireSession(w, r)
+	if session == nil {
+		return err
+	}
+	note, _ := routeNote(r)
+	_, err = uploadAttachment(w, r, note.NoteID, session.UserID)
+	if err != nil {
+		return err
+	}
+	http.Redirect(w, r, "/Notes/View/"+strconv.Itoa(note.NoteID), http.StatusSeeOther)
+	return nil
+}
+
+//Downloads a file attached to a note the user can read
+func downloadAttachment(w http.ResponseWriter, r *http.Request) error {
+	//Checks if a user is already logged in
+	session, err := requireSession(w, r)
+	if session == nil {
+		return err
+	}
+	note, _ := routeNote(r)
+	attachment, err := noteAttachment(r, note)
+	if err != nil {
+		return err
+	}
+	return serveAttachment(w, r, attachment)
+}
+
+//Deletes a file attached to a note
+func deleteAttachment(w http.ResponseWriter, r *http.Request) error {
+	//Checks if a user is already logged in
+	session, err := requireSession(w, r)
+	if session == nil {
+		return err
+	}
+	note, _ := routeNote(r)
+	attachment, err := noteAttachment(r, note)
+	if err != nil {
+		return err
+	}
+	err = removeAttachment(attachment)
+	if err != nil {
+		return err
+	}
+	http.Redirect(w, r, "/Notes/View/"+strconv.Itoa(note.NoteID), http.StatusSeeOther)
+	return nil
+}
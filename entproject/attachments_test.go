@@ -0,0 +1,236 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//Uploads a file as the "file" field of a multipart form, logged in as userID
+func uploadRequest(path string, userID int, fileName string, file io.Reader) *httptest.ResponseRecorder {
+	var buf bytes.Buffer
+	form := multipart.NewWriter(&buf)
+	part, err := form.CreateFormFile("file", fileName)
+	if err != nil {
+		panic(err)
+	}
+	if _, err := io.Copy(part, file); err != nil {
+		panic(err)
+	}
+	form.Close()
+
+	req := httptest.NewRequest("POST", path, &buf)
+	req.Header.Set("Content-Type", form.FormDataContentType())
+	if userID != 0 {
+		token, err := startSession(userID)
+		if err != nil {
+			panic(err)
+		}
+		req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+	}
+	rec := httptest.NewRecorder()
+	newRouter().ServeHTTP(rec, req)
+	return rec
+}
+
+func TestCleanFileName(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"report.pdf", "report.pdf"},
+		{`C:\Users\me\report.pdf`, "report.pdf"},
+		{"../../etc/passwd", "passwd"},
+		{"  spaced.txt  ", "spaced.txt"},
+		{"new\r\nline.txt", "newline.txt"},
+		{"", "attachment"},
+		{"..", "attachment"},
+		{"folder/", "attachment"},
+		{strings.Repeat("é", 300), strings.Repeat("é", maxAttachmentNameLength)},
+	}
+	for _, test := range tests {
+		assert.Equal(t, test.want, cleanFileName(test.name), test.name)
+	}
+}
+
+func TestAttachmentSizeText(t *testing.T) {
+	assert.Equal(t, "12 bytes", Attachment{Size: 12}.SizeText())
+	assert.Equal(t, "1.5 KB", Attachment{Size: 1536}.SizeText())
+	assert.Equal(t, "10.0 MB", Attachment{Size: maxAttachmentBytes}.SizeText())
+}
+
+func TestSaveAttachment(t *testing.T) {
+	owner, err := registerUser("Attachment", "Saver", "password")
+	assert.NoError(t, err)
+	note, err := saveNewNote(owner.UserID, "with files", "contents", "")
+	assert.NoError(t, err)
+
+	//The type is sniffed from the file, whatever its name says
+	png := append([]byte("\x89PNG\r\n\x1a\n"), make([]byte, 1000)...)
+	attachment, err := saveAttachment(note.NoteID, owner.UserID, "picture.txt", bytes.NewReader(png))
+	assert.NoError(t, err)
+	assert.Equal(t, "image/png", attachment.ContentType)
+	assert.Equal(t, int64(len(png)), attachment.Size)
+	assert.Equal(t, "picture.txt", attachment.FileName)
+	file, err := blobs.Open(attachment.BlobKey)
+	if assert.NoError(t, err) {
+		data, _ := io.ReadAll(file)
+		file.Close()
+		assert.Equal(t, png, data)
+	}
+
+	//A file of exactly the limit is fine, and one byte more is not
+	attachment, err = saveAttachment(note.NoteID, owner.UserID, "full.bin", bytes.NewReader(make([]byte, maxAttachmentBytes)))
+	assert.NoError(t, err)
+	assert.Equal(t, int64(maxAttachmentBytes), attachment.Size)
+	_, err = saveAttachment(note.NoteID, owner.UserID, "over.bin", bytes.NewReader(make([]byte, maxAttachmentBytes+1)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, errorCode(err))
+	attachments, err := store.GetAttachments(note.NoteID)
+	assert.NoError(t, err)
+	assert.Len(t, attachments, 2, "a file that is too large should not be attached")
+
+	//Deleting the note deletes its files
+	assert.NoError(t, deleteNoteAndAttachments(note.NoteID))
+	for _, attachment := range attachments {
+		_, err := blobs.Open(attachment.BlobKey)
+		assert.Equal(t, errNotFound, err, "deleting a note should delete its files")
+	}
+	attachments, err = store.GetAttachments(note.NoteID)
+	assert.NoError(t, err)
+	assert.Empty(t, attachments)
+}
+
+func TestAttachmentPages(t *testing.T) {
+	owner, err := registerUser("Attachment", "Owner", "password")
+	assert.NoError(t, err)
+	reader, err := registerUser("Attachment", "Reader", "password")
+	assert.NoError(t, err)
+	stranger, err := registerUser("Attachment", "Stranger", "password")
+	assert.NoError(t, err)
+	note, err := saveNewNote(owner.UserID, "shared files", "contents", "")
+	assert.NoError(t, err)
+	_, err = store.AddAccess(NoteAccess{NoteID: note.NoteID, UserID: reader.UserID, Role: roleViewer})
+	assert.NoError(t, err)
+	path := "/Notes/Attachments/" + strconv.Itoa(note.NoteID)
+
+	rec := uploadRequest(path, owner.UserID, "page.html", strings.NewReader("<html><script>alert(1)</script></html>"))
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	attachments, err := store.GetAttachments(note.NoteID)
+	assert.NoError(t, err)
+	if !assert.Len(t, attachments, 1) {
+		return
+	}
+	attachment := attachments[0]
+	download := path + "/" + strconv.Itoa(attachment.AttachmentID)
+
+	//Only users who can write to the note can attach files
+	rec = uploadRequest(path, reader.UserID, "other.txt", strings.NewReader("text"))
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = uploadRequest(path, stranger.UserID, "other.txt", strings.NewReader("text"))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = uploadRequest(path, 0, "other.txt", strings.NewReader("text"))
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	attachments, err = store.GetAttachments(note.NoteID)
+	assert.NoError(t, err)
+	assert.Len(t, attachments, 1)
+
+	//Anyone who can read the note can download its files, always as a download
+	rec = apiRequest("GET", download, reader.UserID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "<html><script>alert(1)</script></html>", rec.Body.String())
+	assert.Equal(t, "text/html; charset=utf-8", rec.Header().Get("Content-Type"))
+	assert.Equal(t, `attachment; filename=page.html`, rec.Header().Get("Content-Disposition"))
+	assert.Equal(t, "nosniff", rec.Header().Get("X-Content-Type-Options"))
+	rec = apiRequest("GET", download, stranger.UserID, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	//An attachment can only be reached through its own note
+	otherNote, err := saveNewNote(reader.UserID, "readers note", "contents", "")
+	assert.NoError(t, err)
+	rec = apiRequest("GET", "/Notes/Attachments/"+strconv.Itoa(otherNote.NoteID)+"/"+strconv.Itoa(attachment.AttachmentID), reader.UserID, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = apiRequest("GET", "/Notes/View/"+strconv.Itoa(note.NoteID), owner.UserID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), download)
+	assert.Contains(t, rec.Body.String(), `enctype="multipart/form-data"`)
+
+	//Deleting an attachment needs write access
+	deletePath := "/Notes/Attachments/Delete/" + strconv.Itoa(note.NoteID) + "/" + strconv.Itoa(attachment.AttachmentID)
+	rec = formRequest(deletePath, reader.UserID, nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = formRequest(deletePath, owner.UserID, nil)
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	_, err = blobs.Open(attachment.BlobKey)
+	assert.Equal(t, errNotFound, err)
+	rec = apiRequest("GET", download, owner.UserID, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestAttachmentAPI(t *testing.T) {
+	owner, err := registerUser("Attachment", "APIOwner", "password")
+	assert.NoError(t, err)
+	stranger, err := registerUser("Attachment", "APIStranger", "password")
+	assert.NoError(t, err)
+	note, err := saveNewNote(owner.UserID, "api files", "contents", "")
+	assert.NoError(t, err)
+	path := "/api/v1/notes/" + strconv.Itoa(note.NoteID) + "/attachments"
+
+	rec := apiRequest("GET", path, owner.UserID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `[]`, rec.Body.String())
+
+	rec = uploadRequest(path, owner.UserID, "notes.txt", strings.NewReader("plain text"))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var attachment Attachment
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &attachment))
+	assert.Equal(t, "notes.txt", attachment.FileName)
+	assert.Equal(t, "text/plain; charset=utf-8", attachment.ContentType)
+	assert.NotContains(t, rec.Body.String(), "lobKey", "the blob key should not be sent")
+
+	rec = uploadRequest(path, owner.UserID, "huge.bin", bytes.NewReader(make([]byte, maxAttachmentBytes+attachmentFormOverhead)))
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+	rec = apiRequest("POST", path, owner.UserID, map[string]string{"file": "not multipart"})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = uploadRequest(path, stranger.UserID, "notes.txt", strings.NewReader("plain text"))
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	download := path + "/" + strconv.Itoa(attachment.AttachmentID)
+	rec = apiRequest("GET", download, owner.UserID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "plain text", rec.Body.String())
+	rec = apiRequest("GET", download, stranger.UserID, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = apiRequest("DELETE", download, stranger.UserID, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = apiRequest("DELETE", download, owner.UserID, nil)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	rec = apiRequest("GET", path, owner.UserID, nil)
+	assert.JSONEq(t, `[]`, rec.Body.String())
+
+	//Files are kept while the note is in the trash, and deleted when it is purged
+	rec = uploadRequest(path, owner.UserID, "kept.txt", strings.NewReader("kept"))
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &attachment))
+	saved, err := store.GetAttachment(attachment.AttachmentID)
+	assert.NoError(t, err)
+	rec = apiRequest("DELETE", "/api/v1/notes/"+strconv.Itoa(note.NoteID), owner.UserID, nil)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	file, err := blobs.Open(saved.BlobKey)
+	if assert.NoError(t, err, "a note in the trash should keep its files") {
+		file.Close()
+	}
+	rec = apiRequest("DELETE", "/api/v1/trash/"+strconv.Itoa(note.NoteID), owner.UserID, nil)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	_, err = blobs.Open(saved.BlobKey)
+	assert.Equal(t, errNotFound, err)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"regexp"
+
+	"github.com/gorilla/mux"
+)
+
+//What a route with a {NoteID} needs the logged in user to be allowed to do with the note
+type notePolicy struct {
+	action capability
+	//The route works on a note in the trash, which only its owner can reach
+	trashed bool
+}
+
+//The policy for every route with a {NoteID}, keyed by method and path template without the patterns. A route that is
+//missing from here is refused, so a new route can not be left open by accident
+var notePolicies = map[string]notePolicy{
+	"GET /Notes/View/{NoteID}":                                   {action: capView},
+	"GET /Notes/Update/{NoteID}":                                 {action: capEdit},
+	"POST /Notes/Update/{NoteID}":                                {action: capEdit},
+	"GET /Notes/Delete/{NoteID}":                                 {action: capDelete},
+	"POST /Notes/Delete/{NoteID}":                                {action: capDelete},
+	"POST /Notes/Trash/Restore/{NoteID}":                         {trashed: true},
+	"POST /Notes/Trash/Delete/{NoteID}":                          {trashed: true},
+	"POST /Notes/Attachments/{NoteID}":                           {action: capEdit},
+	"GET /Notes/Attachments/{NoteID}/{AttachmentID}":             {action: capView},
+	"POST /Notes/Attachments/Delete/{NoteID}/{AttachmentID}":     {action: capEdit},
+	"GET /Notes/Analyse/{NoteID}":                                {action: capView},
+	"POST /Notes/Analyse/{NoteID}":                               {action: capView},
+	"GET /Notes/Share/{NoteID}":                                  {action: capShare},
+	"POST /Notes/Share/{NoteID}":                                 {action: capShare},
+	"GET /Notes/ViewAccess/{NoteID}":                             {action: capShare},
+	"GET /Notes/EditAccess/{NoteID}":                             {action: capShare},
+	"POST /Notes/EditAccess/{NoteID}":                            {action: capShare},
+	"POST /Notes/RevokeAccess/{NoteID}":                          {action: capShare},
+	"GET /Notes/Transfer/{NoteID}":                               {action: capTransfer},
+	"POST /Notes/Transfer/{NoteID}":                              {action: capTransfer},
+	"POST /Notes/Leave/{NoteID}":                                 {action: capView},
+	"GET /Notes/CreateSharedSetting/{NoteID}":                    {action: capShare},
+	"POST /Notes/CreateSharedSetting/{NoteID}":                   {action: capShare},
+	"POST /Notes/Move/{NoteID}":                                  {action: capMove},
+	"GET /Notes/History/{NoteID}":                                {action: capView},
+	"GET /Notes/Diff/{NoteID}":                                   {action: capView},
+	"POST /Notes/Restore/{NoteID}/{RevisionID}":                  {action: capEdit},
+	"GET /api/v1/notes/{NoteID}":                                 {action: capView},
+	"PUT /api/v1/notes/{NoteID}":                                 {action: capEdit},
+	"DELETE /api/v1/notes/{NoteID}":                              {action: capDelete},
+	"GET /api/v1/notes/{NoteID}/revisions":                       {action: capView},
+	"GET /api/v1/notes/{NoteID}/revisions/{RevisionID}":          {action: capView},
+	"POST /api/v1/notes/{NoteID}/revisions/{RevisionID}/restore": {action: capEdit},
+	"GET /api/v1/notes/{NoteID}/diff":                            {action: capView},
+	"GET /api/v1/notes/{NoteID}/analysis":                        {action: capView},
+	"GET /api/v1/notes/{NoteID}/access":                          {action: capShare},
+	"POST /api/v1/notes/{NoteID}/access":                         {action: capShare},
+	"PUT /api/v1/notes/{NoteID}/access/{UserID}":                 {action: capShare},
+	"DELETE /api/v1/notes/{NoteID}/access/{UserID}":              {action: capShare},
+	"GET /api/v1/notes/{NoteID}/attachments":                     {action: capView},
+	"POST /api/v1/notes/{NoteID}/attachments":                    {action: capEdit},
+	"GET /api/v1/notes/{NoteID}/attachments/{AttachmentID}":      {action: capView},
+	"DELETE /api/v1/notes/{NoteID}/attachments/{AttachmentID}":   {action: capEdit},
+	"POST /api/v1/notes/{NoteID}/sharedsettings":                 {action: capShare},
+	"POST /api/v1/notes/{NoteID}/transfer":                       {action: capTransfer},
+	"POST /api/v1/notes/{NoteID}/leave":                          {action: capView},
+	"PUT /api/v1/notes/{NoteID}/notebook":                        {action: capMove},
+	"DELETE /api/v1/trash/{NoteID}":                              {trashed: true},
+	"POST /api/v1/trash/{NoteID}/restore":                        {trashed: true},
+}
+
+//Matches the pattern part of a route variable, such as :[0-9]{1,9} in {NoteID:[0-9]{1,9}}
+var routePattern = regexp.MustCompile(`\{(\w+):[^/]*\}`)
+
+//The key a route is found under in notePolicies, such as "GET /Notes/View/{NoteID}"
+func notePolicyKey(method string, pathTemplate string) string {
+	return method + " " + routePattern.ReplaceAllString(pathTemplate, "{$1}")
+}
+
+//Context key for the note authoriseNoteRoutes loaded
+type routeNoteKey struct{}
+
+//A note and the role the logged in user has on it
+type authorisedNote struct {
+	Note Note
+	Role Role
+}
+
+//Gets the note in the route, and the logged in users role on it, after authoriseNoteRoutes has checked they may use
+//the route
+func routeNote(r *http.Request) (Note, Role) {
+	authorised, _ := r.Context().Value(routeNoteKey{}).(authorisedNote)
+	return authorised.Note, authorised.Role
+}
+
+//Middleware that checks the logged in user may use a route with a {NoteID} before its handler runs. The note and
+//their role on it are passed on for routeNote. Pages send users who are not logged in to the log in page and the API
+//answers 401. Notes the user can not see are 404 and actions their role does not allow are 403
+func authoriseNoteRoutes(api bool) mux.MiddlewareFunc {
+	return func(next http.Handler) http.Handler {
+		check := func(w http.ResponseWriter, r *http.Request) error {
+			if _, ok := mux.Vars(r)["NoteID"]; !ok {
+				next.ServeHTTP(w, r)
+				return nil
+			}
+
+			var userID int
+			if api {
+				var err error
+				userID, err = apiUser(r)
+				if err != nil {
+					return err
+				}
+			} else {
+				session, err := requireSession(w, r)
+				if session == nil {
+					return err
+				}
+				userID = session.UserID
+			}
+
+			pathTemplate, err := mux.CurrentRoute(r).GetPathTemplate()
+			if err != nil {
+				return err
+			}
+			policy, ok := notePolicies[notePolicyKey(r.Method, pathTemplate)]
+			if !ok {
+				return fmt.Errorf("no note policy for %s", notePolicyKey(r.Method, pathTemplate))
+			}
+
+			var authorised authorisedNote
+			if policy.trashed {
+				trashed, err := ownedTrashedNote(userID, routeID(r, "NoteID"))
+				if err != nil {
+					return err
+				}
+				authorised = authorisedNote{trashed.Note, roleOwner}
+			} else {
+				authorised.Note, authorised.Role, err = authoriseNote(routeID(r, "NoteID"), userID, policy.action)
+				if err != nil && api {
+					return apiNoteError(err, policy.action)
+				}
+				if err != nil {
+					return err
+				}
+			}
+			next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), routeNoteKey{}, authorised)))
+			return nil
+		}
+		if api {
+			return apiHandler(check)
+		}
+		return appHandler(check)
+	}
+}
+
+//Rewords an error from authoriseNote in the style of the other API errors
+func apiNoteError(err error, action capability) error {
+	appErr, ok := err.(*appError)
+	if !ok {
+		return err
+	}
+	if appErr.Code == http.StatusNotFound {
+		return notFound("note not found")
+	}
+	return forbidden("your role on this note does not let you " + capabilityActions[action])
+}
@@ -0,0 +1,243 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/stretchr/testify/assert"
+)
+
+//Lists the policy key of every route with a {NoteID} on a router
+func noteRouteKeys(t *testing.T, r *mux.Router) []string {
+	var keys []string
+	err := r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		pathTemplate, err := route.GetPathTemplate()
+		if err != nil || !strings.Contains(pathTemplate, "{NoteID") {
+			return nil
+		}
+		methods, err := route.GetMethods()
+		assert.NoError(t, err, pathTemplate)
+		for _, method := range methods {
+			keys = append(keys, notePolicyKey(method, pathTemplate))
+		}
+		return nil
+	})
+	assert.NoError(t, err)
+	return keys
+}
+
+func TestNotePoliciesCoverEveryRoute(t *testing.T) {
+	keys := append(noteRouteKeys(t, newRouter()), noteRouteKeys(t, apiRouter())...)
+	seen := make(map[string]bool)
+	for _, key := range keys {
+		_, ok := notePolicies[key]
+		assert.True(t, ok, "%s has no note policy", key)
+		seen[key] = true
+	}
+	for key := range notePolicies {
+		assert.True(t, seen[key], "%s is not a route", key)
+	}
+	assert.Equal(t, "GET /Notes/Attachments/{NoteID}/{AttachmentID}", notePolicyKey("GET", "/Notes/Attachments/{NoteID:[0-9]{1,9}}/{AttachmentID:[0-9]{1,9}}"))
+}
+
+//Sends a request as the given user (0 for logged out) through a router
+func serveAs(r *mux.Router, method string, path string, userID int) *httptest.ResponseRecorder {
+	req := httptest.NewRequest(method, path, nil)
+	if userID != 0 {
+		token, err := startSession(userID)
+		if err != nil {
+			panic(err)
+		}
+		req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+	}
+	rec := httptest.NewRecorder()
+	r.ServeHTTP(rec, req)
+	return rec
+}
+
+func TestAuthoriseNoteRoutes(t *testing.T) {
+	owner, err := registerUser("Policy", "Owner", "password")
+	assert.NoError(t, err)
+	note, err := saveNewNote(owner.UserID, "title", "contents", "")
+	assert.NoError(t, err)
+	trashed, err := saveNewNote(owner.UserID, "trashed", "contents", "")
+	assert.NoError(t, err)
+	users := map[Role]int{roleOwner: owner.UserID}
+	for _, role := range sharedRoles {
+		user, err := registerUser("Policy", string(role), "password")
+		assert.NoError(t, err)
+		for _, noteID := range []int{note.NoteID, trashed.NoteID} {
+			_, err = store.AddAccess(NoteAccess{NoteID: noteID, UserID: user.UserID, Role: role})
+			assert.NoError(t, err)
+		}
+		users[role] = user.UserID
+	}
+	stranger, err := registerUser("Policy", "Stranger", "password")
+	assert.NoError(t, err)
+	users[""] = stranger.UserID
+	assert.NoError(t, store.TrashNote(trashed.NoteID, note.DateCreated))
+
+	//Routers with every policy on a handler that only reports what it was given, so the checks can be tested without
+	//the handlers changing anything
+	pages, api := mux.NewRouter(), mux.NewRouter()
+	reached := func(w http.ResponseWriter, r *http.Request) {
+		note, role := routeNote(r)
+		w.Write([]byte(strconv.Itoa(note.NoteID) + " " + string(role)))
+	}
+	for key := range notePolicies {
+		method, path, _ := strings.Cut(key, " ")
+		router := pages
+		if strings.HasPrefix(path, apiPrefix) {
+			router = api
+		}
+		router.HandleFunc(path, reached).Methods(method)
+	}
+	pages.Use(authoriseNoteRoutes(false))
+	api.Use(authoriseNoteRoutes(true))
+
+	//The least role that can use each route. Trash routes only work for the owner, on a note in their trash
+	tests := []struct {
+		key     string
+		least   Role
+		trashed bool
+	}{
+		{"GET /Notes/View/{NoteID}", roleViewer, false},
+		{"GET /Notes/Update/{NoteID}", roleEditor, false},
+		{"POST /Notes/Update/{NoteID}", roleEditor, false},
+		{"GET /Notes/Delete/{NoteID}", roleCoOwner, false},
+		{"POST /Notes/Delete/{NoteID}", roleCoOwner, false},
+		{"POST /Notes/Trash/Restore/{NoteID}", roleOwner, true},
+		{"POST /Notes/Trash/Delete/{NoteID}", roleOwner, true},
+		{"POST /Notes/Attachments/{NoteID}", roleEditor, false},
+		{"GET /Notes/Attachments/{NoteID}/{AttachmentID}", roleViewer, false},
+		{"POST /Notes/Attachments/Delete/{NoteID}/{AttachmentID}", roleEditor, false},
+		{"GET /Notes/Analyse/{NoteID}", roleViewer, false},
+		{"POST /Notes/Analyse/{NoteID}", roleViewer, false},
+		{"GET /Notes/Share/{NoteID}", roleCoOwner, false},
+		{"POST /Notes/Share/{NoteID}", roleCoOwner, false},
+		{"GET /Notes/ViewAccess/{NoteID}", roleCoOwner, false},
+		{"GET /Notes/EditAccess/{NoteID}", roleCoOwner, false},
+		{"POST /Notes/EditAccess/{NoteID}", roleCoOwner, false},
+		{"POST /Notes/RevokeAccess/{NoteID}", roleCoOwner, false},
+		{"GET /Notes/Transfer/{NoteID}", roleOwner, false},
+		{"POST /Notes/Transfer/{NoteID}", roleOwner, false},
+		{"POST /Notes/Leave/{NoteID}", roleViewer, false},
+		{"GET /Notes/CreateSharedSetting/{NoteID}", roleCoOwner, false},
+		{"POST /Notes/CreateSharedSetting/{NoteID}", roleCoOwner, false},
+		{"POST /Notes/Move/{NoteID}", roleOwner, false},
+		{"GET /Notes/History/{NoteID}", roleViewer, false},
+		{"GET /Notes/Diff/{NoteID}", roleViewer, false},
+		{"POST /Notes/Restore/{NoteID}/{RevisionID}", roleEditor, false},
+		{"GET /api/v1/notes/{NoteID}", roleViewer, false},
+		{"PUT /api/v1/notes/{NoteID}", roleEditor, false},
+		{"DELETE /api/v1/notes/{NoteID}", roleCoOwner, false},
+		{"GET /api/v1/notes/{NoteID}/revisions", roleViewer, false},
+		{"GET /api/v1/notes/{NoteID}/revisions/{RevisionID}", roleViewer, false},
+		{"POST /api/v1/notes/{NoteID}/revisions/{RevisionID}/restore", roleEditor, false},
+		{"GET /api/v1/notes/{NoteID}/diff", roleViewer, false},
+		{"GET /api/v1/notes/{NoteID}/analysis", roleViewer, false},
+		{"GET /api/v1/notes/{NoteID}/access", roleCoOwner, false},
+		{"POST /api/v1/notes/{NoteID}/access", roleCoOwner, false},
+		{"PUT /api/v1/notes/{NoteID}/access/{UserID}", roleCoOwner, false},
+		{"DELETE /api/v1/notes/{NoteID}/access/{UserID}", roleCoOwner, false},
+		{"GET /api/v1/notes/{NoteID}/attachments", roleViewer, false},
+		{"POST /api/v1/notes/{NoteID}/attachments", roleEditor, false},
+		{"GET /api/v1/notes/{NoteID}/attachments/{AttachmentID}", roleViewer, false},
+		{"DELETE /api/v1/notes/{NoteID}/attachments/{AttachmentID}", roleEditor, false},
+		{"POST /api/v1/notes/{NoteID}/sharedsettings", roleCoOwner, false},
+		{"POST /api/v1/notes/{NoteID}/transfer", roleOwner, false},
+		{"POST /api/v1/notes/{NoteID}/leave", roleViewer, false},
+		{"PUT /api/v1/notes/{NoteID}/notebook", roleOwner, false},
+		{"DELETE /api/v1/trash/{NoteID}", roleOwner, true},
+		{"POST /api/v1/trash/{NoteID}/restore", roleOwner, true},
+	}
+	assert.Len(t, tests, len(notePolicies))
+	for _, test := range tests {
+		_, ok := notePolicies[test.key]
+		assert.True(t, ok, test.key)
+		method, path, _ := strings.Cut(test.key, " ")
+		router, isAPI := pages, false
+		if strings.HasPrefix(path, apiPrefix) {
+			router, isAPI = api, true
+		}
+		noteID := note.NoteID
+		if test.trashed {
+			noteID = trashed.NoteID
+		}
+		path = strings.NewReplacer("{NoteID}", strconv.Itoa(noteID), "{AttachmentID}", "1", "{RevisionID}", "1", "{UserID}", "1").Replace(path)
+
+		//Logged out users are sent to log in, or told to by the API
+		rec := serveAs(router, method, path, 0)
+		if isAPI {
+			assert.Equal(t, http.StatusUnauthorized, rec.Code, test.key)
+		} else {
+			assert.Equal(t, http.StatusSeeOther, rec.Code, test.key)
+			assert.Equal(t, "/Users/LogIn", rec.Header().Get("Location"), test.key)
+		}
+
+		for role, userID := range users {
+			rec := serveAs(router, method, path, userID)
+			switch {
+			case role.rank() >= test.least.rank():
+				if assert.Equal(t, http.StatusOK, rec.Code, "%s as %q", test.key, role) {
+					assert.Equal(t, strconv.Itoa(noteID)+" "+string(role), rec.Body.String(), test.key)
+				}
+			case !test.trashed && role != "":
+				assert.Equal(t, http.StatusForbidden, rec.Code, "%s as %q", test.key, role)
+			default:
+				assert.Equal(t, http.StatusNotFound, rec.Code, "%s as %q", test.key, role)
+			}
+		}
+
+		//Notes that do not exist are not found, even by their would be owner
+		missing := strings.Replace(path, strconv.Itoa(noteID), "999999999", 1)
+		rec = serveAs(router, method, missing, owner.UserID)
+		assert.Equal(t, http.StatusNotFound, rec.Code, test.key)
+	}
+
+	//A route without a policy is refused rather than left open
+	pages.HandleFunc("/Notes/Unlisted/{NoteID}", reached).Methods("GET")
+	rec := serveAs(pages, "GET", "/Notes/Unlisted/"+strconv.Itoa(note.NoteID), owner.UserID)
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+}
+
+func TestNoteRoutesThroughRouter(t *testing.T) {
+	owner, err := registerUser("Router", "Owner", "password")
+	assert.NoError(t, err)
+	viewer, err := registerUser("Router", "Viewer", "password")
+	assert.NoError(t, err)
+	stranger, err := registerUser("Router", "Stranger", "password")
+	assert.NoError(t, err)
+	note, err := saveNewNote(owner.UserID, "private title", "private contents", "")
+	assert.NoError(t, err)
+	_, err = store.AddAccess(NoteAccess{NoteID: note.NoteID, UserID: viewer.UserID, Role: roleViewer})
+	assert.NoError(t, err)
+	id := strconv.Itoa(note.NoteID)
+
+	//Analysing a note used to skip the access check
+	rec := apiRequest("GET", "/Notes/Analyse/"+id, stranger.UserID, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "private")
+
+	//Updating a note used to check whichever access row came last rather than the users own, and carry on after
+	//redirecting them
+	rec = apiRequest("GET", "/Notes/Update/"+id, viewer.UserID, nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "private")
+	rec = formRequest("/Notes/Update/"+id, stranger.UserID, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	saved, err := store.GetNote(note.NoteID)
+	assert.NoError(t, err)
+	assert.Equal(t, "private title", saved.Title)
+
+	rec = apiRequest("GET", "/api/v1/notes/"+id, stranger.UserID, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.Contains(t, rec.Body.String(), "note not found")
+	rec = apiRequest("GET", "/api/v1/notes/"+id+"/access", viewer.UserID, nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), "your role on this note does not let you")
+}
@@ -0,0 +1,157 @@
+package main
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sync"
+)
+
+//Keeps the files attached to notes. The database only holds each files details and the key it is saved under
+type BlobStore interface {
+	//Saves everything read from r under key, replacing anything already saved there
+	Put(key string, r io.Reader) error
+	//Opens the blob saved under key. Returns errNotFound if there is none
+	Open(key string) (io.ReadCloser, error)
+	//Deletes the blob saved under key. Deleting a blob that does not exist is not an error
+	Delete(key string) error
+}
+
+//The blob store the handlers use
+var blobs BlobStore
+
+//Blob keys are only ever made by newBlobKey, so anything else is refused rather than used as a file name
+var blobKeyPattern = regexp.MustCompile(`^[0-9a-f]{32}$`)
+
+//Makes a random key to save a new blob under
+func newBlobKey() (string, error) {
+	b := make([]byte, 16)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+//Opens the blob store that goes with the configured store. The demo store keeps attachments in memory too, so they
+//are lost with everything else when the server stops
+func openBlobStore(cfg Config) (BlobStore, error) {
+	if cfg.Store == "memory" {
+		return newMemBlobStore(), nil
+	}
+	return newFileBlobStore(cfg.AttachmentDir)
+}
+
+//Blob store that keeps each blob as a file in a directory on the local filesystem
+type fileBlobStore struct {
+	dir string
+}
+
+//Opens a blob store in dir, creating the directory if it is not there
+func newFileBlobStore(dir string) (*fileBlobStore, error) {
+	err := os.MkdirAll(dir, 0o750)
+	if err != nil {
+		return nil, fmt.Errorf("creating attachment directory: %v", err)
+	}
+	return &fileBlobStore{dir: dir}, nil
+}
+
+//Gets the file a key is saved in
+func (s *fileBlobStore) path(key string) (string, error) {
+	if !blobKeyPattern.MatchString(key) {
+		return "", fmt.Errorf("invalid blob key %q", key)
+	}
+	return filepath.Join(s.dir, key), nil
+}
+
+func (s *fileBlobStore) Put(key string, r io.Reader) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	//Writes to a temporary file first, so a failed upload never leaves half a file under the key
+	file, err := os.CreateTemp(s.dir, key+".*.tmp")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(file.Name())
+	_, err = io.Copy(file, r)
+	if closeErr := file.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return err
+	}
+	return os.Rename(file.Name(), path)
+}
+
+func (s *fileBlobStore) Open(key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, errNotFound
+	}
+	return file, err
+}
+
+func (s *fileBlobStore) Delete(key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	err = os.Remove(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil
+	}
+	return err
+}
+
+//Blob store that keeps everything in memory. Used for demos and tests
+type memBlobStore struct {
+	mu    sync.Mutex
+	blobs map[string][]byte
+}
+
+func newMemBlobStore() *memBlobStore {
+	return &memBlobStore{blobs: make(map[string][]byte)}
+}
+
+func (s *memBlobStore) Put(key string, r io.Reader) error {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return err
+	}
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.blobs[key] = data
+	return nil
+}
+
+func (s *memBlobStore) Open(key string) (io.ReadCloser, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	data, found := s.blobs[key]
+	if !found {
+		return nil, errNotFound
+	}
+	return io.NopCloser(bytes.NewReader(data)), nil
+}
+
+func (s *memBlobStore) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.blobs, key)
+	return nil
+}
@@ -0,0 +1,78 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBlobStores(t *testing.T) {
+	files, err := newFileBlobStore(filepath.Join(t.TempDir(), "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, s := range map[string]BlobStore{"file": files, "memory": newMemBlobStore()} {
+		key, err := newBlobKey()
+		assert.NoError(t, err)
+		assert.Regexp(t, blobKeyPattern, key)
+
+		_, err = s.Open(key)
+		assert.Equal(t, errNotFound, err, name)
+		assert.NoError(t, s.Put(key, strings.NewReader("first")), name)
+		assert.NoError(t, s.Put(key, strings.NewReader("second")), name)
+		file, err := s.Open(key)
+		if assert.NoError(t, err, name) {
+			data, err := io.ReadAll(file)
+			assert.NoError(t, err)
+			assert.Equal(t, "second", string(data), "%s: Put() should replace a blob", name)
+			file.Close()
+		}
+
+		assert.NoError(t, s.Delete(key), name)
+		_, err = s.Open(key)
+		assert.Equal(t, errNotFound, err, name)
+		assert.NoError(t, s.Delete(key), "%s: deleting a missing blob should not be an error", name)
+	}
+}
+
+func TestFileBlobStoreRejectsBadKeys(t *testing.T) {
+	dir := t.TempDir()
+	s, err := newFileBlobStore(filepath.Join(dir, "blobs"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, key := range []string{"", "../outside", "..", "/etc/passwd", "ABCDEF0123456789ABCDEF0123456789", "0123456789abcdef0123456789abcdef/x"} {
+		assert.Error(t, s.Put(key, strings.NewReader("data")), key)
+		_, err := s.Open(key)
+		assert.Error(t, err, key)
+		assert.Error(t, s.Delete(key), key)
+	}
+	_, err = os.Stat(filepath.Join(dir, "outside"))
+	assert.True(t, os.IsNotExist(err), "a bad key should never be written outside the blob directory")
+}
+
+func TestFileBlobStoreFailedPut(t *testing.T) {
+	dir := t.TempDir()
+	s, err := newFileBlobStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	key, err := newBlobKey()
+	assert.NoError(t, err)
+	err = s.Put(key, io.MultiReader(strings.NewReader("half"), failingReader{}))
+	assert.Error(t, err)
+	entries, err := os.ReadDir(dir)
+	assert.NoError(t, err)
+	assert.Empty(t, entries, "a failed Put() should not leave a file behind")
+}
+
+//Reader that always fails, like an upload that is cut off
+type failingReader struct{}
+
+func (failingReader) Read([]byte) (int, error) {
+	return 0, io.ErrUnexpectedEOF
+}
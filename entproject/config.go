@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+//Settings the server needs to start. Each one can come from a JSON config file, an environment variable or a
+//command-line flag, with flags overriding the environment and the environment overriding the file
+type Config struct {
+	DSN           string `json:"dsn"`
+	Addr          string `json:"addr"`
+	TLSCert       string `json:"tlsCert"`
+	TLSKey        string `json:"tlsKey"`
+	TemplateDir   string `json:"templateDir"`
+	SessionSecret string `json:"sessionSecret"`
+	LogLevel      string `json:"logLevel"`
+	Store         string `json:"store"`
+	AttachmentDir string `json:"attachmentDir"`
+	//How long deleted notes stay in the trash before they are purged, as a Go duration such as "720h"
+	TrashRetention string `json:"trashRetention"`
+	//Whether the session cookie is only sent over HTTPS: "true", "false", or "auto" to follow whether the server serves
+	//HTTPS itself. Set it to "true" when HTTPS ends at a proxy or load balancer in front of the server
+	SecureCookies string `json:"secureCookies"`
+}
+
+//The running servers configuration
+var config = defaultConfig()
+
+//Shortest session secret accepted, so session IDs can not be brute forced offline from a leaked table
+const minSessionSecretLength = 32
+
+//Configuration used when nothing else is given
+func defaultConfig() Config {
+	return Config{
+		Addr:        ":8080",
+		TemplateDir: "templates",
+		LogLevel:    "info",
+		Store:       "postgres",
+		//Relative to the directory the server is started in
+		AttachmentDir: "attachments",
+		//30 days
+		TrashRetention: "720h",
+		SecureCookies:  "auto",
+	}
+}
+
+//Describes one setting: its flag, its environment variable and where it lives in Config
+type configOption struct {
+	flag  string
+	env   string
+	usage string
+	field func(*Config) *string
+}
+
+var configOptions = []configOption{
+	{"dsn", "NOTEAPP_DSN", "Postgres connection string, e.g. \"user=postgres dbname=EnterpriseNoteApp sslmode=disable\"", func(c *Config) *string { return &c.DSN }},
+	{"addr", "NOTEAPP_ADDR", "address to listen on", func(c *Config) *string { return &c.Addr }},
+	{"tls-cert", "NOTEAPP_TLS_CERT", "TLS certificate file, serves HTTPS when set with -tls-key", func(c *Config) *string { return &c.TLSCert }},
+	{"tls-key", "NOTEAPP_TLS_KEY", "TLS private key file, serves HTTPS when set with -tls-cert", func(c *Config) *string { return &c.TLSKey }},
+	{"template-dir", "NOTEAPP_TEMPLATE_DIR", "directory holding the HTML templates", func(c *Config) *string { return &c.TemplateDir }},
+	{"session-secret", "NOTEAPP_SESSION_SECRET", fmt.Sprintf("secret used to sign session IDs, at least %d characters", minSessionSecretLength), func(c *Config) *string { return &c.SessionSecret }},
+	{"log-level", "NOTEAPP_LOG_LEVEL", "one of debug, info, warn or error", func(c *Config) *string { return &c.LogLevel }},
+	{"store", "NOTEAPP_STORE", "postgres, or memory to run a demo with sample data that is lost when the server stops", func(c *Config) *string { return &c.Store }},
+	{"attachment-dir", "NOTEAPP_ATTACHMENT_DIR", "directory files attached to notes are saved in, created if it does not exist", func(c *Config) *string { return &c.AttachmentDir }},
+	{"trash-retention", "NOTEAPP_TRASH_RETENTION", "how long deleted notes stay in the trash before they are purged, e.g. 720h for 30 days", func(c *Config) *string { return &c.TrashRetention }},
+	{"secure-cookies", "NOTEAPP_SECURE_COOKIES", "true to only send the session cookie over HTTPS, false, or auto to do so when serving HTTPS; use true behind a proxy that ends HTTPS", func(c *Config) *string { return &c.SecureCookies }},
+}
+
+//Builds the configuration from the config file, environment and command-line arguments, then validates it
+func loadConfig(args []string, getenv func(string) string, output io.Writer) (Config, error) {
+	cfg, _, err := parseConfig(args, getenv, output)
+	if err != nil {
+		return cfg, err
+	}
+	return cfg, cfg.validate()
+}
+
+//Builds the configuration without validating it. Also returns the arguments left after the flags
+func parseConfig(args []string, getenv func(string) string, output io.Writer) (Config, []string, error) {
+	cfg := defaultConfig()
+
+	flags := flag.NewFlagSet("entproject", flag.ContinueOnError)
+	flags.SetOutput(output)
+	configFile := flags.String("config", getenv("NOTEAPP_CONFIG"), "JSON config file (env NOTEAPP_CONFIG)")
+	flagValues := make(map[string]*string)
+	for _, option := range configOptions {
+		flagValues[option.flag] = flags.String(option.flag, "", option.usage+" (env "+option.env+")")
+	}
+	if err := flags.Parse(args); err != nil {
+		return cfg, nil, err
+	}
+
+	//Config file
+	if *configFile != "" {
+		contents, err := os.ReadFile(*configFile)
+		if err != nil {
+			return cfg, nil, fmt.Errorf("reading config file: %v", err)
+		}
+		decoder := json.NewDecoder(bytes.NewReader(contents))
+		decoder.DisallowUnknownFields()
+		if err := decoder.Decode(&cfg); err != nil {
+			return cfg, nil, fmt.Errorf("parsing config file %s: %v", *configFile, err)
+		}
+	}
+
+	//Environment variables
+	for _, option := range configOptions {
+		if value := getenv(option.env); value != "" {
+			*option.field(&cfg) = value
+		}
+	}
+
+	//Flags that were given on the command line
+	flags.Visit(func(f *flag.Flag) {
+		for _, option := range configOptions {
+			if option.flag == f.Name {
+				*option.field(&cfg) = *flagValues[f.Name]
+			}
+		}
+	})
+
+	return cfg, flags.Args(), nil
+}
+
+//Checks every setting and reports all the problems at once
+func (c Config) validate() error {
+	var problems []string
+
+	if c.Store != "postgres" && c.Store != "memory" {
+		problems = append(problems, fmt.Sprintf("store %q is not one of postgres or memory", c.Store))
+	}
+	//The demo store does not need a database
+	if c.DSN == "" && c.Store == "postgres" {
+		problems = append(problems, "database connection string is missing (set -dsn or NOTEAPP_DSN)")
+	}
+	//The demo store keeps attachments in memory
+	if c.AttachmentDir == "" && c.Store == "postgres" {
+		problems = append(problems, "attachment directory is missing (set -attachment-dir or NOTEAPP_ATTACHMENT_DIR)")
+	}
+	if c.Addr == "" {
+		problems = append(problems, "listen address is missing (set -addr or NOTEAPP_ADDR)")
+	}
+	if (c.TLSCert == "") != (c.TLSKey == "") {
+		problems = append(problems, "TLS needs both a certificate and a key (set -tls-cert and -tls-key)")
+	}
+	for _, file := range []string{c.TLSCert, c.TLSKey} {
+		if file == "" {
+			continue
+		}
+		if _, err := os.Stat(file); err != nil {
+			problems = append(problems, fmt.Sprintf("TLS file %s can not be read: %v", file, err))
+		}
+	}
+	if info, err := os.Stat(c.TemplateDir); err != nil || !info.IsDir() {
+		problems = append(problems, fmt.Sprintf("template directory %q does not exist (set -template-dir or NOTEAPP_TEMPLATE_DIR)", c.TemplateDir))
+	}
+	if len(c.SessionSecret) < minSessionSecretLength {
+		problems = append(problems, fmt.Sprintf("session secret must be at least %d characters (set -session-secret or NOTEAPP_SESSION_SECRET)", minSessionSecretLength))
+	}
+	if retention, err := time.ParseDuration(c.TrashRetention); err != nil || retention <= 0 {
+		problems = append(problems, fmt.Sprintf("trash retention %q is not a positive duration such as 720h (set -trash-retention or NOTEAPP_TRASH_RETENTION)", c.TrashRetention))
+	}
+	if c.SecureCookies != "auto" && c.SecureCookies != "true" && c.SecureCookies != "false" {
+		problems = append(problems, fmt.Sprintf("secure cookies %q is not one of auto, true or false (set -secure-cookies or NOTEAPP_SECURE_COOKIES)", c.SecureCookies))
+	}
+	if _, ok := parseLogLevel(c.LogLevel); !ok {
+		problems = append(problems, fmt.Sprintf("log level %q is not one of debug, info, warn or error", c.LogLevel))
+	}
+
+	if len(problems) > 0 {
+		return errors.New("invalid configuration:\n  " + strings.Join(problems, "\n  "))
+	}
+	return nil
+}
+
+//Whether the server should serve HTTPS
+func (c Config) useTLS() bool {
+	return c.TLSCert != "" && c.TLSKey != ""
+}
+
+//Whether the session cookie should only be sent over HTTPS. Requests can not be relied on to say, since HTTPS may
+//end at a proxy in front of the server
+func (c Config) secureCookies() bool {
+	if c.SecureCookies == "auto" {
+		return c.useTLS()
+	}
+	return c.SecureCookies == "true"
+}
+
+//How long deleted notes stay in the trash. Only call this on a config that has been validated
+func (c Config) trashRetention() time.Duration {
+	retention, _ := time.ParseDuration(c.TrashRetention)
+	return retention
+}
+
+//Severity of a log message
+type logLevel int
+
+const (
+	levelDebug logLevel = iota
+	levelInfo
+	levelWarn
+	levelError
+)
+
+//Messages below this level are not logged
+var currentLogLevel = levelInfo
+
+//Converts a log level name from the config into a logLevel
+func parseLogLevel(name string) (logLevel, bool) {
+	switch strings.ToLower(name) {
+	case "debug":
+		return levelDebug, true
+	case "info":
+		return levelInfo, true
+	case "warn", "warning":
+		return levelWarn, true
+	case "error":
+		return levelError, true
+	}
+	return levelInfo, false
+}
+
+//Logs a message if its level is at or above the configured log level
+func logAt(level logLevel, prefix string, format string, args ...interface{}) {
+	if level < currentLogLevel {
+		return
+	}
+	log.Printf(prefix+format, args...)
+}
+
+func logDebug(format string, args ...interface{}) { logAt(levelDebug, "DEBUG ", format, args...) }
+func logInfo(format string, args ...interface{})  { logAt(levelInfo, "INFO ", format, args...) }
+func logWarn(format string, args ...interface{})  { logAt(levelWarn, "WARN ", format, args...) }
+func logError(format string, args ...interface{}) { logAt(levelError, "ERROR ", format, args...) }
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+const testSecret = "0123456789abcdef0123456789abcdef"
+
+//Builds a getenv function from a map
+func fakeEnv(env map[string]string) func(string) string {
+	return func(key string) string {
+		return env[key]
+	}
+}
+
+func TestLoadConfigDefaults(t *testing.T) {
+	cfg, err := loadConfig([]string{"-dsn", "dbname=test", "-session-secret", testSecret}, fakeEnv(nil), io.Discard)
+
+	assert.NoError(t, err)
+	assert.Equal(t, ":8080", cfg.Addr)
+	assert.Equal(t, "templates", cfg.TemplateDir)
+	assert.Equal(t, "attachments", cfg.AttachmentDir)
+	assert.Equal(t, 30*24*time.Hour, cfg.trashRetention())
+	assert.Equal(t, "info", cfg.LogLevel)
+	assert.Equal(t, "postgres", cfg.Store)
+	assert.False(t, cfg.useTLS())
+	assert.False(t, cfg.secureCookies())
+}
+
+func TestLoadConfigDemoStore(t *testing.T) {
+	//The in-memory demo store does not need a database connection string
+	cfg, err := loadConfig([]string{"-store", "memory", "-session-secret", testSecret}, fakeEnv(nil), io.Discard)
+	assert.NoError(t, err)
+	assert.Equal(t, "memory", cfg.Store)
+
+	_, err = loadConfig([]string{"-store", "sqlite", "-session-secret", testSecret}, fakeEnv(nil), io.Discard)
+	if assert.Error(t, err) {
+		assert.True(t, strings.Contains(err.Error(), "store"))
+	}
+}
+
+func TestLoadConfigPrecedence(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(file, []byte(`{"dsn": "dbname=file", "addr": ":1111", "sessionSecret": "`+testSecret+`", "logLevel": "debug"}`), 0600)
+	assert.NoError(t, err)
+
+	env := fakeEnv(map[string]string{
+		"NOTEAPP_CONFIG": file,
+		"NOTEAPP_ADDR":   ":2222",
+		"NOTEAPP_DSN":    "dbname=env",
+	})
+	cfg, err := loadConfig([]string{"-addr", ":3333"}, env, io.Discard)
+
+	assert.NoError(t, err)
+	assert.Equal(t, ":3333", cfg.Addr, "flags should override the environment")
+	assert.Equal(t, "dbname=env", cfg.DSN, "the environment should override the config file")
+	assert.Equal(t, "debug", cfg.LogLevel, "the config file should override the defaults")
+	assert.Equal(t, testSecret, cfg.SessionSecret)
+}
+
+func TestLoadConfigMissingSettings(t *testing.T) {
+	_, err := loadConfig(nil, fakeEnv(nil), io.Discard)
+
+	if assert.Error(t, err) {
+		assert.True(t, strings.Contains(err.Error(), "database connection string is missing"))
+		assert.True(t, strings.Contains(err.Error(), "session secret"))
+	}
+}
+
+func TestLoadConfigInvalidSettings(t *testing.T) {
+	args := []string{
+		"-dsn", "dbname=test",
+		"-session-secret", "short",
+		"-tls-cert", "cert.pem",
+		"-template-dir", filepath.Join(t.TempDir(), "missing"),
+		"-log-level", "loud",
+		"-trash-retention", "30 days",
+		"-secure-cookies", "yes",
+	}
+	_, err := loadConfig(args, fakeEnv(nil), io.Discard)
+
+	if assert.Error(t, err) {
+		assert.True(t, strings.Contains(err.Error(), "session secret"))
+		assert.True(t, strings.Contains(err.Error(), "both a certificate and a key"))
+		assert.True(t, strings.Contains(err.Error(), "template directory"))
+		assert.True(t, strings.Contains(err.Error(), "log level"))
+		assert.True(t, strings.Contains(err.Error(), "trash retention"))
+		assert.True(t, strings.Contains(err.Error(), "secure cookies"))
+	}
+}
+
+func TestLoadConfigBadFile(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "config.json")
+	err := os.WriteFile(file, []byte(`{"port": 8080}`), 0600)
+	assert.NoError(t, err)
+
+	_, err = loadConfig([]string{"-config", file}, fakeEnv(nil), io.Discard)
+	assert.Error(t, err, "unknown keys in the config file should be rejected")
+}
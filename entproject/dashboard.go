@@ -0,0 +1,166 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//Weeks shown when no weeks value is given, and the most that can be asked for
+const (
+	defaultDashboardWeeks = 12
+	maxDashboardWeeks     = 104
+)
+
+//Notes created and updated in the week starting on Week, a Monday
+type weekCount struct {
+	Week    string `json:"week"`
+	Created int    `json:"created"`
+	Updated int    `json:"updated"`
+}
+
+//A note and how many users it has been shared with
+type noteCollaborators struct {
+	NoteID        int    `json:"noteID"`
+	Title         string `json:"title"`
+	Collaborators int    `json:"collaborators"`
+}
+
+//A note and how long it is
+type noteSize struct {
+	NoteID     int    `json:"noteID"`
+	Title      string `json:"title"`
+	Words      int    `json:"words"`
+	Characters int    `json:"characters"`
+}
+
+//Statistics across every note a user can read
+type dashboard struct {
+	Notes  int `json:"notes"`
+	Owned  int `json:"owned"`
+	Shared int `json:"shared"`
+	//Oldest week first, ending with the current week
+	Weeks      []weekCount         `json:"weeks"`
+	TopWords   []wordCount         `json:"topWords"`
+	MostShared []noteCollaborators `json:"mostShared"`
+	Largest    []noteSize          `json:"largest"`
+}
+
+//Gets the Monday of the week a time falls in, where the server is, the same way search filters count days
+func weekStart(t time.Time) time.Time {
+	t = t.In(time.Local)
+	day := time.Date(t.Year(), t.Month(), t.Day(), 0, 0, 0, 0, time.Local)
+	//Weekday counts from Sunday, weeks start on Monday
+	return day.AddDate(0, 0, -(int(day.Weekday())+6)%7)
+}
+
+//Works out the dashboard for a user from the notes they can read, counting weeks back from now and keeping the top
+//entries of each list
+func buildDashboard(userID int, now time.Time, weeks int, top int) (dashboard, error) {
+	notes, err := store.GetUserNotes(userID)
+	if err != nil {
+		return dashboard{}, err
+	}
+	noteIDs := make([]int, len(notes))
+	for i, note := range notes {
+		noteIDs[i] = note.NoteID
+	}
+	counts, err := store.CountAccess(noteIDs)
+	if err != nil {
+		return dashboard{}, err
+	}
+
+	result := dashboard{Notes: len(notes), MostShared: []noteCollaborators{}, Largest: []noteSize{}}
+
+	//One entry for every week, so weeks without changes show as 0 rather than being left out
+	first := weekStart(now).AddDate(0, 0, -7*(weeks-1))
+	week := make(map[string]int)
+	for i := 0; i < weeks; i++ {
+		day := first.AddDate(0, 0, 7*i).Format(searchDateLayout)
+		week[day] = i
+		result.Weeks = append(result.Weeks, weekCount{Week: day})
+	}
+
+	var contents []string
+	for _, note := range notes {
+		if note.UserID == userID {
+			result.Owned++
+		} else {
+			result.Shared++
+		}
+		if i, ok := week[weekStart(note.DateCreated).Format(searchDateLayout)]; ok {
+			result.Weeks[i].Created++
+		}
+		if i, ok := week[weekStart(note.DateUpdated).Format(searchDateLayout)]; ok {
+			result.Weeks[i].Updated++
+		}
+		if counts[note.NoteID] > 0 {
+			result.MostShared = append(result.MostShared, noteCollaborators{note.NoteID, note.Title, counts[note.NoteID]})
+		}
+		words := len(searchWords(note.Contents))
+		result.Largest = append(result.Largest, noteSize{note.NoteID, note.Title, words, len([]rune(note.Contents))})
+		contents = append(contents, note.Contents)
+	}
+
+	result.TopWords = topWords(searchWords(strings.Join(contents, "\n")), top)
+	sort.SliceStable(result.MostShared, func(i, j int) bool {
+		return result.MostShared[i].Collaborators > result.MostShared[j].Collaborators
+	})
+	if len(result.MostShared) > top {
+		result.MostShared = result.MostShared[:top]
+	}
+	sort.SliceStable(result.Largest, func(i, j int) bool {
+		return result.Largest[i].Characters > result.Largest[j].Characters
+	})
+	if len(result.Largest) > top {
+		result.Largest = result.Largest[:top]
+	}
+	return result, nil
+}
+
+//Reads the weeks value from a request, defaulting to defaultDashboardWeeks
+func parseWeeks(value string) (int, error) {
+	if value == "" {
+		return defaultDashboardWeeks, nil
+	}
+	weeks, err := strconv.Atoi(value)
+	if err != nil || weeks < 1 || weeks > maxDashboardWeeks {
+		return 0, badRequest("weeks should be a number from 1 to " + strconv.Itoa(maxDashboardWeeks))
+	}
+	return weeks, nil
+}
+
+//Builds the dashboard from the weeks and top values of a request
+func requestDashboard(r *http.Request, userID int) (dashboard, error) {
+	weeks, err := parseWeeks(r.FormValue("weeks"))
+	if err != nil {
+		return dashboard{}, err
+	}
+	top, err := parseTop(r.FormValue("top"))
+	if err != nil {
+		return dashboard{}, err
+	}
+	return buildDashboard(userID, time.Now(), weeks, top)
+}
+
+//Shows statistics across every note the logged in user can read
+func userDashboard(w http.ResponseWriter, r *http.Request) error {
+	//Checks if a user is already logged in
+	session, err := requireSession(w, r)
+	if session == nil {
+		return err
+	}
+	result, err := requestDashboard(r, session.UserID)
+	if err != nil {
+		return err
+	}
+
+	//Dashboard template
+	t, err := parseTemplate("dashboard.html")
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, result)
+}
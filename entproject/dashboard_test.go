@@ -0,0 +1,80 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWeekStart(t *testing.T) {
+	monday := time.Date(2024, 5, 6, 0, 0, 0, 0, time.Local)
+	assert.Equal(t, monday, weekStart(monday))
+	assert.Equal(t, monday, weekStart(time.Date(2024, 5, 8, 15, 4, 5, 0, time.Local)))
+	assert.Equal(t, monday, weekStart(time.Date(2024, 5, 12, 23, 59, 0, 0, time.Local)), "Sunday should be the end of the week")
+}
+
+func TestBuildDashboard(t *testing.T) {
+	owner, err := registerUser("Dashboard", "Owner", "password")
+	assert.NoError(t, err)
+	friend, err := registerUser("Dashboard", "Friend", "password")
+	assert.NoError(t, err)
+	other, err := registerUser("Dashboard", "Other", "password")
+	assert.NoError(t, err)
+
+	now := time.Date(2024, 5, 8, 12, 0, 0, 0, time.UTC)
+	lastWeek := now.AddDate(0, 0, -7)
+	small, err := store.CreateNote(Note{UserID: owner.UserID, Title: "small", Contents: "otter", DateCreated: lastWeek, DateUpdated: now})
+	assert.NoError(t, err)
+	large, err := store.CreateNote(Note{UserID: friend.UserID, Title: "large", Contents: "otter otter and a long tail", DateCreated: now, DateUpdated: now})
+	assert.NoError(t, err)
+	_, err = store.CreateNote(Note{UserID: owner.UserID, Title: "old", Contents: "", DateCreated: now.AddDate(-1, 0, 0), DateUpdated: now.AddDate(-1, 0, 0)})
+	assert.NoError(t, err)
+	_, err = store.CreateNote(Note{UserID: other.UserID, Title: "private", Contents: "badger badger badger", DateCreated: now, DateUpdated: now})
+	assert.NoError(t, err)
+	for _, userID := range []int{owner.UserID, other.UserID} {
+		_, err = store.AddAccess(NoteAccess{NoteID: large.NoteID, UserID: userID, Role: roleViewer})
+		assert.NoError(t, err)
+	}
+	_, err = store.AddAccess(NoteAccess{NoteID: small.NoteID, UserID: friend.UserID, Role: roleViewer})
+	assert.NoError(t, err)
+
+	result, err := buildDashboard(owner.UserID, now, 2, 2)
+	assert.NoError(t, err)
+	assert.Equal(t, 3, result.Notes)
+	assert.Equal(t, 2, result.Owned)
+	assert.Equal(t, 1, result.Shared)
+	assert.Equal(t, []weekCount{{"2024-04-29", 1, 0}, {"2024-05-06", 1, 2}}, result.Weeks)
+	assert.Equal(t, []wordCount{{"otter", 3}, {"long", 1}}, result.TopWords, "notes that have not been shared should not be counted")
+	assert.Equal(t, []noteCollaborators{{large.NoteID, "large", 2}, {small.NoteID, "small", 1}}, result.MostShared)
+	if assert.Len(t, result.Largest, 2) {
+		assert.Equal(t, noteSize{large.NoteID, "large", 6, 27}, result.Largest[0])
+		assert.Equal(t, small.NoteID, result.Largest[1].NoteID)
+	}
+}
+
+func TestDashboardPages(t *testing.T) {
+	owner, err := registerUser("Dashboard Page", "Owner", "password")
+	assert.NoError(t, err)
+	_, err = saveNewNote(owner.UserID, "<i>title</i>", "wombat", "")
+	assert.NoError(t, err)
+
+	rec := apiRequest("GET", "/Users/Dashboard", owner.UserID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "wombat")
+	assert.Contains(t, rec.Body.String(), "&lt;i&gt;title&lt;/i&gt;")
+	rec = apiRequest("GET", "/Users/Dashboard?weeks=0", owner.UserID, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = apiRequest("GET", "/api/v1/dashboard?weeks=4", owner.UserID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var result dashboard
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &result))
+	assert.Equal(t, 1, result.Notes)
+	assert.Len(t, result.Weeks, 4)
+	assert.Equal(t, 1, result.Weeks[3].Created, "the note should be counted in the current week")
+	rec = apiRequest("GET", "/api/v1/dashboard?top=x", owner.UserID, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
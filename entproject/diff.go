@@ -0,0 +1,223 @@
+package main
+
+import (
+	"strings"
+	"unicode"
+)
+
+//What happened to a piece of text between two versions
+type diffKind string
+
+const (
+	diffEqual  diffKind = "equal"
+	diffInsert diffKind = "insert"
+	diffDelete diffKind = "delete"
+)
+
+//A run of text that was kept, added or removed
+type diffOp struct {
+	Kind diffKind `json:"kind"`
+	Text string   `json:"text"`
+}
+
+//Compares two texts line by line
+func diffLines(a string, b string) []diffOp {
+	return diffTokens(splitLines(a), splitLines(b))
+}
+
+//Compares two texts word by word. Whitespace is kept so the ops join back into the original texts
+func diffWords(a string, b string) []diffOp {
+	return diffTokens(splitWords(a), splitWords(b))
+}
+
+//Splits text into lines, each keeping its newline. Browsers send \r\n from text areas so that is treated as \n
+func splitLines(s string) []string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	lines := strings.SplitAfter(s, "\n")
+	if lines[len(lines)-1] == "" {
+		lines = lines[:len(lines)-1]
+	}
+	return lines
+}
+
+//Splits text into alternating runs of whitespace and non-whitespace
+func splitWords(s string) []string {
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	var words []string
+	start := 0
+	inSpace := false
+	for i, c := range s {
+		space := unicode.IsSpace(c)
+		if i > start && space != inSpace {
+			words = append(words, s[start:i])
+			start = i
+		}
+		inSpace = space
+	}
+	if start < len(s) {
+		words = append(words, s[start:])
+	}
+	return words
+}
+
+//Finds the shortest set of inserts and deletes that turns a into b, using Myers' algorithm. Matching tokens at the
+//start and end are skipped first, which keeps small edits to large notes cheap
+func diffTokens(a []string, b []string) []diffOp {
+	prefix := 0
+	for prefix < len(a) && prefix < len(b) && a[prefix] == b[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(a)-prefix && suffix < len(b)-prefix && a[len(a)-1-suffix] == b[len(b)-1-suffix] {
+		suffix++
+	}
+
+	var ops []diffOp
+	for _, token := range a[:prefix] {
+		ops = appendOp(ops, diffEqual, token)
+	}
+	ops = append(ops, myers(a[prefix:len(a)-suffix], b[prefix:len(b)-suffix])...)
+	for _, token := range a[len(a)-suffix:] {
+		ops = appendOp(ops, diffEqual, token)
+	}
+	return mergeOps(ops)
+}
+
+//Most inserts and deletes myers looks for before giving up. Its trace grows with the square of the number of edits,
+//so without a cap two very different large notes could use gigabytes. This many keeps the trace to a few megabytes
+const maxDiffEdits = 1000
+
+//Myers' O(ND) diff. v[k] is the furthest x reached on diagonal k = x - y, and trace keeps v from before each step
+//so the path can be walked back from the end. Texts needing more than maxDiffEdits changes are shown as all of a
+//deleted and all of b inserted
+func myers(a []string, b []string) []diffOp {
+	n, m := len(a), len(b)
+	total := n + m
+	if total == 0 {
+		return nil
+	}
+	offset := total + 1
+	v := make([]int, 2*total+3)
+	var trace [][]int
+
+	for d := 0; d <= total; d++ {
+		if d > maxDiffEdits {
+			return replaceAll(a, b)
+		}
+		//Only diagonals -d to d can be reached in d steps, so only those are kept
+		trace = append(trace, append([]int(nil), v[offset-d:offset+d+1]...))
+		for k := -d; k <= d; k += 2 {
+			var x int
+			if k == -d || (k != d && v[offset+k-1] < v[offset+k+1]) {
+				//Move down, inserting b[y]
+				x = v[offset+k+1]
+			} else {
+				//Move right, deleting a[x]
+				x = v[offset+k-1] + 1
+			}
+			y := x - k
+			for x < n && y < m && a[x] == b[y] {
+				x++
+				y++
+			}
+			v[offset+k] = x
+			if x >= n && y >= m {
+				return backtrack(trace, a, b)
+			}
+		}
+	}
+	return nil
+}
+
+//Walks the Myers trace back from the end of both texts, building the ops in reverse
+func backtrack(trace [][]int, a []string, b []string) []diffOp {
+	x, y := len(a), len(b)
+	var reversed []diffOp
+
+	for d := len(trace) - 1; d >= 0; d-- {
+		//trace[d] holds diagonals -d to d
+		v := func(k int) int { return trace[d][k+d] }
+		k := x - y
+		var prevK int
+		if k == -d || (k != d && v(k-1) < v(k+1)) {
+			prevK = k + 1
+		} else {
+			prevK = k - 1
+		}
+		prevX := 0
+		if d > 0 {
+			prevX = v(prevK)
+		}
+		prevY := prevX - prevK
+
+		for x > prevX && y > prevY {
+			x--
+			y--
+			reversed = append(reversed, diffOp{Kind: diffEqual, Text: a[x]})
+		}
+		if d > 0 {
+			if x == prevX {
+				y--
+				reversed = append(reversed, diffOp{Kind: diffInsert, Text: b[y]})
+			} else {
+				x--
+				reversed = append(reversed, diffOp{Kind: diffDelete, Text: a[x]})
+			}
+		}
+	}
+
+	ops := make([]diffOp, 0, len(reversed))
+	for i := len(reversed) - 1; i >= 0; i-- {
+		ops = append(ops, reversed[i])
+	}
+	return ops
+}
+
+//Deletes every token of a and inserts every token of b
+func replaceAll(a []string, b []string) []diffOp {
+	var ops []diffOp
+	if len(a) > 0 {
+		ops = append(ops, diffOp{Kind: diffDelete, Text: strings.Join(a, "")})
+	}
+	if len(b) > 0 {
+		ops = append(ops, diffOp{Kind: diffInsert, Text: strings.Join(b, "")})
+	}
+	return ops
+}
+
+//Adds an op, joining it onto the previous one if they are the same kind
+func appendOp(ops []diffOp, kind diffKind, text string) []diffOp {
+	if len(ops) > 0 && ops[len(ops)-1].Kind == kind {
+		ops[len(ops)-1].Text += text
+		return ops
+	}
+	return append(ops, diffOp{Kind: kind, Text: text})
+}
+
+//Joins neighbouring ops of the same kind, and puts deletes before inserts where they touch
+func mergeOps(ops []diffOp) []diffOp {
+	var merged []diffOp
+	for i := 0; i < len(ops); {
+		//Collect a run of changes so its deletes and inserts can be grouped
+		if ops[i].Kind == diffEqual {
+			merged = appendOp(merged, diffEqual, ops[i].Text)
+			i++
+			continue
+		}
+		var deleted, inserted strings.Builder
+		for ; i < len(ops) && ops[i].Kind != diffEqual; i++ {
+			if ops[i].Kind == diffDelete {
+				deleted.WriteString(ops[i].Text)
+			} else {
+				inserted.WriteString(ops[i].Text)
+			}
+		}
+		if deleted.Len() > 0 {
+			merged = appendOp(merged, diffDelete, deleted.String())
+		}
+		if inserted.Len() > 0 {
+			merged = appendOp(merged, diffInsert, inserted.String())
+		}
+	}
+	return merged
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"math/rand"
+	"runtime"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//Rebuilds the old and new texts from a diff
+func applyDiff(ops []diffOp) (string, string) {
+	var a, b strings.Builder
+	for _, op := range ops {
+		if op.Kind != diffInsert {
+			a.WriteString(op.Text)
+		}
+		if op.Kind != diffDelete {
+			b.WriteString(op.Text)
+		}
+	}
+	return a.String(), b.String()
+}
+
+func TestDiffLines(t *testing.T) {
+	ops := diffLines("one\ntwo\nthree\n", "one\n2\nthree\nfour\n")
+	assert.Equal(t, []diffOp{
+		{diffEqual, "one\n"},
+		{diffDelete, "two\n"},
+		{diffInsert, "2\n"},
+		{diffEqual, "three\n"},
+		{diffInsert, "four\n"},
+	}, ops)
+
+	assert.Equal(t, []diffOp{{diffEqual, "same\n"}}, diffLines("same\n", "same\n"))
+	assert.Empty(t, diffLines("", ""))
+	assert.Equal(t, []diffOp{{diffInsert, "new"}}, diffLines("", "new"))
+	assert.Equal(t, []diffOp{{diffDelete, "old"}}, diffLines("old", ""))
+}
+
+func TestDiffLinesIgnoresLineEndings(t *testing.T) {
+	//Text areas send \r\n, so a note saved from the browser matches one saved through the API
+	assert.Equal(t, []diffOp{{diffEqual, "a\nb\n"}}, diffLines("a\r\nb\r\n", "a\nb\n"))
+}
+
+func TestDiffWords(t *testing.T) {
+	ops := diffWords("the quick brown fox", "the slow brown fox jumps")
+	assert.Equal(t, []diffOp{
+		{diffEqual, "the "},
+		{diffDelete, "quick"},
+		{diffInsert, "slow"},
+		{diffEqual, " brown fox"},
+		{diffInsert, " jumps"},
+	}, ops)
+}
+
+func TestSplitWords(t *testing.T) {
+	assert.Equal(t, []string{"hello", " ", "world", "\n\n", "é"}, splitWords("hello world\n\né"))
+	assert.Equal(t, []string{"  ", "x"}, splitWords("  x"))
+	assert.Empty(t, splitWords(""))
+}
+
+func TestDiffRebuildsBothTexts(t *testing.T) {
+	//Random edits of a small vocabulary give lots of repeated tokens, which is where diffs tend to go wrong
+	words := []string{"a", "b", "c", "note", "\n", " "}
+	random := rand.New(rand.NewSource(1))
+	randomText := func() string {
+		var text strings.Builder
+		for i := random.Intn(40); i > 0; i-- {
+			text.WriteString(words[random.Intn(len(words))])
+		}
+		return text.String()
+	}
+
+	for i := 0; i < 500; i++ {
+		a, b := randomText(), randomText()
+		for _, ops := range [][]diffOp{diffLines(a, b), diffWords(a, b)} {
+			gotA, gotB := applyDiff(ops)
+			assert.Equal(t, a, gotA)
+			assert.Equal(t, b, gotB)
+			for j := 1; j < len(ops); j++ {
+				assert.NotEqual(t, ops[j-1].Kind, ops[j].Kind, "neighbouring ops should be merged")
+			}
+		}
+	}
+}
+
+func TestDiffIsMinimal(t *testing.T) {
+	//Only the changed line is reported, even though it appears elsewhere in the note
+	ops := diffLines("x\ny\nx\ny\n", "x\ny\ny\n")
+	deleted := 0
+	for _, op := range ops {
+		if op.Kind == diffDelete {
+			deleted += strings.Count(op.Text, "\n")
+		}
+		assert.NotEqual(t, diffInsert, op.Kind)
+	}
+	assert.Equal(t, 1, deleted)
+}
+
+func TestDiffLargeNotes(t *testing.T) {
+	//Two notes of the largest size allowed with nothing in common. Each line is 6 characters
+	var a, b strings.Builder
+	for i := 0; i < maxNoteContentsLength/6; i++ {
+		fmt.Fprintf(&a, "a%04d\n", i%10000)
+		fmt.Fprintf(&b, "b%04d\n", i%10000)
+	}
+	var before, after runtime.MemStats
+	runtime.GC()
+	runtime.ReadMemStats(&before)
+	for _, ops := range [][]diffOp{diffLines(a.String(), b.String()), diffWords(a.String(), b.String())} {
+		gotA, gotB := applyDiff(ops)
+		assert.Equal(t, a.String(), gotA)
+		assert.Equal(t, b.String(), gotB)
+	}
+	runtime.ReadMemStats(&after)
+	assert.Less(t, after.TotalAlloc-before.TotalAlloc, uint64(200<<20), "diffing large notes should not use more than a few hundred megabytes")
+
+	//Scattered changes under the cap still get the smallest diff
+	lines := strings.SplitAfter(a.String(), "\n")
+	for i := 0; i < len(lines); i += 100 {
+		lines[i] = "changed\n"
+	}
+	deleted := 0
+	for _, op := range diffLines(a.String(), strings.Join(lines, "")) {
+		if op.Kind == diffDelete {
+			deleted += strings.Count(op.Text, "\n")
+		}
+	}
+	assert.Equal(t, (len(lines)+99)/100, deleted)
+}
@@ -0,0 +1,168 @@
+package main
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"runtime/debug"
+	"strings"
+)
+
+//Returned by the store when the row asked for does not exist
+var errNotFound = errors.New("not found")
+
+//Returned by the store when a note being saved has been changed by someone else since it was loaded
+var errConflict = errors.New("conflict")
+
+//An error with the HTTP status and message to show the user. Err holds the underlying cause, which is logged but
+//never shown
+type appError struct {
+	Code    int
+	Message string
+	Err     error
+}
+
+func (e *appError) Error() string {
+	if e.Err != nil {
+		return fmt.Sprintf("%d %s: %v", e.Code, e.Message, e.Err)
+	}
+	return fmt.Sprintf("%d %s", e.Code, e.Message)
+}
+
+func (e *appError) Unwrap() error {
+	return e.Err
+}
+
+//400 error for input the user can fix
+func badRequest(message string) *appError {
+	return &appError{Code: http.StatusBadRequest, Message: message}
+}
+
+//403 error for something the user is not allowed to do
+func forbidden(message string) *appError {
+	return &appError{Code: http.StatusForbidden, Message: message}
+}
+
+//404 error for something that does not exist, or that the user is not allowed to know exists
+func notFound(message string) *appError {
+	return &appError{Code: http.StatusNotFound, Message: message}
+}
+
+//Converts any error into the status and message to show the user. Anything that is not an appError is a 500
+//and its details are kept out of the response
+func errorResponse(err error) (int, string) {
+	var appErr *appError
+	if errors.As(err, &appErr) {
+		return appErr.Code, appErr.Message
+	}
+	if errors.Is(err, errNotFound) {
+		return http.StatusNotFound, "Not found"
+	}
+	if errors.Is(err, errConflict) {
+		return http.StatusConflict, "Someone else changed this note at the same time. Reload it and try again."
+	}
+	return http.StatusInternalServerError, "Something went wrong on our side. Please try again."
+}
+
+//A HTML page handler that returns its errors to be shown on the error page instead of handling them itself
+type appHandler func(http.ResponseWriter, *http.Request) error
+
+func (fn appHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := fn(w, r); err != nil {
+		renderError(w, r, err)
+	}
+}
+
+//A JSON API handler that returns its errors to be written as a JSON error body
+type apiHandler func(http.ResponseWriter, *http.Request) error
+
+func (fn apiHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if err := fn(w, r); err != nil {
+		code, message := errorResponse(err)
+		logRequestError(r, code, err)
+		writeJSONError(w, code, message)
+	}
+}
+
+//Logs a failed request with enough context to find it again. Server errors are logged as errors, anything the
+//user caused is only logged at debug level
+func logRequestError(r *http.Request, code int, err error) {
+	if code >= 500 {
+		logError("request %s: %s %s from %s: %v", requestID(r), r.Method, r.URL.Path, r.RemoteAddr, err)
+	} else {
+		logDebug("request %s: %s %s from %s: %v", requestID(r), r.Method, r.URL.Path, r.RemoteAddr, err)
+	}
+}
+
+//Shows the error page with the status and message for err
+func renderError(w http.ResponseWriter, r *http.Request, err error) {
+	code, message := errorResponse(err)
+	logRequestError(r, code, err)
+
+	t, tmplErr := parseTemplate("error.html")
+	if tmplErr != nil {
+		logError("request %s: loading error page: %v", requestID(r), tmplErr)
+		http.Error(w, message, code)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(code)
+	tmplErr = t.Execute(w, struct {
+		Code      int
+		Status    string
+		Message   string
+		RequestID string
+	}{code, http.StatusText(code), message, requestID(r)})
+	if tmplErr != nil {
+		logError("request %s: rendering error page: %v", requestID(r), tmplErr)
+	}
+}
+
+//Key the request ID is stored under in the request context
+type requestIDKey struct{}
+
+//Gets the ID given to a request by withRequestID
+func requestID(r *http.Request) string {
+	id, _ := r.Context().Value(requestIDKey{}).(string)
+	return id
+}
+
+//Middleware giving every request a random ID, stored in the request context and sent back in the X-Request-ID
+//header, so a user reporting an error page can be matched to the log line
+func withRequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b := make([]byte, 8)
+		rand.Read(b)
+		id := hex.EncodeToString(b)
+		w.Header().Set("X-Request-ID", id)
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), requestIDKey{}, id)))
+	})
+}
+
+//Middleware turning a panic in any handler into a 500 response instead of a dropped connection
+func recoverPanics(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer func() {
+			recovered := recover()
+			if recovered == nil {
+				return
+			}
+			//ErrAbortHandler is how a handler deliberately aborts the response, so let net/http handle it
+			if recovered == http.ErrAbortHandler {
+				panic(recovered)
+			}
+			err := fmt.Errorf("panic: %v\n%s", recovered, debug.Stack())
+			if strings.HasPrefix(r.URL.Path, "/api/") {
+				code, message := errorResponse(err)
+				logRequestError(r, code, err)
+				writeJSONError(w, code, message)
+				return
+			}
+			renderError(w, r, err)
+		}()
+		next.ServeHTTP(w, r)
+	})
+}
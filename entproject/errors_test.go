@@ -0,0 +1,73 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestErrorResponse(t *testing.T) {
+	code, message := errorResponse(badRequest("bad id"))
+	assert.Equal(t, http.StatusBadRequest, code)
+	assert.Equal(t, "bad id", message)
+
+	code, _ = errorResponse(fmt.Errorf("loading note: %w", errNotFound))
+	assert.Equal(t, http.StatusNotFound, code)
+
+	//Unexpected errors must not leak their details to the user
+	code, message = errorResponse(errors.New("pq: password authentication failed"))
+	assert.Equal(t, http.StatusInternalServerError, code)
+	assert.NotContains(t, message, "pq")
+}
+
+func TestAppHandlerRendersErrorPage(t *testing.T) {
+	handler := withRequestID(appHandler(func(w http.ResponseWriter, r *http.Request) error {
+		return forbidden("not your note")
+	}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/Notes/Update/1", nil))
+
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	assert.Contains(t, rec.Body.String(), "not your note")
+	assert.Contains(t, rec.Body.String(), rec.Header().Get("X-Request-ID"), "error page should show the request ID")
+}
+
+func TestLogInWithInvalidID(t *testing.T) {
+	//A non-numeric id used to kill the whole server
+	req := httptest.NewRequest("POST", "/Users/LogIn", strings.NewReader("id=abc&password=password"))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	rec := httptest.NewRecorder()
+	newRouter().ServeHTTP(rec, req)
+
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
+
+func TestRecoverPanics(t *testing.T) {
+	panicking := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})
+	handler := recoverPanics(panicking)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/Users/Home", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "boom")
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("GET", "/api/v1/notes", nil))
+	assert.Equal(t, http.StatusInternalServerError, rec.Code)
+	assert.Equal(t, "application/json", rec.Header().Get("Content-Type"))
+}
+
+func TestUnknownPageHasRequestID(t *testing.T) {
+	rec := httptest.NewRecorder()
+	newRouter().ServeHTTP(rec, httptest.NewRequest("GET", "/Nothing/Here", nil))
+
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	assert.NotEmpty(t, rec.Header().Get("X-Request-ID"))
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+//A revision as shown on the history page
+type revisionRow struct {
+	NoteRevision
+	Author string
+	//The revision before this one, or 0 for the first revision
+	PreviousID int
+}
+
+//Two revisions of a note and the changes between them
+type revisionDiff struct {
+	From     NoteRevision `json:"from"`
+	To       NoteRevision `json:"to"`
+	Mode     string       `json:"mode"`
+	Title    []diffOp     `json:"title"`
+	Contents []diffOp     `json:"contents"`
+}
+
+//Picks the two revisions to compare from the from and to query values. to defaults to the newest revision and from
+//to the one before it. revisions must be newest first
+func pickRevisions(revisions []NoteRevision, fromValue string, toValue string) (int, int, error) {
+	if len(revisions) == 0 {
+		return 0, 0, errNotFound
+	}
+	to := revisions[0].RevisionID
+	if toValue != "" {
+		id, err := parseID(toValue)
+		if err != nil {
+			return 0, 0, badRequest("to should be a revision ID")
+		}
+		to = id
+	}
+	from := to
+	if fromValue != "" {
+		id, err := parseID(fromValue)
+		if err != nil {
+			return 0, 0, badRequest("from should be a revision ID")
+		}
+		from = id
+	} else {
+		for i, revision := range revisions {
+			if revision.RevisionID == to && i+1 < len(revisions) {
+				from = revisions[i+1].RevisionID
+			}
+		}
+	}
+	return from, to, nil
+}
+
+//Compares two revisions of a note line by line, or word by word when mode is "word". Returns errNotFound if either
+//revision is not part of the note
+func compareRevisions(noteID int, fromID int, toID int, mode string) (revisionDiff, error) {
+	if mode == "" {
+		mode = "line"
+	}
+	if mode != "line" && mode != "word" {
+		return revisionDiff{}, badRequest("mode should be line or word")
+	}
+	from, err := store.GetRevision(noteID, fromID)
+	if err != nil {
+		return revisionDiff{}, err
+	}
+	to, err := store.GetRevision(noteID, toID)
+	if err != nil {
+		return revisionDiff{}, err
+	}
+
+	result := revisionDiff{From: from, To: to, Mode: mode, Title: diffWords(from.Title, to.Title)}
+	if mode == "word" {
+		result.Contents = diffWords(from.Contents, to.Contents)
+	} else {
+		result.Contents = diffLines(from.Contents, to.Contents)
+	}
+	return result, nil
+}
+
+//Puts a note back to how it was in one of its revisions. The restore is saved as a new revision, so it can be
+//undone in the same way. Returns errNotFound if the revision is not part of the note
+func restoreRevision(note Note, revisionID int, userID int) (Note, error) {
+	revision, err := store.GetRevision(note.NoteID, revisionID)
+	if err != nil {
+		return note, err
+	}
+	note.Title = revision.Title
+	note.Contents = revision.Contents
+	note.DateUpdated = time.Now()
+	err = store.UpdateNote(note, userID)
+	return note, err
+}
+
+//Shows an editor whose save clashed with someone elses both versions of the note, with a form to save a merged
+//version. mine is the note as the editor tried to save it, with the Version they started from
+func renderMerge(w http.ResponseWriter, mine Note) error {
+	current, err := store.GetNote(mine.NoteID)
+	if err != nil {
+		return err
+	}
+	revisions, err := store.GetRevisions(mine.NoteID)
+	if err != nil {
+		return err
+	}
+	//The revision the editor started from, so each side's changes can be shown on their own
+	base := NoteRevision{Title: current.Title, Contents: current.Contents}
+	for _, revision := range revisions {
+		if revision.Version == mine.Version {
+			base = revision
+		}
+	}
+
+	t, err := parseTemplate("mergenote.html")
+	if err != nil {
+		return err
+	}
+	w.WriteHeader(http.StatusConflict)
+	return t.Execute(w, struct {
+		Current Note
+		Mine    Note
+		Theirs  []diffOp
+		Yours   []diffOp
+	}{current, mine, diffLines(base.Contents, current.Contents), diffLines(base.Contents, mine.Contents)})
+}
+
+//Lists every revision of a note
+func noteHistory(w http.ResponseWriter, r *http.Request) error {
+	//Checks if the user is logged in
+	session, err := requireSession(w, r)
+	if session == nil {
+		return err
+	}
+	note, role := routeNote(r)
+	revisions, err := store.GetRevisions(note.NoteID)
+	if err != nil {
+		return err
+	}
+	//Names the author of each revision
+	users, err := store.GetUsers()
+	if err != nil {
+		return err
+	}
+	names := make(map[int]string)
+	for _, user := range users {
+		names[user.UserID] = user.GivenName + " " + user.FamilyName
+	}
+
+	var rows []revisionRow
+	for i, revision := range revisions {
+		row := revisionRow{NoteRevision: revision, Author: names[revision.UserID]}
+		if i+1 < len(revisions) {
+			row.PreviousID = revisions[i+1].RevisionID
+		}
+		rows = append(rows, row)
+	}
+
+	t, err := parseTemplate("history.html")
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, struct {
+		Note      Note
+		Revisions []revisionRow
+		CanWrite  bool
+	}{note, rows, role.can(capEdit)})
+}
+
+//Shows the changes between two revisions of a note
+func noteDiff(w http.ResponseWriter, r *http.Request) error {
+	//Checks if the user is logged in
+	session, err := requireSession(w, r)
+	if session == nil {
+		return err
+	}
+	note, role := routeNote(r)
+	revisions, err := store.GetRevisions(note.NoteID)
+	if err != nil {
+		return err
+	}
+	query := r.URL.Query()
+	from, to, err := pickRevisions(revisions, query.Get("from"), query.Get("to"))
+	if err == errNotFound {
+		return notFound("That revision does not exist.")
+	}
+	if err != nil {
+		return err
+	}
+	changes, err := compareRevisions(note.NoteID, from, to, query.Get("mode"))
+	if err == errNotFound {
+		return notFound("That revision does not exist.")
+	}
+	if err != nil {
+		return err
+	}
+
+	t, err := parseTemplate("diff.html")
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, struct {
+		Note      Note
+		Diff      revisionDiff
+		Revisions []NoteRevision
+		CanWrite  bool
+	}{note, changes, revisions, role.can(capEdit)})
+}
+
+//Restores a note to one of its revisions
+func restoreNote(w http.ResponseWriter, r *http.Request) error {
+	//Checks if the user is logged in
+	session, err := requireSession(w, r)
+	if session == nil {
+		return err
+	}
+	note, _ := routeNote(r)
+	_, err = restoreRevision(note, routeID(r, "RevisionID"), session.UserID)
+	if err == errNotFound {
+		return notFound("That revision does not exist.")
+	}
+	if err != nil {
+		return err
+	}
+	http.Redirect(w, r, "/Notes/History/"+strconv.Itoa(note.NoteID), http.StatusSeeOther)
+	return nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNoteHistory(t *testing.T) {
+	owner, err := registerUser("History", "Owner", "password")
+	assert.NoError(t, err)
+	writer, err := registerUser("History", "Writer", "password")
+	assert.NoError(t, err)
+	reader, err := registerUser("History", "Reader", "password")
+	assert.NoError(t, err)
+	stranger, err := registerUser("History", "Stranger", "password")
+	assert.NoError(t, err)
+
+	note, err := saveNewNote(owner.UserID, "history", "first line\nsecond line\n", "")
+	assert.NoError(t, err)
+	_, err = store.AddAccess(NoteAccess{NoteID: note.NoteID, UserID: writer.UserID, Role: roleEditor})
+	assert.NoError(t, err)
+	_, err = store.AddAccess(NoteAccess{NoteID: note.NoteID, UserID: reader.UserID, Role: roleViewer})
+	assert.NoError(t, err)
+	id := strconv.Itoa(note.NoteID)
+
+	//A collaborators update is recorded as a revision rather than replacing the old text
+	rec := formRequest("/Notes/Update/"+id, writer.UserID, url.Values{"title": {"history"}, "content": {"first line\nchanged line\n"}, "version": {"1"}})
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	revisions, err := store.GetRevisions(note.NoteID)
+	assert.NoError(t, err)
+	if !assert.Len(t, revisions, 2) {
+		return
+	}
+	assert.Equal(t, writer.UserID, revisions[0].UserID)
+	first := strconv.Itoa(revisions[1].RevisionID)
+
+	//Everyone who can read the note can see its history, nobody else can
+	rec = apiRequest("GET", "/Notes/History/"+id, reader.UserID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "History Writer")
+	assert.NotContains(t, rec.Body.String(), "/Notes/Restore/", "readers should not be offered a restore")
+	rec = apiRequest("GET", "/Notes/History/"+id, stranger.UserID, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	//The diff defaults to the latest change
+	rec = apiRequest("GET", "/Notes/Diff/"+id, reader.UserID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), `<span class="delete">second line`)
+	assert.Contains(t, rec.Body.String(), `<span class="insert">changed line`)
+	rec = apiRequest("GET", "/Notes/Diff/"+id+"?from=abc", reader.UserID, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = apiRequest("GET", "/Notes/Diff/"+id+"?from=999999999", reader.UserID, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	//Restoring needs write access, and is saved as a new revision
+	rec = formRequest("/Notes/Restore/"+id+"/"+first, reader.UserID, nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = formRequest("/Notes/Restore/"+id+"/"+first, writer.UserID, nil)
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	saved, err := store.GetNote(note.NoteID)
+	assert.NoError(t, err)
+	assert.Equal(t, "first line\nsecond line\n", saved.Contents)
+	revisions, err = store.GetRevisions(note.NoteID)
+	assert.NoError(t, err)
+	assert.Len(t, revisions, 3)
+
+	//Revisions of other notes can not be restored onto this one
+	other, err := saveNewNote(owner.UserID, "other", "other", "")
+	assert.NoError(t, err)
+	otherRevisions, err := store.GetRevisions(other.NoteID)
+	assert.NoError(t, err)
+	rec = formRequest("/Notes/Restore/"+id+"/"+strconv.Itoa(otherRevisions[0].RevisionID), owner.UserID, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestAPINoteHistory(t *testing.T) {
+	owner, err := registerUser("API History", "Owner", "password")
+	assert.NoError(t, err)
+	stranger, err := registerUser("API History", "Stranger", "password")
+	assert.NoError(t, err)
+
+	rec := apiRequest("POST", "/api/v1/notes", owner.UserID, noteRequest{Title: "title", Contents: "the quick fox"})
+	var note Note
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &note))
+	path := "/api/v1/notes/" + strconv.Itoa(note.NoteID)
+	rec = apiRequest("PUT", path, owner.UserID, noteRequest{Title: "title", Contents: "the slow fox", Version: note.Version})
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	rec = apiRequest("GET", path+"/revisions", owner.UserID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var revisions []NoteRevision
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &revisions))
+	if !assert.Len(t, revisions, 2) {
+		return
+	}
+	rec = apiRequest("GET", path+"/revisions", stranger.UserID, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = apiRequest("GET", path+"/diff?mode=word", owner.UserID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var changes revisionDiff
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &changes))
+	assert.Equal(t, []diffOp{{diffEqual, "the "}, {diffDelete, "quick"}, {diffInsert, "slow"}, {diffEqual, " fox"}}, changes.Contents)
+	rec = apiRequest("GET", path+"/diff?mode=letters", owner.UserID, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	first := strconv.Itoa(revisions[1].RevisionID)
+	rec = apiRequest("GET", path+"/revisions/"+first, owner.UserID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = apiRequest("POST", path+"/revisions/"+first+"/restore", owner.UserID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &note))
+	assert.Equal(t, "the quick fox", note.Contents)
+}
+
+func TestUpdateConflictShowsMerge(t *testing.T) {
+	owner, err := registerUser("Merge", "Owner", "password")
+	assert.NoError(t, err)
+	editor, err := registerUser("Merge", "Editor", "password")
+	assert.NoError(t, err)
+	note, err := saveNewNote(owner.UserID, "merge", "line one\nline two\n", "")
+	assert.NoError(t, err)
+	_, err = store.AddAccess(NoteAccess{NoteID: note.NoteID, UserID: editor.UserID, Role: roleEditor})
+	assert.NoError(t, err)
+	path := "/Notes/Update/" + strconv.Itoa(note.NoteID)
+
+	//The edit form carries the version being edited
+	rec := apiRequest("GET", path, editor.UserID, nil)
+	assert.Contains(t, rec.Body.String(), `name="version" value="1"`)
+
+	//Both open version 1, the owner saves first
+	rec = formRequest(path, owner.UserID, url.Values{"title": {"merge"}, "content": {"line one\nowner line\n"}, "version": {"1"}})
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+
+	//The editors save does not overwrite the owners, they are shown both sides instead
+	rec = formRequest(path, editor.UserID, url.Values{"title": {"merge"}, "content": {"editor line\nline two\n"}, "version": {"1"}})
+	assert.Equal(t, http.StatusConflict, rec.Code)
+	body := rec.Body.String()
+	assert.Contains(t, body, `<span class="insert">owner line`)
+	assert.Contains(t, body, `<span class="insert">editor line`)
+	assert.Contains(t, body, `name="version" value="2"`, "the merge form should save on top of the owners version")
+	saved, err := store.GetNote(note.NoteID)
+	assert.NoError(t, err)
+	assert.Equal(t, "line one\nowner line\n", saved.Contents)
+
+	//Saving the merged note from the merge form works
+	rec = formRequest(path, editor.UserID, url.Values{"title": {"merge"}, "content": {"editor line\nowner line\n"}, "version": {"2"}})
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	saved, err = store.GetNote(note.NoteID)
+	assert.NoError(t, err)
+	assert.Equal(t, "editor line\nowner line\n", saved.Contents)
+
+	//Forms without a version are rejected rather than saved blindly
+	rec = formRequest(path, editor.UserID, url.Values{"title": {"merge"}, "content": {"blind"}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
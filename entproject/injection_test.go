@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//Classic SQL injection payloads. Each one would change or break the query if it reached the SQL text
+var injectionPayloads = []string{
+	"1 OR 1=1",
+	"1; DROP TABLE Note; --",
+	"' OR '1'='1",
+	"'; DELETE FROM NoteAccess; --",
+	"1) OR (1=1",
+	"%' OR note.userid > 0 OR note.title LIKE '%",
+	"1 UNION SELECT 1, 1, Password, Password, NULL, NULL FROM \"User\" --",
+}
+
+//Sends a form post through the router as the given user and returns the response
+func formRequest(path string, userID int, form url.Values) *httptest.ResponseRecorder {
+	req := httptest.NewRequest("POST", path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if userID != 0 {
+		token, err := startSession(userID)
+		if err != nil {
+			panic(err)
+		}
+		req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+	}
+	rec := httptest.NewRecorder()
+	newRouter().ServeHTTP(rec, req)
+	return rec
+}
+
+//Counts every note in the store so a test can check a payload did not add or remove any
+func countNotes(t *testing.T) int {
+	users, err := store.GetUsers()
+	assert.NoError(t, err)
+	count := 0
+	for _, user := range users {
+		notes, err := store.GetUserNotes(user.UserID)
+		assert.NoError(t, err)
+		for _, note := range notes {
+			if note.UserID == user.UserID {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+func TestParseID(t *testing.T) {
+	id, err := parseID("42")
+	assert.NoError(t, err)
+	assert.Equal(t, 42, id)
+
+	for _, input := range append([]string{"", "0", "-1", "abc", "9999999999"}, injectionPayloads...) {
+		_, err := parseID(input)
+		assert.Error(t, err, "parseID(%q) should fail", input)
+	}
+}
+
+func TestRouteIDsRejectPayloads(t *testing.T) {
+	user, err := registerUser("Route", "Injection", "password")
+	assert.NoError(t, err)
+	routes := []string{
+		"/Users/Notes/",
+		"/Notes/Update/",
+		"/Notes/Delete/",
+		"/Notes/Analyse/",
+		"/Notes/Share/",
+		"/Notes/ViewAccess/",
+		"/Notes/EditAccess/",
+		"/Notes/CreateSharedSetting/",
+		"/api/v1/notes/",
+		"/api/v1/users/",
+	}
+	notes := countNotes(t)
+
+	for _, route := range routes {
+		for _, payload := range injectionPayloads {
+			rec := apiRequest("GET", route+url.PathEscape(payload), user.UserID, nil)
+			assert.Equal(t, http.StatusNotFound, rec.Code, "GET %s%s", route, payload)
+		}
+		//IDs too big for a Postgres INT never reach the database
+		rec := apiRequest("GET", route+"99999999999", user.UserID, nil)
+		assert.Equal(t, http.StatusNotFound, rec.Code, "GET %s with an overflowing id", route)
+	}
+
+	//Form IDs that are not plain numbers are rejected before reaching the database
+	note, err := saveNewNote(user.UserID, "title", "contents", "")
+	assert.NoError(t, err)
+	notes++
+	for _, payload := range injectionPayloads {
+		rec := formRequest("/Notes/Share/"+strconv.Itoa(note.NoteID), user.UserID, url.Values{"userid": {payload}, "role": {"viewer"}})
+		assert.Equal(t, http.StatusBadRequest, rec.Code, "share with %q", payload)
+		rec = formRequest("/Users/LogIn", 0, url.Values{"id": {payload}, "password": {"password"}})
+		assert.Equal(t, http.StatusBadRequest, rec.Code, "log in as %q", payload)
+	}
+	assert.Equal(t, notes, countNotes(t))
+}
+
+//Skips a test that only means something against PostgreSQL. The memory store never builds SQL, so payloads getting
+//through it safely say nothing about injection
+func requirePostgres(t *testing.T) {
+	t.Helper()
+	if _, ok := store.(*pgStore); !ok {
+		t.Skip("NOTEAPP_TEST_DSN is not set, so SQL injection is not being tested against PostgreSQL")
+	}
+}
+
+func TestSearchPayloadsAreInert(t *testing.T) {
+	requirePostgres(t)
+	owner, err := registerUser("Search", "Owner", "password")
+	assert.NoError(t, err)
+	other, err := registerUser("Search", "Other", "password")
+	assert.NoError(t, err)
+	_, err = saveNewNote(other.UserID, "private", "private contents", "")
+	assert.NoError(t, err)
+	notes := countNotes(t)
+
+	for _, payload := range injectionPayloads {
+		rec := formRequest("/Notes/Search/", owner.UserID, url.Values{"search": {payload}})
+		assert.Equal(t, http.StatusOK, rec.Code, "search %q", payload)
+		assert.NotContains(t, rec.Body.String(), "private contents", "search %q leaked another users note", payload)
+
+		rec = apiRequest("GET", "/api/v1/notes/search?q="+url.QueryEscape(payload), owner.UserID, nil)
+		assert.Equal(t, http.StatusOK, rec.Code, "api search %q", payload)
+		var found []Note
+		assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &found))
+		assert.Empty(t, found, "api search %q should match nothing", payload)
+	}
+	assert.Equal(t, notes, countNotes(t))
+
+	//A bare wildcard has no words to look for, so it matches nothing rather than every note
+	found, err := store.SearchNotes(owner.UserID, parseSearchQuery("%"))
+	assert.NoError(t, err)
+	assert.Empty(t, found)
+}
+
+func TestFormPayloadsAreStoredLiterally(t *testing.T) {
+	requirePostgres(t)
+	owner, err := registerUser("Form", "Owner", "password")
+	assert.NoError(t, err)
+
+	for _, payload := range injectionPayloads {
+		//Title and contents are saved exactly as typed
+		note, err := saveNewNote(owner.UserID, "title", payload, payload)
+		assert.NoError(t, err)
+		saved, err := store.GetNote(note.NoteID)
+		assert.NoError(t, err)
+		assert.Equal(t, payload, saved.Contents)
+
+		path := "/Notes/Update/" + strconv.Itoa(note.NoteID)
+		rec := formRequest(path, owner.UserID, url.Values{"title": {"updated"}, "content": {payload}, "version": {strconv.Itoa(saved.Version)}})
+		assert.Equal(t, http.StatusSeeOther, rec.Code, "update with %q", payload)
+		saved, err = store.GetNote(note.NoteID)
+		assert.NoError(t, err)
+		assert.Equal(t, payload, saved.Contents)
+
+		//Shared setting names are only ever compared as values
+		rec = formRequest("/Notes/CreateSharedSetting/"+strconv.Itoa(note.NoteID), owner.UserID, url.Values{"settingName": {payload}})
+		assert.Less(t, rec.Code, 500, "shared setting named %q", payload)
+	}
+}
@@ -0,0 +1,100 @@
+package main
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"regexp"
+
+	"github.com/microcosm-cc/bluemonday"
+	"github.com/yuin/goldmark"
+	"github.com/yuin/goldmark/extension"
+)
+
+//Turns a notes Markdown into HTML. GFM adds tables, strikethrough, task list checkboxes and links from bare URLs.
+//HTML typed into a note is left out rather than passed through
+var markdown = goldmark.New(goldmark.WithExtensions(extension.GFM))
+
+//What rendered notes are allowed to contain
+var markdownPolicy = newMarkdownPolicy()
+
+//Builds on bluemonday's policy for user content, which keeps formatting and links but drops scripts, styles and event
+//handlers. Task lists need their disabled checkboxes, and code blocks keep the class naming their language
+func newMarkdownPolicy() *bluemonday.Policy {
+	policy := bluemonday.UGCPolicy()
+	policy.AllowAttrs("type").Matching(regexp.MustCompile(`^checkbox$`)).OnElements("input")
+	policy.AllowAttrs("checked", "disabled").OnElements("input")
+	policy.AllowAttrs("class").Matching(regexp.MustCompile(`^language-[\w+#-]+$`)).OnElements("code")
+	return policy
+}
+
+//Renders Markdown to sanitised HTML that can be put straight into a page
+func renderMarkdown(source string) (template.HTML, error) {
+	var buf bytes.Buffer
+	err := markdown.Convert([]byte(source), &buf)
+	if err != nil {
+		return "", err
+	}
+	return template.HTML(markdownPolicy.SanitizeBytes(buf.Bytes())), nil
+}
+
+//Shows a note with its Markdown rendered
+func viewNote(w http.ResponseWriter, r *http.Request) error {
+	//Checks if a user is already logged in
+	session, err := requireSession(w, r)
+	if session == nil {
+		return err
+	}
+	note, role := routeNote(r)
+	contents, err := renderMarkdown(note.Contents)
+	if err != nil {
+		return err
+	}
+	attachments, err := store.GetAttachments(note.NoteID)
+	if err != nil {
+		return err
+	}
+	//Only access given on the note itself can be left, access through a notebook goes with the notebook
+	_, err = store.GetUserAccess(note.NoteID, session.UserID)
+	if err != nil && err != errNotFound {
+		return err
+	}
+	canLeave := err == nil
+
+	t, err := parseTemplate("viewnote.html")
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, struct {
+		Note
+		HTML        template.HTML
+		Role        Role
+		CanWrite    bool
+		CanTransfer bool
+		CanLeave    bool
+		//The user has just left the note but still has a role on it through its notebook
+		Left        bool
+		Attachments []Attachment
+	}{note, contents, role, role.can(capEdit), role.can(capTransfer), canLeave, r.FormValue("left") != "" && !canLeave, attachments})
+}
+
+//Renders the content field of a form, for the live preview on the create and update pages
+func previewNote(w http.ResponseWriter, r *http.Request) error {
+	//Checks if a user is already logged in
+	session, err := requireSession(w, r)
+	if session == nil {
+		return err
+	}
+	//Notes too long to save are not worth rendering either
+	err = validateNote("", r.FormValue("content"))
+	if err != nil {
+		return err
+	}
+	contents, err := renderMarkdown(r.FormValue("content"))
+	if err != nil {
+		return err
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	_, err = w.Write([]byte(contents))
+	return err
+}
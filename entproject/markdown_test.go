@@ -0,0 +1,94 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRenderMarkdown(t *testing.T) {
+	tests := []struct {
+		name     string
+		markdown string
+		contains []string
+	}{
+		{"heading", "# Title", []string{"<h1>Title</h1>"}},
+		{"list", "- one\n- two", []string{"<ul>", "<li>one</li>", "<li>two</li>"}},
+		{"code block", "```go\nfmt.Println(\"<hi>\")\n```", []string{`<pre><code class="language-go">`, "&lt;hi&gt;"}},
+		{"inline code", "run `go test`", []string{"<code>go test</code>"}},
+		{"checkboxes", "- [x] done\n- [ ] todo", []string{`<input checked="" disabled="" type="checkbox"`, `<input disabled="" type="checkbox"`}},
+		{"link", "[site](https://example.com)", []string{`<a href="https://example.com" rel="nofollow">site</a>`}},
+		{"bare link", "see https://example.com", []string{`<a href="https://example.com" rel="nofollow">`}},
+		{"table", "| a | b |\n| --- | --- |\n| 1 | 2 |", []string{"<table>", "<td>1</td>"}},
+	}
+	for _, test := range tests {
+		html, err := renderMarkdown(test.markdown)
+		assert.NoError(t, err)
+		for _, want := range test.contains {
+			assert.Contains(t, string(html), want, test.name)
+		}
+	}
+}
+
+func TestRenderMarkdownIsSafe(t *testing.T) {
+	tests := []struct {
+		name      string
+		markdown  string
+		forbidden []string
+	}{
+		{"script tag", "<script>alert(1)</script>", []string{"<script", "alert(1)"}},
+		{"event handler", `<img src="x" onerror="alert(1)">`, []string{"onerror", "<img"}},
+		{"javascript link", "[click](javascript:alert(1))", []string{"javascript:"}},
+		{"inline html", "hello <b onclick=\"alert(1)\">there</b>", []string{"onclick", "<b"}},
+		{"iframe", "<iframe src=\"https://example.com\"></iframe>", []string{"<iframe"}},
+		{"style", "<style>body { display: none }</style>", []string{"<style", "display"}},
+		{"image event handler", `![x](y "a\" onerror=\"alert(1)")`, []string{"onerror="}},
+		{"code class", "```x\" onclick=\"alert(1)\ncode\n```", []string{"onclick"}},
+	}
+	for _, test := range tests {
+		html, err := renderMarkdown(test.markdown)
+		assert.NoError(t, err)
+		for _, bad := range test.forbidden {
+			assert.NotContains(t, string(html), bad, test.name)
+		}
+	}
+}
+
+func TestMarkdownPages(t *testing.T) {
+	owner, err := registerUser("Markdown", "Owner", "password")
+	assert.NoError(t, err)
+	other, err := registerUser("Markdown", "Other", "password")
+	assert.NoError(t, err)
+	note, err := saveNewNote(owner.UserID, "<script>title</script>", "## Shopping\n- [ ] milk\n<script>alert(1)</script>", "")
+	assert.NoError(t, err)
+
+	rec := apiRequest("GET", "/Notes/View/"+strconv.Itoa(note.NoteID), owner.UserID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	body := rec.Body.String()
+	assert.Contains(t, body, "<h2>Shopping</h2>")
+	assert.Contains(t, body, `type="checkbox"`)
+	assert.Contains(t, body, "&lt;script&gt;title&lt;/script&gt;", "the title should be escaped")
+	assert.NotContains(t, body, "alert(1)")
+	//Notes keep the time they were updated, not just the day, so the page shows it
+	saved, err := store.GetNote(note.NoteID)
+	assert.NoError(t, err)
+	assert.Contains(t, body, "Last updated "+saved.DateUpdated.Format("2006-01-02 15:04:05"))
+	rec = apiRequest("GET", "/Notes/View/"+strconv.Itoa(note.NoteID), other.UserID, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = apiRequest("GET", "/Users/Notes/"+strconv.Itoa(owner.UserID), owner.UserID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "<script>title", "the home page should escape note titles")
+
+	rec = formRequest("/Notes/Preview/", owner.UserID, url.Values{"content": {"**bold** <script>alert(1)</script>"}})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Equal(t, "<p><strong>bold</strong> alert(1)</p>\n", rec.Body.String(), "tags typed into a note should be dropped, leaving only their text")
+	rec = formRequest("/Notes/Preview/", owner.UserID, url.Values{"content": {strings.Repeat("a", maxNoteContentsLength+1)}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "notes too long to save should not be previewed")
+	rec = formRequest("/Notes/Preview/", 0, url.Values{"content": {"**bold**"}})
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+}
@@ -0,0 +1,908 @@
+package main
+
+import (
+	"html/template"
+	"sort"
+	"sync"
+	"time"
+)
+
+//Store that keeps everything in memory. Used for demos and tests, everything is lost when the server stops
+type memStore struct {
+	mu             sync.Mutex
+	users          []User
+	notes          []Note
+	noteAccess     []NoteAccess
+	sharedSettings []SharedSettings
+	revisions      []NoteRevision
+	noteTags       map[int][]string
+	notebooks      []Notebook
+	notebookAccess []NotebookAccess
+	attachments    []Attachment
+	sessions       map[string]Session
+	//When each note in the trash was deleted
+	trash map[int]time.Time
+	//Last ID handed out for each kind of row
+	lastUserID, lastNoteID, lastNoteAccessID, lastSharedSettingsID, lastRevisionID, lastNotebookID, lastNotebookAccessID, lastAttachmentID int
+}
+
+func newMemStore() *memStore {
+	return &memStore{noteTags: make(map[int][]string), trash: make(map[int]time.Time), sessions: make(map[string]Session)}
+}
+
+func (s *memStore) Close() error {
+	return nil
+}
+
+//Fills a store with the sample users and notes used in demo mode
+func seedDemoData(s Store) error {
+	//mock users
+	users := []User{
+		{GivenName: "John", FamilyName: "Snow", Password: "hello123"},
+		{GivenName: "Bob", FamilyName: "Williams", Password: "hi"},
+	}
+	var userIDs []int
+	for _, user := range users {
+		hash, err := hashPassword(user.Password)
+		if err != nil {
+			return err
+		}
+		user.Password = hash
+		user, err = s.CreateUser(user)
+		if err != nil {
+			return err
+		}
+		userIDs = append(userIDs, user.UserID)
+	}
+
+	//mock notes
+	notes := []Note{
+		{UserID: userIDs[0], Title: "my note", Contents: "hi this is a note"},
+		{UserID: userIDs[0], Title: "my note 2", Contents: "note2"},
+		{UserID: userIDs[1], Title: "my note 3", Contents: "hi cat note"},
+		{UserID: userIDs[0], Title: "my note 4", Contents: "hello world"},
+		{UserID: userIDs[1], Title: "my note 5", Contents: "hi dog"},
+		{UserID: userIDs[1], Title: "my note 6", Contents: "pup hi note"},
+		{UserID: userIDs[0], Title: "my note 7", Contents: "hello doggo"},
+		{UserID: userIDs[1], Title: "my note 8", Contents: "note is world"},
+	}
+	//mock tags, by note
+	tags := [][]string{
+		{"greetings"},
+		nil,
+		{"animals", "greetings"},
+		{"greetings"},
+		{"animals"},
+		{"animals"},
+		{"animals", "greetings"},
+		nil,
+	}
+	now := time.Now()
+	for i, note := range notes {
+		note.DateCreated = now
+		note.DateUpdated = now
+		note, err := s.CreateNote(note)
+		if err != nil {
+			return err
+		}
+		if tags[i] != nil {
+			err = s.SetNoteTags(note.NoteID, tags[i])
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (s *memStore) GetUsers() ([]User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var users []User
+	for _, user := range s.users {
+		user.Password = ""
+		users = append(users, user)
+	}
+	return users, nil
+}
+
+func (s *memStore) GetUser(userID int) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, user := range s.users {
+		if user.UserID == userID {
+			user.Password = ""
+			return user, nil
+		}
+	}
+	return User{}, errNotFound
+}
+
+func (s *memStore) CreateUser(user User) (User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastUserID++
+	user.UserID = s.lastUserID
+	s.users = append(s.users, user)
+	return user, nil
+}
+
+func (s *memStore) GetPassword(userID int) (string, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, user := range s.users {
+		if user.UserID == userID {
+			return user.Password, nil
+		}
+	}
+	return "", errNotFound
+}
+
+func (s *memStore) UpdatePassword(userID int, hash string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.users {
+		if s.users[i].UserID == userID {
+			s.users[i].Password = hash
+		}
+	}
+	return nil
+}
+
+//Works out a users role on a note the same way noteRoleFor does: owner, or the most the note or its notebooks have
+//been shared with them as. The caller must hold the lock
+func (s *memStore) roleOn(note Note, userID int) Role {
+	if note.UserID == userID {
+		return roleOwner
+	}
+	var role Role
+	for _, access := range s.noteAccess {
+		if access.NoteID == note.NoteID && access.UserID == userID {
+			role = maxRole(role, access.Role)
+		}
+	}
+	return maxRole(role, s.notebookRole(note.NotebookID, userID))
+}
+
+//Works out the role a user has on the notes in a notebook from it and the notebooks it is inside. Owning any of them
+//makes them the owner. The caller must hold the lock
+func (s *memStore) notebookRole(notebookID int, userID int) (role Role) {
+	//Guards against a loop in the parents, which the handlers never make
+	seen := make(map[int]bool)
+	for notebookID != 0 && !seen[notebookID] {
+		seen[notebookID] = true
+		parentID := 0
+		for _, notebook := range s.notebooks {
+			if notebook.NotebookID == notebookID {
+				if notebook.UserID == userID {
+					return roleOwner
+				}
+				parentID = notebook.ParentID
+			}
+		}
+		for _, access := range s.notebookAccess {
+			if access.NotebookID == notebookID && access.UserID == userID {
+				role = maxRole(role, access.Role)
+			}
+		}
+		notebookID = parentID
+	}
+	return role
+}
+
+func (s *memStore) GetUserNotes(userID int) ([]Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var userNotes []Note
+	for _, note := range s.notes {
+		if !s.inTrash(note.NoteID) && s.roleOn(note, userID).can(capView) {
+			userNotes = append(userNotes, s.withTags(note))
+		}
+	}
+	return userNotes, nil
+}
+
+func (s *memStore) GetNote(noteID int) (Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, note := range s.notes {
+		if note.NoteID == noteID && !s.inTrash(noteID) {
+			return s.withTags(note), nil
+		}
+	}
+	return Note{}, errNotFound
+}
+
+//Whether a note is in the trash. The caller must hold the lock
+func (s *memStore) inTrash(noteID int) bool {
+	_, found := s.trash[noteID]
+	return found
+}
+
+//Fills in a notes tags. The caller must hold the lock
+func (s *memStore) withTags(note Note) Note {
+	note.Tags = append([]string{}, s.noteTags[note.NoteID]...)
+	return note
+}
+
+func (s *memStore) CreateNote(note Note) (Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastNoteID++
+	note.NoteID = s.lastNoteID
+	note.Version = 1
+	note.Tags = nil
+	s.notes = append(s.notes, note)
+	s.addRevision(note, note.UserID, note.DateCreated)
+	return s.withTags(note), nil
+}
+
+func (s *memStore) UpdateNote(note Note, authorID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.notes {
+		if s.notes[i].NoteID == note.NoteID && s.notes[i].Version == note.Version && !s.inTrash(note.NoteID) {
+			note.Version++
+			s.notes[i].Title = note.Title
+			s.notes[i].Contents = note.Contents
+			s.notes[i].DateUpdated = note.DateUpdated
+			s.notes[i].Version = note.Version
+			s.addRevision(note, authorID, note.DateUpdated)
+			return nil
+		}
+	}
+	return errConflict
+}
+
+//Records a notes title and contents as a revision. The caller must hold the lock
+func (s *memStore) addRevision(note Note, authorID int, date time.Time) {
+	s.lastRevisionID++
+	s.revisions = append(s.revisions, NoteRevision{RevisionID: s.lastRevisionID, NoteID: note.NoteID, UserID: authorID, Title: note.Title, Contents: note.Contents, DateCreated: date, Version: note.Version})
+}
+
+func (s *memStore) GetRevisions(noteID int) ([]NoteRevision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var revisions []NoteRevision
+	//Newest first, like the Postgres store
+	for i := len(s.revisions) - 1; i >= 0; i-- {
+		if s.revisions[i].NoteID == noteID {
+			revisions = append(revisions, s.revisions[i])
+		}
+	}
+	return revisions, nil
+}
+
+func (s *memStore) GetRevision(noteID int, revisionID int) (NoteRevision, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, revision := range s.revisions {
+		if revision.NoteID == noteID && revision.RevisionID == revisionID {
+			return revision, nil
+		}
+	}
+	return NoteRevision{}, errNotFound
+}
+
+func (s *memStore) DeleteNote(noteID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var noteAccess []NoteAccess
+	for _, access := range s.noteAccess {
+		if access.NoteID != noteID {
+			noteAccess = append(noteAccess, access)
+		}
+	}
+	s.noteAccess = noteAccess
+
+	var revisions []NoteRevision
+	for _, revision := range s.revisions {
+		if revision.NoteID != noteID {
+			revisions = append(revisions, revision)
+		}
+	}
+	s.revisions = revisions
+	delete(s.noteTags, noteID)
+	delete(s.trash, noteID)
+
+	var attachments []Attachment
+	for _, attachment := range s.attachments {
+		if attachment.NoteID != noteID {
+			attachments = append(attachments, attachment)
+		}
+	}
+	s.attachments = attachments
+
+	var notes []Note
+	for _, note := range s.notes {
+		if note.NoteID != noteID {
+			notes = append(notes, note)
+		}
+	}
+	s.notes = notes
+	return nil
+}
+
+func (s *memStore) TransferNote(noteID int, ownerID int, previousOwner Role, date time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.notes {
+		if s.notes[i].NoteID != noteID || s.inTrash(noteID) {
+			continue
+		}
+		kept := s.noteAccess[:0]
+		for _, access := range s.noteAccess {
+			if access.NoteID != noteID || access.UserID != ownerID {
+				kept = append(kept, access)
+			}
+		}
+		s.noteAccess = kept
+		oldOwnerID := s.notes[i].UserID
+		if previousOwner != "" {
+			s.lastNoteAccessID++
+			s.noteAccess = append(s.noteAccess, NoteAccess{NoteAccessID: s.lastNoteAccessID, NoteID: noteID, UserID: oldOwnerID, Role: previousOwner, GrantedBy: oldOwnerID, DateGranted: date})
+		}
+		s.notes[i].UserID = ownerID
+		s.notes[i].NotebookID = 0
+		return nil
+	}
+	return errNotFound
+}
+
+func (s *memStore) SearchNotes(userID int, query searchQuery) ([]SearchResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if query.empty() {
+		return nil, nil
+	}
+	var matches []SearchResult
+	for _, note := range s.notes {
+		note = s.withTags(note)
+		role := s.roleOn(note, userID)
+		if s.inTrash(note.NoteID) || !role.can(capView) || !query.Filter.matches(note, userID, role.can(capEdit)) {
+			continue
+		}
+		if rank, ok := query.rank(note); ok {
+			matches = append(matches, SearchResult{Note: note, Rank: rank, Snippet: template.HTML(query.snippet(note.Contents))})
+		}
+	}
+	sort.SliceStable(matches, func(i, j int) bool {
+		if matches[i].Rank != matches[j].Rank {
+			return matches[i].Rank > matches[j].Rank
+		}
+		return matches[i].NoteID < matches[j].NoteID
+	})
+	return matches, nil
+}
+
+func (s *memStore) TrashNote(noteID int, dateDeleted time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, note := range s.notes {
+		if note.NoteID == noteID && !s.inTrash(noteID) {
+			s.trash[noteID] = dateDeleted
+			return nil
+		}
+	}
+	return errNotFound
+}
+
+func (s *memStore) GetTrash(userID int) ([]TrashedNote, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var trash []TrashedNote
+	for _, note := range s.notes {
+		if dateDeleted, found := s.trash[note.NoteID]; found && note.UserID == userID {
+			trash = append(trash, TrashedNote{Note: s.withTags(note), DateDeleted: dateDeleted})
+		}
+	}
+	sort.SliceStable(trash, func(i, j int) bool {
+		return trash[i].DateDeleted.After(trash[j].DateDeleted)
+	})
+	return trash, nil
+}
+
+func (s *memStore) GetTrashedNote(noteID int) (TrashedNote, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, note := range s.notes {
+		if dateDeleted, found := s.trash[note.NoteID]; found && note.NoteID == noteID {
+			return TrashedNote{Note: s.withTags(note), DateDeleted: dateDeleted}, nil
+		}
+	}
+	return TrashedNote{}, errNotFound
+}
+
+func (s *memStore) RestoreNote(noteID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if !s.inTrash(noteID) {
+		return errNotFound
+	}
+	delete(s.trash, noteID)
+	return nil
+}
+
+func (s *memStore) GetExpiredTrash(deletedBefore time.Time) ([]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var noteIDs []int
+	for noteID, dateDeleted := range s.trash {
+		if dateDeleted.Before(deletedBefore) {
+			noteIDs = append(noteIDs, noteID)
+		}
+	}
+	sort.Ints(noteIDs)
+	return noteIDs, nil
+}
+
+func (s *memStore) SetNoteTags(noteID int, tags []string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.noteTags[noteID] = append([]string{}, tags...)
+	return nil
+}
+
+func (s *memStore) GetTagCounts(userID int) ([]tagCount, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := make(map[string]int)
+	for _, note := range s.notes {
+		if !s.inTrash(note.NoteID) && s.roleOn(note, userID).can(capView) {
+			for _, tag := range s.noteTags[note.NoteID] {
+				counts[tag]++
+			}
+		}
+	}
+	var result []tagCount
+	for name, count := range counts {
+		result = append(result, tagCount{name, count})
+	}
+	sort.Slice(result, func(i, j int) bool {
+		return result[i].Name < result[j].Name
+	})
+	return result, nil
+}
+
+func (s *memStore) GetUserNotebooks(userID int) ([]Notebook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var notebooks []Notebook
+	for _, notebook := range s.notebooks {
+		if notebook.UserID == userID {
+			notebooks = append(notebooks, notebook)
+		}
+	}
+	sortNotebooks(notebooks)
+	return notebooks, nil
+}
+
+func (s *memStore) GetSharedNotebooks(userID int) ([]Notebook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var notebooks []Notebook
+	for _, notebook := range s.notebooks {
+		for _, access := range s.notebookAccess {
+			if access.NotebookID == notebook.NotebookID && access.UserID == userID {
+				notebooks = append(notebooks, notebook)
+				break
+			}
+		}
+	}
+	sortNotebooks(notebooks)
+	return notebooks, nil
+}
+
+func (s *memStore) GetNotebook(notebookID int) (Notebook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, notebook := range s.notebooks {
+		if notebook.NotebookID == notebookID {
+			return notebook, nil
+		}
+	}
+	return Notebook{}, errNotFound
+}
+
+func (s *memStore) GetChildNotebooks(notebookID int) ([]Notebook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var notebooks []Notebook
+	for _, notebook := range s.notebooks {
+		if notebook.ParentID == notebookID {
+			notebooks = append(notebooks, notebook)
+		}
+	}
+	sortNotebooks(notebooks)
+	return notebooks, nil
+}
+
+func (s *memStore) GetNotebookNotes(notebookID int) ([]Note, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var notes []Note
+	for _, note := range s.notes {
+		if note.NotebookID == notebookID && !s.inTrash(note.NoteID) {
+			notes = append(notes, s.withTags(note))
+		}
+	}
+	return notes, nil
+}
+
+func (s *memStore) CreateNotebook(notebook Notebook) (Notebook, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastNotebookID++
+	notebook.NotebookID = s.lastNotebookID
+	s.notebooks = append(s.notebooks, notebook)
+	return notebook, nil
+}
+
+func (s *memStore) DeleteNotebook(notebookID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var notebookAccess []NotebookAccess
+	for _, access := range s.notebookAccess {
+		if access.NotebookID != notebookID {
+			notebookAccess = append(notebookAccess, access)
+		}
+	}
+	s.notebookAccess = notebookAccess
+	//Only notes in the trash can still be in it
+	for i := range s.notes {
+		if s.notes[i].NotebookID == notebookID {
+			s.notes[i].NotebookID = 0
+		}
+	}
+
+	var notebooks []Notebook
+	for _, notebook := range s.notebooks {
+		if notebook.NotebookID != notebookID {
+			notebooks = append(notebooks, notebook)
+		}
+	}
+	s.notebooks = notebooks
+	return nil
+}
+
+func (s *memStore) MoveNote(noteID int, notebookID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.notes {
+		if s.notes[i].NoteID == noteID && !s.inTrash(noteID) {
+			s.notes[i].NotebookID = notebookID
+			return nil
+		}
+	}
+	return errNotFound
+}
+
+func (s *memStore) GetNotebookAccess(notebookID int) ([]NotebookAccess, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var matches []NotebookAccess
+	for _, access := range s.notebookAccess {
+		if access.NotebookID == notebookID {
+			matches = append(matches, access)
+		}
+	}
+	return matches, nil
+}
+
+func (s *memStore) GetUserNotebookAccess(notebookID int, userID int) (NotebookAccess, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, access := range s.notebookAccess {
+		if access.NotebookID == notebookID && access.UserID == userID {
+			return access, nil
+		}
+	}
+	return NotebookAccess{}, errNotFound
+}
+
+func (s *memStore) SetNotebookAccess(access NotebookAccess) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.notebookAccess {
+		if s.notebookAccess[i].NotebookID == access.NotebookID && s.notebookAccess[i].UserID == access.UserID {
+			s.notebookAccess[i].Role = access.Role
+			return nil
+		}
+	}
+	s.lastNotebookAccessID++
+	access.NotebookAccessID = s.lastNotebookAccessID
+	s.notebookAccess = append(s.notebookAccess, access)
+	return nil
+}
+
+func (s *memStore) RemoveNotebookAccess(notebookID int, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.notebookAccess[:0]
+	for _, access := range s.notebookAccess {
+		if access.NotebookID != notebookID || access.UserID != userID {
+			kept = append(kept, access)
+		}
+	}
+	if len(kept) == len(s.notebookAccess) {
+		return errNotFound
+	}
+	s.notebookAccess = kept
+	return nil
+}
+
+func (s *memStore) GetAttachments(noteID int) ([]Attachment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var attachments []Attachment
+	for _, attachment := range s.attachments {
+		if attachment.NoteID == noteID {
+			attachments = append(attachments, attachment)
+		}
+	}
+	return attachments, nil
+}
+
+func (s *memStore) GetAttachment(attachmentID int) (Attachment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, attachment := range s.attachments {
+		if attachment.AttachmentID == attachmentID {
+			return attachment, nil
+		}
+	}
+	return Attachment{}, errNotFound
+}
+
+func (s *memStore) AddAttachment(attachment Attachment) (Attachment, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastAttachmentID++
+	attachment.AttachmentID = s.lastAttachmentID
+	s.attachments = append(s.attachments, attachment)
+	return attachment, nil
+}
+
+func (s *memStore) DeleteAttachment(attachmentID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var attachments []Attachment
+	for _, attachment := range s.attachments {
+		if attachment.AttachmentID != attachmentID {
+			attachments = append(attachments, attachment)
+		}
+	}
+	s.attachments = attachments
+	return nil
+}
+
+//Puts notebooks in name order, like the Postgres store
+func sortNotebooks(notebooks []Notebook) {
+	sort.SliceStable(notebooks, func(i, j int) bool {
+		if notebooks[i].Name != notebooks[j].Name {
+			return notebooks[i].Name < notebooks[j].Name
+		}
+		return notebooks[i].NotebookID < notebooks[j].NotebookID
+	})
+}
+
+func (s *memStore) GetAccess(noteID int) ([]NoteAccess, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var matches []NoteAccess
+	for _, access := range s.noteAccess {
+		if access.NoteID == noteID {
+			matches = append(matches, access)
+		}
+	}
+	return matches, nil
+}
+
+func (s *memStore) CountAccess(noteIDs []int) (map[int]int, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	wanted := make(map[int]bool)
+	for _, noteID := range noteIDs {
+		wanted[noteID] = true
+	}
+	counts := make(map[int]int)
+	for _, access := range s.noteAccess {
+		if wanted[access.NoteID] {
+			counts[access.NoteID]++
+		}
+	}
+	return counts, nil
+}
+
+func (s *memStore) GetUserAccess(noteID int, userID int) (NoteAccess, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, access := range s.noteAccess {
+		if access.NoteID == noteID && access.UserID == userID {
+			return access, nil
+		}
+	}
+	return NoteAccess{}, errNotFound
+}
+
+func (s *memStore) AddAccess(access NoteAccess) (NoteAccess, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for i := range s.noteAccess {
+		if s.noteAccess[i].NoteID == access.NoteID && s.noteAccess[i].UserID == access.UserID {
+			access.NoteAccessID = s.noteAccess[i].NoteAccessID
+			s.noteAccess[i] = access
+			return access, nil
+		}
+	}
+	s.lastNoteAccessID++
+	access.NoteAccessID = s.lastNoteAccessID
+	s.noteAccess = append(s.noteAccess, access)
+	return access, nil
+}
+
+func (s *memStore) SetUserAccess(access NoteAccess) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	updated := false
+	for i := range s.noteAccess {
+		if s.noteAccess[i].NoteID == access.NoteID && s.noteAccess[i].UserID == access.UserID {
+			s.noteAccess[i].Role = access.Role
+			s.noteAccess[i].GrantedBy = access.GrantedBy
+			s.noteAccess[i].DateGranted = access.DateGranted
+			updated = true
+		}
+	}
+	if !updated {
+		return errNotFound
+	}
+	return nil
+}
+
+func (s *memStore) RemoveAccess(noteID int, userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	kept := s.noteAccess[:0]
+	for _, access := range s.noteAccess {
+		if access.NoteID != noteID || access.UserID != userID {
+			kept = append(kept, access)
+		}
+	}
+	if len(kept) == len(s.noteAccess) {
+		return errNotFound
+	}
+	s.noteAccess = kept
+	return nil
+}
+
+func (s *memStore) GetSharedSettings(ownerID int) ([]SharedSettings, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var settings []SharedSettings
+	for _, setting := range s.sharedSettings {
+		if setting.OwnerID == ownerID {
+			settings = append(settings, setting)
+		}
+	}
+	//Same order as the Postgres store
+	sort.SliceStable(settings, func(i, j int) bool {
+		return settings[i].Name < settings[j].Name
+	})
+	return settings, nil
+}
+
+func (s *memStore) AddSharedSetting(setting SharedSettings) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.lastSharedSettingsID++
+	setting.SharedSettingsID = s.lastSharedSettingsID
+	s.sharedSettings = append(s.sharedSettings, setting)
+	return nil
+}
+
+func (s *memStore) CreateSession(session Session) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sessions[session.SessionID] = session
+	return nil
+}
+
+func (s *memStore) GetSession(sessionID string) (Session, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	session, found := s.sessions[sessionID]
+	if !found {
+		return Session{}, errNotFound
+	}
+	return session, nil
+}
+
+func (s *memStore) TouchSession(sessionID string, lastSeen time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if session, found := s.sessions[sessionID]; found {
+		session.LastSeen = lastSeen
+		s.sessions[sessionID] = session
+	}
+	return nil
+}
+
+func (s *memStore) DeleteSession(sessionID string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.sessions, sessionID)
+	return nil
+}
+
+func (s *memStore) DeleteUserSessions(userID int) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, session := range s.sessions {
+		if session.UserID == userID {
+			delete(s.sessions, id)
+		}
+	}
+	return nil
+}
+
+func (s *memStore) DeleteExpiredSessions(idleBefore time.Time, createdBefore time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, session := range s.sessions {
+		if session.LastSeen.Before(idleBefore) || session.DateCreated.Before(createdBefore) {
+			delete(s.sessions, id)
+		}
+	}
+	return nil
+}
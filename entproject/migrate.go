@@ -0,0 +1,324 @@
+package main
+
+import (
+	"database/sql"
+	"embed"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+//Schema changes, applied in order. Each version has an up script and a down script that undoes it
+//
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+//Migration file names look like 0002_add_tags.up.sql
+var migrationFileName = regexp.MustCompile(`^([0-9]+)_([a-z0-9_]+)\.(up|down)\.sql$`)
+
+//One schema change
+type migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+//Reads every migration in a directory and checks the versions run 1, 2, 3... with an up and down script each
+func loadMigrations(fsys fs.FS, dir string) ([]migration, error) {
+	entries, err := fs.ReadDir(fsys, dir)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int]*migration)
+	for _, entry := range entries {
+		match := migrationFileName.FindStringSubmatch(entry.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migration file %s is not named like 0001_name.up.sql", entry.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		contents, err := fs.ReadFile(fsys, path.Join(dir, entry.Name()))
+		if err != nil {
+			return nil, err
+		}
+
+		m, found := byVersion[version]
+		if !found {
+			m = &migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		}
+		if m.Name != match[2] {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, m.Name, match[2])
+		}
+		if match[3] == "up" {
+			m.Up = string(contents)
+		} else {
+			m.Down = string(contents)
+		}
+	}
+
+	var migrations []migration
+	for _, m := range byVersion {
+		if m.Up == "" || m.Down == "" {
+			return nil, fmt.Errorf("migration %d (%s) needs both an up and a down script", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	for i, m := range migrations {
+		if m.Version != i+1 {
+			return nil, fmt.Errorf("migration %d is missing", i+1)
+		}
+	}
+	return migrations, nil
+}
+
+//Applies and rolls back migrations on a database, recording what has been applied in schema_migrations
+type migrator struct {
+	db         *sql.DB
+	migrations []migration
+}
+
+//Builds a migrator for the migrations embedded in the binary
+func newMigrator(db *sql.DB) (*migrator, error) {
+	migrations, err := loadMigrations(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	return &migrator{db: db, migrations: migrations}, nil
+}
+
+//The newest schema version this build knows about
+func (m *migrator) latest() int {
+	return len(m.migrations)
+}
+
+//Creates schema_migrations if it is not there yet. Only up needs to, so checking the schema at startup never writes
+//to the database and works for a user that can only read it
+func (m *migrator) createTable() error {
+	_, err := m.db.Exec(`CREATE TABLE IF NOT EXISTS schema_migrations (
+		Version INT PRIMARY KEY,
+		Name VARCHAR(255) NOT NULL,
+		AppliedAt TIMESTAMPTZ NOT NULL DEFAULT now()
+	);`)
+	return err
+}
+
+//Gets the versions already applied to the database, oldest first. A database without schema_migrations has none
+func (m *migrator) applied() ([]int, error) {
+	var table sql.NullString
+	err := m.db.QueryRow(`SELECT to_regclass('schema_migrations')`).Scan(&table)
+	if err != nil {
+		return nil, err
+	}
+	if !table.Valid {
+		return nil, nil
+	}
+
+	rows, err := m.db.Query(`SELECT Version FROM schema_migrations ORDER BY Version`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var versions []int
+	for rows.Next() {
+		var version int
+		err = rows.Scan(&version)
+		if err != nil {
+			return nil, err
+		}
+		versions = append(versions, version)
+	}
+	return versions, rows.Err()
+}
+
+//Gets the migrations that have not been applied yet, oldest first
+func (m *migrator) pending() ([]migration, error) {
+	versions, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+	done := make(map[int]bool)
+	for _, version := range versions {
+		done[version] = true
+	}
+
+	var pending []migration
+	for _, mig := range m.migrations {
+		if !done[mig.Version] {
+			pending = append(pending, mig)
+		}
+	}
+	return pending, nil
+}
+
+//Runs one script and records the change in schema_migrations in a single transaction, so a failed script leaves
+//nothing behind
+func (m *migrator) run(script string, record string, args ...interface{}) error {
+	tx, err := m.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(script)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(record, args...)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+//Applies every pending migration in order and returns the ones applied
+func (m *migrator) up() ([]migration, error) {
+	err := m.createTable()
+	if err != nil {
+		return nil, err
+	}
+	pending, err := m.pending()
+	if err != nil {
+		return nil, err
+	}
+	for i, mig := range pending {
+		err = m.run(mig.Up, `INSERT INTO schema_migrations (Version, Name) VALUES ($1, $2)`, mig.Version, mig.Name)
+		if err != nil {
+			return pending[:i], fmt.Errorf("migration %d (%s): %v", mig.Version, mig.Name, err)
+		}
+	}
+	return pending, nil
+}
+
+//Rolls back the most recently applied migrations, newest first, and returns the ones rolled back
+func (m *migrator) down(steps int) ([]migration, error) {
+	versions, err := m.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	var rolledBack []migration
+	for i := len(versions) - 1; i >= 0 && len(rolledBack) < steps; i-- {
+		version := versions[i]
+		if version > m.latest() {
+			return rolledBack, fmt.Errorf("migration %d was applied by a newer build and can not be rolled back by this one", version)
+		}
+		mig := m.migrations[version-1]
+		err = m.run(mig.Down, `DELETE FROM schema_migrations WHERE Version = $1`, mig.Version)
+		if err != nil {
+			return rolledBack, fmt.Errorf("rolling back migration %d (%s): %v", mig.Version, mig.Name, err)
+		}
+		rolledBack = append(rolledBack, mig)
+	}
+	return rolledBack, nil
+}
+
+//Returns an error if the database is missing migrations this build needs
+func (m *migrator) check() error {
+	pending, err := m.pending()
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return fmt.Errorf("database schema is missing %d migration(s), starting with %d (%s): run \"entproject migrate up\"", len(pending), pending[0].Version, pending[0].Name)
+	}
+
+	versions, err := m.applied()
+	if err != nil {
+		return err
+	}
+	if len(versions) > 0 && versions[len(versions)-1] > m.latest() {
+		logWarn("database schema is at version %d but this build only knows up to version %d", versions[len(versions)-1], m.latest())
+	}
+	return nil
+}
+
+//Prints every migration and whether it has been applied
+func (m *migrator) status(out io.Writer) error {
+	pending, err := m.pending()
+	if err != nil {
+		return err
+	}
+	isPending := make(map[int]bool)
+	for _, mig := range pending {
+		isPending[mig.Version] = true
+	}
+
+	for _, mig := range m.migrations {
+		state := "applied"
+		if isPending[mig.Version] {
+			state = "pending"
+		}
+		fmt.Fprintf(out, "%04d %-30s %s\n", mig.Version, mig.Name, state)
+	}
+	return nil
+}
+
+//Usage of the migrate subcommand
+const migrateUsage = `usage: entproject migrate [flags] up | down [n] | status
+  up       apply every pending migration
+  down     roll back the last n migrations, 1 if n is not given
+  status   list every migration and whether it has been applied
+Flags are the same as the server's, only the database settings are used`
+
+//Runs "entproject migrate". args are the arguments after "migrate"
+func runMigrate(args []string, getenv func(string) string, out io.Writer) error {
+	cfg, rest, err := parseConfig(args, getenv, out)
+	if err != nil {
+		return err
+	}
+	if len(rest) == 0 {
+		return errors.New(migrateUsage)
+	}
+	if cfg.DSN == "" {
+		return errors.New("database connection string is missing (set -dsn or NOTEAPP_DSN)")
+	}
+
+	db, err := sql.Open("postgres", cfg.DSN)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+	m, err := newMigrator(db)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case rest[0] == "up" && len(rest) == 1:
+		applied, err := m.up()
+		for _, mig := range applied {
+			fmt.Fprintf(out, "applied %04d %s\n", mig.Version, mig.Name)
+		}
+		if err == nil && len(applied) == 0 {
+			fmt.Fprintln(out, "database schema is up to date")
+		}
+		return err
+	case rest[0] == "down" && len(rest) <= 2:
+		steps := 1
+		if len(rest) == 2 {
+			steps, err = strconv.Atoi(rest[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("number of migrations to roll back must be a positive number, not %q", rest[1])
+			}
+		}
+		rolledBack, err := m.down(steps)
+		for _, mig := range rolledBack {
+			fmt.Fprintf(out, "rolled back %04d %s\n", mig.Version, mig.Name)
+		}
+		return err
+	case rest[0] == "status" && len(rest) == 1:
+		return m.status(out)
+	}
+	return errors.New(migrateUsage)
+}
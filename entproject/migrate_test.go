@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"database/sql"
+	"io"
+	"os"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestEmbeddedMigrations(t *testing.T) {
+	migrations, err := loadMigrations(migrationFiles, "migrations")
+	assert.NoError(t, err)
+	assert.NotEmpty(t, migrations)
+	for i, mig := range migrations {
+		assert.Equal(t, i+1, mig.Version)
+		assert.NotEmpty(t, mig.Up, "migration %d needs an up script", mig.Version)
+		assert.NotEmpty(t, mig.Down, "migration %d needs a down script", mig.Version)
+	}
+}
+
+func TestLoadMigrations(t *testing.T) {
+	fsys := fstest.MapFS{
+		"m/0002_second.up.sql":   {Data: []byte("up 2")},
+		"m/0002_second.down.sql": {Data: []byte("down 2")},
+		"m/0001_first.up.sql":    {Data: []byte("up 1")},
+		"m/0001_first.down.sql":  {Data: []byte("down 1")},
+	}
+	migrations, err := loadMigrations(fsys, "m")
+	assert.NoError(t, err)
+	if assert.Len(t, migrations, 2) {
+		assert.Equal(t, migration{Version: 1, Name: "first", Up: "up 1", Down: "down 1"}, migrations[0])
+		assert.Equal(t, "second", migrations[1].Name)
+	}
+
+	broken := map[string]fstest.MapFS{
+		"missing down script": {"m/0001_first.up.sql": {Data: []byte("up")}},
+		"badly named file":    {"m/first.sql": {Data: []byte("up")}},
+		"gap in versions": {
+			"m/0001_first.up.sql": {Data: []byte("up")}, "m/0001_first.down.sql": {Data: []byte("down")},
+			"m/0003_third.up.sql": {Data: []byte("up")}, "m/0003_third.down.sql": {Data: []byte("down")},
+		},
+		"two names for one version": {"m/0001_first.up.sql": {Data: []byte("up")}, "m/0001_other.down.sql": {Data: []byte("down")}},
+	}
+	for problem, fsys := range broken {
+		_, err := loadMigrations(fsys, "m")
+		assert.Error(t, err, problem)
+	}
+}
+
+func TestRunMigrateArguments(t *testing.T) {
+	//Bad arguments are rejected before connecting to the database
+	env := fakeEnv(map[string]string{"NOTEAPP_DSN": "dbname=unused"})
+	for _, args := range [][]string{{}, {"sideways"}, {"up", "2"}, {"down", "0"}, {"down", "many"}} {
+		err := runMigrate(args, env, io.Discard)
+		assert.Error(t, err, "migrate %v", args)
+	}
+
+	err := runMigrate([]string{"up"}, fakeEnv(nil), io.Discard)
+	if assert.Error(t, err) {
+		assert.True(t, strings.Contains(err.Error(), "connection string"))
+	}
+}
+
+func TestMigratorPostgres(t *testing.T) {
+	dsn := os.Getenv("NOTEAPP_TEST_DSN")
+	if dsn == "" {
+		t.Skip("NOTEAPP_TEST_DSN is not set")
+	}
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer db.Close()
+	m, err := newMigrator(db)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	//TestMain has already migrated the test database
+	assert.NoError(t, m.check())
+
+	//Checking the schema only reads, so it works for a user that can not change the database
+	readOnlyDSN := dsn + " default_transaction_read_only=on"
+	if strings.Contains(dsn, "://") {
+		separator := "?"
+		if strings.Contains(dsn, "?") {
+			separator = "&"
+		}
+		readOnlyDSN = dsn + separator + "default_transaction_read_only=on"
+	}
+	readOnly, err := sql.Open("postgres", readOnlyDSN)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer readOnly.Close()
+	assert.NoError(t, (&migrator{db: readOnly, migrations: m.migrations}).check())
+	applied, err := m.up()
+	assert.NoError(t, err)
+	assert.Empty(t, applied, "up() should do nothing when the schema is up to date")
+
+	//Rolling back the newest migration makes the schema behind, and applying it again catches up
+	rolledBack, err := m.down(1)
+	assert.NoError(t, err)
+	assert.Len(t, rolledBack, 1)
+	assert.Error(t, m.check(), "check() should fail when a migration is pending")
+
+	var status bytes.Buffer
+	assert.NoError(t, m.status(&status))
+	assert.Contains(t, status.String(), "pending")
+
+	applied, err = m.up()
+	assert.NoError(t, err)
+	assert.Equal(t, rolledBack, applied)
+	assert.NoError(t, m.check())
+}
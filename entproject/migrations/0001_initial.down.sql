@@ -0,0 +1,5 @@
+DROP TABLE IF EXISTS Session;
+DROP TABLE IF EXISTS SharedSettings;
+DROP TABLE IF EXISTS NoteAccess;
+DROP TABLE IF EXISTS Note;
+DROP TABLE IF EXISTS "User";
@@ -0,0 +1,49 @@
+-- Tables the app used to create at startup. IF NOT EXISTS lets databases created before migrations were added adopt
+-- this version without losing data.
+CREATE TABLE IF NOT EXISTS "User"(
+	UserID SERIAL PRIMARY KEY,
+	GivenName VARCHAR(30),
+	FamilyName VARCHAR(30),
+	Password VARCHAR(255)
+);
+
+-- Widens the password column on databases created before passwords were hashed
+ALTER TABLE "User" ALTER COLUMN Password TYPE VARCHAR(255);
+
+CREATE TABLE IF NOT EXISTS Note(
+	NoteID SERIAL PRIMARY KEY,
+	UserID INT,
+	Title VARCHAR(30),
+	Contents VARCHAR(1000),
+	DateCreated DATE,
+	DateUpdated DATE,
+	FOREIGN KEY (UserID) REFERENCES "User"(UserID)
+);
+
+CREATE TABLE IF NOT EXISTS NoteAccess (
+	NoteAccessID SERIAL PRIMARY KEY,
+	NoteID INT,
+	UserID INT,
+	Read BOOL,
+	Write BOOL,
+	FOREIGN KEY (NoteID) REFERENCES Note(NoteID),
+	FOREIGN KEY (UserID) REFERENCES "User"(UserID)
+);
+
+CREATE TABLE IF NOT EXISTS SharedSettings (
+	SharedSettingsID SERIAL PRIMARY KEY,
+	OwnerID INT,
+	SharedUserID INT,
+	Read BOOL,
+	Write BOOL,
+	Name VARCHAR(30),
+	FOREIGN KEY (OwnerID) REFERENCES "User"(UserID)
+);
+
+CREATE TABLE IF NOT EXISTS Session (
+	SessionID VARCHAR(64) PRIMARY KEY,
+	UserID INT NOT NULL,
+	DateCreated TIMESTAMPTZ NOT NULL,
+	LastSeen TIMESTAMPTZ NOT NULL,
+	FOREIGN KEY (UserID) REFERENCES "User"(UserID)
+);
@@ -0,0 +1,20 @@
+-- Every saved version of a note, so an update never loses the text it replaces
+CREATE TABLE NoteRevision (
+	RevisionID SERIAL PRIMARY KEY,
+	NoteID INT NOT NULL,
+	UserID INT NOT NULL,
+	Title VARCHAR(30),
+	Contents VARCHAR(1000),
+	DateCreated TIMESTAMPTZ NOT NULL,
+	FOREIGN KEY (NoteID) REFERENCES Note(NoteID),
+	FOREIGN KEY (UserID) REFERENCES "User"(UserID)
+);
+
+CREATE INDEX NoteRevision_NoteID ON NoteRevision (NoteID);
+
+-- Existing notes start their history from how they are now
+INSERT INTO NoteRevision (NoteID, UserID, Title, Contents, DateCreated)
+	SELECT NoteID, UserID, Title, Contents, COALESCE(DateUpdated, DateCreated, now())
+	FROM Note
+	WHERE UserID IS NOT NULL
+	ORDER BY NoteID;
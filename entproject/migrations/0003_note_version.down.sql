@@ -0,0 +1,2 @@
+ALTER TABLE NoteRevision DROP COLUMN Version;
+ALTER TABLE Note DROP COLUMN Version;
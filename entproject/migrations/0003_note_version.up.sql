@@ -0,0 +1,12 @@
+-- Counts the saves of each note so an editor can tell if someone else saved it since they loaded it
+ALTER TABLE Note ADD COLUMN Version INT NOT NULL DEFAULT 1;
+ALTER TABLE NoteRevision ADD COLUMN Version INT NOT NULL DEFAULT 1;
+
+-- Numbers the revisions already saved, oldest first, and starts each note at its newest revision
+UPDATE NoteRevision SET Version = numbered.Version
+	FROM (SELECT RevisionID, ROW_NUMBER() OVER (PARTITION BY NoteID ORDER BY RevisionID) AS Version FROM NoteRevision) numbered
+	WHERE NoteRevision.RevisionID = numbered.RevisionID;
+
+UPDATE Note SET Version = latest.Version
+	FROM (SELECT NoteID, MAX(Version) AS Version FROM NoteRevision GROUP BY NoteID) latest
+	WHERE Note.NoteID = latest.NoteID;
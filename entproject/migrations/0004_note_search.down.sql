@@ -0,0 +1,2 @@
+DROP INDEX IF EXISTS Note_Search;
+ALTER TABLE Note DROP COLUMN Search;
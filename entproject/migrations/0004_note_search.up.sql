@@ -0,0 +1,7 @@
+-- Words in each note for full-text search. Title words are weighted above contents words so they rank higher
+ALTER TABLE Note ADD COLUMN Search TSVECTOR GENERATED ALWAYS AS (
+	setweight(to_tsvector('english', coalesce(Title, '')), 'A') ||
+	setweight(to_tsvector('english', coalesce(Contents, '')), 'B')
+) STORED;
+
+CREATE INDEX Note_Search ON Note USING GIN (Search);
@@ -0,0 +1,2 @@
+DROP TABLE IF EXISTS NoteTag;
+DROP TABLE IF EXISTS Tag;
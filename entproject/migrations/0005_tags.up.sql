@@ -0,0 +1,15 @@
+-- Labels users put on notes. Names are stored lower case so the same tag is never saved twice
+CREATE TABLE Tag (
+	TagID SERIAL PRIMARY KEY,
+	Name VARCHAR(30) NOT NULL UNIQUE
+);
+
+CREATE TABLE NoteTag (
+	NoteID INT NOT NULL,
+	TagID INT NOT NULL,
+	PRIMARY KEY (NoteID, TagID),
+	FOREIGN KEY (NoteID) REFERENCES Note(NoteID),
+	FOREIGN KEY (TagID) REFERENCES Tag(TagID)
+);
+
+CREATE INDEX NoteTag_TagID ON NoteTag (TagID);
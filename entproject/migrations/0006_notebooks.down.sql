@@ -0,0 +1,3 @@
+DROP TABLE IF EXISTS NotebookAccess;
+ALTER TABLE Note DROP COLUMN IF EXISTS NotebookID;
+DROP TABLE IF EXISTS Notebook;
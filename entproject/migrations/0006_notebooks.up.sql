@@ -0,0 +1,29 @@
+-- Notebooks hold notes and other notebooks. A notebook without a parent is at the top level
+CREATE TABLE Notebook (
+	NotebookID SERIAL PRIMARY KEY,
+	UserID INT NOT NULL,
+	ParentID INT,
+	Name VARCHAR(30) NOT NULL,
+	DateCreated TIMESTAMPTZ NOT NULL,
+	FOREIGN KEY (UserID) REFERENCES "User"(UserID),
+	FOREIGN KEY (ParentID) REFERENCES Notebook(NotebookID)
+);
+
+CREATE INDEX Notebook_ParentID ON Notebook (ParentID);
+
+-- Notes that are not in a notebook have no NotebookID
+ALTER TABLE Note ADD COLUMN NotebookID INT REFERENCES Notebook(NotebookID);
+
+CREATE INDEX Note_NotebookID ON Note (NotebookID);
+
+-- Sharing a notebook shares every note in it and in the notebooks inside it
+CREATE TABLE NotebookAccess (
+	NotebookAccessID SERIAL PRIMARY KEY,
+	NotebookID INT NOT NULL,
+	UserID INT NOT NULL,
+	Read BOOL NOT NULL,
+	Write BOOL NOT NULL,
+	UNIQUE (NotebookID, UserID),
+	FOREIGN KEY (NotebookID) REFERENCES Notebook(NotebookID),
+	FOREIGN KEY (UserID) REFERENCES "User"(UserID)
+);
@@ -0,0 +1,13 @@
+-- Puts the old limits back. Anything longer is cut short to fit
+DROP INDEX IF EXISTS Note_Search;
+ALTER TABLE Note DROP COLUMN IF EXISTS Search;
+
+ALTER TABLE Note ALTER COLUMN Title TYPE VARCHAR(30) USING LEFT(Title, 30), ALTER COLUMN Contents TYPE VARCHAR(1000) USING LEFT(Contents, 1000);
+ALTER TABLE NoteRevision ALTER COLUMN Title TYPE VARCHAR(30) USING LEFT(Title, 30), ALTER COLUMN Contents TYPE VARCHAR(1000) USING LEFT(Contents, 1000);
+
+ALTER TABLE Note ADD COLUMN Search TSVECTOR GENERATED ALWAYS AS (
+	setweight(to_tsvector('english', coalesce(Title, '')), 'A') ||
+	setweight(to_tsvector('english', coalesce(Contents, '')), 'B')
+) STORED;
+
+CREATE INDEX Note_Search ON Note USING GIN (Search);
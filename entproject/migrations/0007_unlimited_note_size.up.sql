@@ -0,0 +1,14 @@
+-- Titles and contents were capped at 30 and 1000 characters. The server checks their length now instead.
+-- Search is generated from them, so it is dropped while their types change and added back after
+DROP INDEX IF EXISTS Note_Search;
+ALTER TABLE Note DROP COLUMN Search;
+
+ALTER TABLE Note ALTER COLUMN Title TYPE TEXT, ALTER COLUMN Contents TYPE TEXT;
+ALTER TABLE NoteRevision ALTER COLUMN Title TYPE TEXT, ALTER COLUMN Contents TYPE TEXT;
+
+ALTER TABLE Note ADD COLUMN Search TSVECTOR GENERATED ALWAYS AS (
+	setweight(to_tsvector('english', coalesce(Title, '')), 'A') ||
+	setweight(to_tsvector('english', coalesce(Contents, '')), 'B')
+) STORED;
+
+CREATE INDEX Note_Search ON Note USING GIN (Search);
@@ -0,0 +1,15 @@
+-- Files attached to notes. The files are kept in the blob store under BlobKey, only their details are kept here
+CREATE TABLE Attachment (
+	AttachmentID SERIAL PRIMARY KEY,
+	NoteID INT NOT NULL,
+	UserID INT NOT NULL,
+	FileName TEXT NOT NULL,
+	ContentType TEXT NOT NULL,
+	Size BIGINT NOT NULL,
+	BlobKey TEXT NOT NULL UNIQUE,
+	DateCreated TIMESTAMPTZ NOT NULL,
+	FOREIGN KEY (NoteID) REFERENCES Note(NoteID),
+	FOREIGN KEY (UserID) REFERENCES "User"(UserID)
+);
+
+CREATE INDEX Attachment_NoteID ON Attachment (NoteID);
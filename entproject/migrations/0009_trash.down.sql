@@ -0,0 +1,8 @@
+-- Notes still in the trash were meant to be deleted, so they go rather than coming back
+DELETE FROM NoteAccess WHERE NoteID IN (SELECT NoteID FROM Note WHERE DateDeleted IS NOT NULL);
+DELETE FROM Attachment WHERE NoteID IN (SELECT NoteID FROM Note WHERE DateDeleted IS NOT NULL);
+DELETE FROM NoteTag WHERE NoteID IN (SELECT NoteID FROM Note WHERE DateDeleted IS NOT NULL);
+DELETE FROM NoteRevision WHERE NoteID IN (SELECT NoteID FROM Note WHERE DateDeleted IS NOT NULL);
+DELETE FROM Note WHERE DateDeleted IS NOT NULL;
+DROP INDEX IF EXISTS Note_DateDeleted;
+ALTER TABLE Note DROP COLUMN IF EXISTS DateDeleted;
@@ -0,0 +1,5 @@
+-- Deleted notes go to their owners trash first. A note is in the trash when DateDeleted is set, and is purged for good
+-- once it has been there longer than the retention period
+ALTER TABLE Note ADD COLUMN DateDeleted TIMESTAMPTZ;
+
+CREATE INDEX Note_DateDeleted ON Note (DateDeleted) WHERE DateDeleted IS NOT NULL;
@@ -0,0 +1,12 @@
+-- Puts the read and write flags back. Commenters become readers, and co-owners become writers
+ALTER TABLE NoteAccess ADD COLUMN Read BOOL NOT NULL DEFAULT true, ADD COLUMN Write BOOL NOT NULL DEFAULT false;
+UPDATE NoteAccess SET Write = Role IN ('editor', 'co-owner');
+ALTER TABLE NoteAccess ALTER COLUMN Read DROP DEFAULT, ALTER COLUMN Write DROP DEFAULT, DROP COLUMN IF EXISTS Role;
+
+ALTER TABLE NotebookAccess ADD COLUMN Read BOOL NOT NULL DEFAULT true, ADD COLUMN Write BOOL NOT NULL DEFAULT false;
+UPDATE NotebookAccess SET Write = Role IN ('editor', 'co-owner');
+ALTER TABLE NotebookAccess ALTER COLUMN Read DROP DEFAULT, ALTER COLUMN Write DROP DEFAULT, DROP COLUMN IF EXISTS Role;
+
+ALTER TABLE SharedSettings ADD COLUMN Read BOOL NOT NULL DEFAULT true, ADD COLUMN Write BOOL NOT NULL DEFAULT false;
+UPDATE SharedSettings SET Write = Role IN ('editor', 'co-owner');
+ALTER TABLE SharedSettings ALTER COLUMN Read DROP DEFAULT, ALTER COLUMN Write DROP DEFAULT, DROP COLUMN IF EXISTS Role;
@@ -0,0 +1,16 @@
+-- Notes and notebooks are shared with a named role instead of read and write flags. Rows without read access gave no
+-- access at all, so they are dropped. Owners are not stored here, they are the UserID on the note
+DELETE FROM NoteAccess WHERE Read IS NOT TRUE;
+ALTER TABLE NoteAccess ADD COLUMN Role TEXT NOT NULL DEFAULT 'viewer' CHECK (Role IN ('viewer', 'commenter', 'editor', 'co-owner'));
+UPDATE NoteAccess SET Role = 'editor' WHERE Write;
+ALTER TABLE NoteAccess ALTER COLUMN Role DROP DEFAULT, DROP COLUMN Read, DROP COLUMN Write;
+
+DELETE FROM NotebookAccess WHERE Read IS NOT TRUE;
+ALTER TABLE NotebookAccess ADD COLUMN Role TEXT NOT NULL DEFAULT 'viewer' CHECK (Role IN ('viewer', 'commenter', 'editor', 'co-owner'));
+UPDATE NotebookAccess SET Role = 'editor' WHERE Write;
+ALTER TABLE NotebookAccess ALTER COLUMN Role DROP DEFAULT, DROP COLUMN Read, DROP COLUMN Write;
+
+DELETE FROM SharedSettings WHERE Read IS NOT TRUE;
+ALTER TABLE SharedSettings ADD COLUMN Role TEXT NOT NULL DEFAULT 'viewer' CHECK (Role IN ('viewer', 'commenter', 'editor', 'co-owner'));
+UPDATE SharedSettings SET Role = 'editor' WHERE Write;
+ALTER TABLE SharedSettings ALTER COLUMN Role DROP DEFAULT, DROP COLUMN Read, DROP COLUMN Write;
@@ -0,0 +1 @@
+ALTER TABLE NoteAccess DROP COLUMN GrantedBy, DROP COLUMN DateGranted;
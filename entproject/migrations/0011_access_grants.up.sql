@@ -0,0 +1,3 @@
+-- Records who shared a note with each user, or last changed their role, and when. Access given before this was
+-- recorded has neither
+ALTER TABLE NoteAccess ADD COLUMN GrantedBy INT REFERENCES "User"(UserID), ADD COLUMN DateGranted TIMESTAMPTZ;
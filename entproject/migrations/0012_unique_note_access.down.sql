@@ -0,0 +1,3 @@
+-- Lets a note be shared with the same user more than once again. The rows merged by the up migration are not brought
+-- back
+ALTER TABLE NoteAccess DROP CONSTRAINT IF EXISTS NoteAccess_NoteID_UserID_key;
@@ -0,0 +1,10 @@
+-- A note can only be shared with each user once, and sharing it again changes their role. Sharing used to add another
+-- row every time, so for each user only the row with the most access is kept, the newest when they are equal. Rows
+-- giving owners access to their own notes did nothing and are dropped too
+DELETE FROM NoteAccess a USING NoteAccess b
+WHERE a.NoteID = b.NoteID AND a.UserID = b.UserID AND a.NoteAccessID <> b.NoteAccessID
+	AND (array_position(ARRAY['viewer', 'commenter', 'editor', 'co-owner'], a.Role) < array_position(ARRAY['viewer', 'commenter', 'editor', 'co-owner'], b.Role)
+		OR (a.Role = b.Role AND a.NoteAccessID < b.NoteAccessID));
+DELETE FROM NoteAccess USING Note WHERE NoteAccess.NoteID = Note.NoteID AND NoteAccess.UserID = Note.UserID;
+
+ALTER TABLE NoteAccess ADD CONSTRAINT NoteAccess_NoteID_UserID_key UNIQUE (NoteID, UserID);
@@ -0,0 +1,2 @@
+-- Goes back to keeping only the day. The times are lost
+ALTER TABLE Note ALTER COLUMN DateCreated TYPE DATE, ALTER COLUMN DateUpdated TYPE DATE;
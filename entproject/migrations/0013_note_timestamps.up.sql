@@ -0,0 +1,3 @@
+-- Notes only kept the day they were created and last updated. They keep the time too now. Notes saved before this
+-- are given midnight on their day
+ALTER TABLE Note ALTER COLUMN DateCreated TYPE TIMESTAMPTZ, ALTER COLUMN DateUpdated TYPE TIMESTAMPTZ;
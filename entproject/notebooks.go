@@ -0,0 +1,414 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+//Longest a notebook name can be, the size of the Name column
+const maxNotebookNameLength = 30
+
+//A notebook with everything a user sees when they open it
+type notebookContents struct {
+	Notebook
+	//The notebooks above this one that the user can read, top first, ending with this notebook
+	Trail     []Notebook `json:"trail"`
+	Notebooks []Notebook `json:"notebooks"`
+	Notes     []Note     `json:"notes"`
+	//The role the user has on the notes in the notebook
+	Role     Role `json:"role"`
+	CanWrite bool `json:"canWrite"`
+}
+
+//Walks up from a notebook to the top level, working out the role a user has on the notes in it. Owning a notebook,
+//or having it shared with you, counts for every notebook inside it. trail holds the notebooks the user can read, top
+//first, ending with the notebook itself
+func notebookTrail(notebookID int, userID int) (trail []Notebook, role Role, err error) {
+	var path []Notebook
+	//Guards against a loop in the parents, which the handlers never make
+	seen := make(map[int]bool)
+	for notebookID != 0 && !seen[notebookID] {
+		seen[notebookID] = true
+		notebook, err := store.GetNotebook(notebookID)
+		if err == errNotFound {
+			break
+		}
+		if err != nil {
+			return nil, "", err
+		}
+		path = append([]Notebook{notebook}, path...)
+		notebookID = notebook.ParentID
+	}
+
+	for _, notebook := range path {
+		if notebook.UserID == userID {
+			role = roleOwner
+		} else {
+			access, err := store.GetUserNotebookAccess(notebook.NotebookID, userID)
+			if err != nil && err != errNotFound {
+				return nil, "", err
+			}
+			if err == nil {
+				role = maxRole(role, access.Role)
+			}
+		}
+		//Roles only ever grow going down, so once a notebook can be read everything below it can be too
+		if role.can(capView) {
+			trail = append(trail, notebook)
+		}
+	}
+	return trail, role, nil
+}
+
+//Gets the role a user has on the notes in a notebook through it and the notebooks it is inside. A notebookID of 0
+//gives no role
+func notebookRoleFor(notebookID int, userID int) (Role, error) {
+	_, role, err := notebookTrail(notebookID, userID)
+	return role, err
+}
+
+//Loads a notebook the user can read along with what is in it. Returns a 404 error if it does not exist or has not
+//been shared with them
+func readableNotebook(notebookID int, userID int) (notebookContents, error) {
+	notebook, err := store.GetNotebook(notebookID)
+	if err != nil && err != errNotFound {
+		return notebookContents{}, err
+	}
+	var contents notebookContents
+	if err == nil {
+		contents.Notebook = notebook
+		contents.Trail, contents.Role, err = notebookTrail(notebookID, userID)
+		if err != nil {
+			return notebookContents{}, err
+		}
+		contents.CanWrite = contents.Role.can(capEdit)
+	}
+	if !contents.Role.can(capView) {
+		return notebookContents{}, notFound("That notebook does not exist or has not been shared with you.")
+	}
+
+	contents.Notebooks, err = store.GetChildNotebooks(notebookID)
+	if err != nil {
+		return notebookContents{}, err
+	}
+	contents.Notes, err = store.GetNotebookNotes(notebookID)
+	if err != nil {
+		return notebookContents{}, err
+	}
+	//Empty lists rather than null in JSON
+	if contents.Notebooks == nil {
+		contents.Notebooks = []Notebook{}
+	}
+	if contents.Notes == nil {
+		contents.Notes = []Note{}
+	}
+	return contents, nil
+}
+
+//Loads a notebook and checks the user owns it. Returns a 404 error if they can not see it, or a 403 error if they
+//can see it but do not own it
+func ownedNotebook(notebookID int, userID int) (Notebook, error) {
+	contents, err := readableNotebook(notebookID, userID)
+	if err != nil {
+		return Notebook{}, err
+	}
+	if contents.UserID != userID {
+		return Notebook{}, forbidden("Only the owner of a notebook can do this.")
+	}
+	return contents.Notebook, nil
+}
+
+//Tidies up a notebook name and checks it fits
+func parseNotebookName(name string) (string, error) {
+	name = strings.Join(strings.Fields(name), " ")
+	if name == "" {
+		return "", badRequest("A notebook needs a name.")
+	}
+	if utf8.RuneCountInString(name) > maxNotebookNameLength {
+		return "", badRequest("Notebook names can be at most " + strconv.Itoa(maxNotebookNameLength) + " characters long.")
+	}
+	return name, nil
+}
+
+//Reads an optional notebook ID typed into a form. Blank or 0 means no notebook
+func parseNotebookID(value string) (int, error) {
+	if value == "" || value == "0" {
+		return 0, nil
+	}
+	notebookID, err := parseID(value)
+	if err != nil {
+		return 0, badRequest("The notebook should be a number.")
+	}
+	return notebookID, nil
+}
+
+//Creates a notebook for a user, inside parentID if it is not 0. Notebooks can only be made inside notebooks the user
+//owns
+func newNotebook(userID int, name string, parentID int) (Notebook, error) {
+	name, err := parseNotebookName(name)
+	if err != nil {
+		return Notebook{}, err
+	}
+	if parentID != 0 {
+		_, err = ownedNotebook(parentID, userID)
+		if err != nil {
+			return Notebook{}, err
+		}
+	}
+	return store.CreateNotebook(Notebook{UserID: userID, ParentID: parentID, Name: name, DateCreated: time.Now()})
+}
+
+//Deletes a notebook the user owns, as long as nothing is in it. Returns the deleted notebook
+func deleteEmptyNotebook(userID int, notebookID int) (Notebook, error) {
+	notebook, err := ownedNotebook(notebookID, userID)
+	if err != nil {
+		return notebook, err
+	}
+	children, err := store.GetChildNotebooks(notebookID)
+	if err != nil {
+		return notebook, err
+	}
+	notes, err := store.GetNotebookNotes(notebookID)
+	if err != nil {
+		return notebook, err
+	}
+	if len(children) > 0 || len(notes) > 0 {
+		return notebook, badRequest("Only empty notebooks can be deleted. Move its notes out and delete the notebooks inside it first.")
+	}
+	return notebook, store.DeleteNotebook(notebookID)
+}
+
+//Shares a notebook the user owns with another user, or changes the role they already have
+func shareNotebookWith(userID int, notebookID int, sharedUserID int, role Role) (NotebookAccess, error) {
+	_, err := ownedNotebook(notebookID, userID)
+	if err != nil {
+		return NotebookAccess{}, err
+	}
+	if sharedUserID == userID {
+		return NotebookAccess{}, badRequest("You already own this notebook.")
+	}
+	_, err = store.GetUser(sharedUserID)
+	if err == errNotFound {
+		return NotebookAccess{}, badRequest("That user does not exist.")
+	}
+	if err != nil {
+		return NotebookAccess{}, err
+	}
+	err = store.SetNotebookAccess(NotebookAccess{NotebookID: notebookID, UserID: sharedUserID, Role: role})
+	if err != nil {
+		return NotebookAccess{}, err
+	}
+	return store.GetUserNotebookAccess(notebookID, sharedUserID)
+}
+
+//Stops sharing a notebook the user owns with another user. They lose the role it gave them on every note in it, but
+//keep any role given on a note itself
+func revokeNotebookAccess(userID int, notebookID int, sharedUserID int) error {
+	_, err := ownedNotebook(notebookID, userID)
+	if err != nil {
+		return err
+	}
+	err = store.RemoveNotebookAccess(notebookID, sharedUserID)
+	if err == errNotFound {
+		return notFound("That notebook has not been shared with that user.")
+	}
+	return err
+}
+
+//Moves a note the user owns into one of their notebooks, or out of its notebook when notebookID is 0
+func moveNoteTo(userID int, noteID int, notebookID int) error {
+	_, _, err := authoriseNote(noteID, userID, capMove)
+	if err != nil {
+		return err
+	}
+	if notebookID != 0 {
+		_, err = ownedNotebook(notebookID, userID)
+		if err != nil {
+			return err
+		}
+	}
+	return store.MoveNote(noteID, notebookID)
+}
+
+//Lists the logged in users top level notebooks and the notebooks shared with them
+func listNotebooks(w http.ResponseWriter, r *http.Request) error {
+	//Checks if a user is already logged in
+	session, err := requireSession(w, r)
+	if session == nil {
+		return err
+	}
+	owned, err := store.GetUserNotebooks(session.UserID)
+	if err != nil {
+		return err
+	}
+	var topLevel []Notebook
+	for _, notebook := range owned {
+		if notebook.ParentID == 0 {
+			topLevel = append(topLevel, notebook)
+		}
+	}
+	shared, err := store.GetSharedNotebooks(session.UserID)
+	if err != nil {
+		return err
+	}
+
+	t, err := parseTemplate("notebooks.html")
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, struct {
+		Notebooks []Notebook
+		Shared    []Notebook
+	}{topLevel, shared})
+}
+
+//Shows the notebooks and notes inside a notebook, with a breadcrumb trail back up to the top
+func viewNotebook(w http.ResponseWriter, r *http.Request) error {
+	//Checks if a user is already logged in
+	session, err := requireSession(w, r)
+	if session == nil {
+		return err
+	}
+	contents, err := readableNotebook(routeID(r, "NotebookID"), session.UserID)
+	if err != nil {
+		return err
+	}
+
+	t, err := parseTemplate("notebook.html")
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, struct {
+		notebookContents
+		Owner bool
+	}{contents, contents.UserID == session.UserID})
+}
+
+//Creates a notebook from the name and parent in the form, then shows it
+func createNotebook(w http.ResponseWriter, r *http.Request) error {
+	//Checks if a user is already logged in
+	session, err := requireSession(w, r)
+	if session == nil {
+		return err
+	}
+	parentID, err := parseNotebookID(r.FormValue("parent"))
+	if err != nil {
+		return err
+	}
+	notebook, err := newNotebook(session.UserID, r.FormValue("name"), parentID)
+	if err != nil {
+		return err
+	}
+	http.Redirect(w, r, "/Notebooks/"+strconv.Itoa(notebook.NotebookID), http.StatusSeeOther)
+	return nil
+}
+
+//Deletes an empty notebook, then goes back to the notebook it was in
+func deleteNotebook(w http.ResponseWriter, r *http.Request) error {
+	//Checks if a user is already logged in
+	session, err := requireSession(w, r)
+	if session == nil {
+		return err
+	}
+	notebook, err := deleteEmptyNotebook(session.UserID, routeID(r, "NotebookID"))
+	if err != nil {
+		return err
+	}
+	if notebook.ParentID != 0 {
+		http.Redirect(w, r, "/Notebooks/"+strconv.Itoa(notebook.ParentID), http.StatusSeeOther)
+		return nil
+	}
+	http.Redirect(w, r, "/Notebooks/", http.StatusSeeOther)
+	return nil
+}
+
+//Shares a notebook, and every note in it, with another user
+func shareNotebook(w http.ResponseWriter, r *http.Request) error {
+	//Checks if a user is already logged in
+	session, err := requireSession(w, r)
+	if session == nil {
+		return err
+	}
+	notebookID := routeID(r, "NotebookID")
+	notebook, err := ownedNotebook(notebookID, session.UserID)
+	if err != nil {
+		return err
+	}
+
+	//When share data is submitted
+	if r.Method == "POST" {
+		userID, err := parseID(r.FormValue("userid"))
+		if err != nil {
+			return badRequest("The User ID to share with should be a number.")
+		}
+		role, err := formRole(r)
+		if err != nil {
+			return err
+		}
+		_, err = shareNotebookWith(session.UserID, notebookID, userID, role)
+		if err != nil {
+			return err
+		}
+		http.Redirect(w, r, "/Notebooks/Share/"+strconv.Itoa(notebookID), http.StatusSeeOther)
+		return nil
+	}
+
+	accessRows, err := store.GetNotebookAccess(notebookID)
+	if err != nil {
+		return err
+	}
+	t, err := parseTemplate("shareNotebook.html")
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, struct {
+		Notebook
+		Access []NotebookAccess
+	}{notebook, accessRows})
+}
+
+//Stops sharing a notebook with the user picked on its share page
+func revokeNotebookShare(w http.ResponseWriter, r *http.Request) error {
+	//Checks if a user is already logged in
+	session, err := requireSession(w, r)
+	if session == nil {
+		return err
+	}
+	notebookID := routeID(r, "NotebookID")
+	sharedUserID, err := parseID(r.FormValue("userid"))
+	if err != nil {
+		return badRequest("Pick a user the notebook is shared with.")
+	}
+	err = revokeNotebookAccess(session.UserID, notebookID, sharedUserID)
+	if err != nil {
+		return err
+	}
+	http.Redirect(w, r, "/Notebooks/Share/"+strconv.Itoa(notebookID), http.StatusSeeOther)
+	return nil
+}
+
+//Moves a note into the notebook picked in the form, or out of its notebook
+func moveNote(w http.ResponseWriter, r *http.Request) error {
+	//Checks if a user is already logged in
+	session, err := requireSession(w, r)
+	if session == nil {
+		return err
+	}
+	notebookID, err := parseNotebookID(r.FormValue("notebook"))
+	if err != nil {
+		return err
+	}
+	err = moveNoteTo(session.UserID, routeID(r, "NoteID"), notebookID)
+	if err != nil {
+		return err
+	}
+	if notebookID != 0 {
+		http.Redirect(w, r, "/Notebooks/"+strconv.Itoa(notebookID), http.StatusSeeOther)
+		return nil
+	}
+	http.Redirect(w, r, "/Users/Notes/"+strconv.Itoa(session.UserID), http.StatusSeeOther)
+	return nil
+}
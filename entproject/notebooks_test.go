@@ -0,0 +1,288 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotebookTrail(t *testing.T) {
+	owner, err := registerUser("Trail", "Owner", "password")
+	assert.NoError(t, err)
+	friend, err := registerUser("Trail", "Friend", "password")
+	assert.NoError(t, err)
+	top, err := newNotebook(owner.UserID, "top", 0)
+	assert.NoError(t, err)
+	middle, err := newNotebook(owner.UserID, "middle", top.NotebookID)
+	assert.NoError(t, err)
+	bottom, err := newNotebook(owner.UserID, "bottom", middle.NotebookID)
+	assert.NoError(t, err)
+
+	trail, role, err := notebookTrail(bottom.NotebookID, owner.UserID)
+	assert.NoError(t, err)
+	assert.Equal(t, roleOwner, role)
+	assert.Equal(t, []Notebook{top, middle, bottom}, trail)
+
+	_, role, err = notebookTrail(bottom.NotebookID, friend.UserID)
+	assert.NoError(t, err)
+	assert.Empty(t, role)
+
+	_, err = shareNotebookWith(owner.UserID, middle.NotebookID, friend.UserID, roleViewer)
+	assert.NoError(t, err)
+	trail, role, err = notebookTrail(bottom.NotebookID, friend.UserID)
+	assert.NoError(t, err)
+	assert.Equal(t, roleViewer, role, "a role on a notebook should be inherited by the notebooks inside it")
+	assert.Equal(t, []Notebook{middle, bottom}, trail, "notebooks the user can not read should be left out of the trail")
+
+	//The larger of two roles wins
+	_, err = shareNotebookWith(owner.UserID, top.NotebookID, friend.UserID, roleEditor)
+	assert.NoError(t, err)
+	_, role, err = notebookTrail(bottom.NotebookID, friend.UserID)
+	assert.NoError(t, err)
+	assert.Equal(t, roleEditor, role)
+
+	role, err = notebookRoleFor(0, friend.UserID)
+	assert.NoError(t, err)
+	assert.Empty(t, role)
+}
+
+func TestNoteAccessThroughNotebook(t *testing.T) {
+	owner, err := registerUser("Inherit", "Owner", "password")
+	assert.NoError(t, err)
+	friend, err := registerUser("Inherit", "Friend", "password")
+	assert.NoError(t, err)
+	notebook, err := newNotebook(owner.UserID, "shared", 0)
+	assert.NoError(t, err)
+	inside, err := newNotebook(owner.UserID, "inside", notebook.NotebookID)
+	assert.NoError(t, err)
+	note, err := saveNewNote(owner.UserID, "title", "contents", "")
+	assert.NoError(t, err)
+	assert.NoError(t, moveNoteTo(owner.UserID, note.NoteID, inside.NotebookID))
+	note, err = store.GetNote(note.NoteID)
+	assert.NoError(t, err)
+
+	role, err := noteRoleFor(note, friend.UserID)
+	assert.NoError(t, err)
+	assert.Empty(t, role)
+
+	_, err = shareNotebookWith(owner.UserID, notebook.NotebookID, friend.UserID, roleEditor)
+	assert.NoError(t, err)
+	role, err = noteRoleFor(note, friend.UserID)
+	assert.NoError(t, err)
+	assert.Equal(t, roleEditor, role, "a role on a notebook should be given on the notes inside it")
+
+	//Moving the note out of the notebook takes away the role it gave
+	assert.NoError(t, moveNoteTo(owner.UserID, note.NoteID, 0))
+	note, err = store.GetNote(note.NoteID)
+	assert.NoError(t, err)
+	role, err = noteRoleFor(note, friend.UserID)
+	assert.NoError(t, err)
+	assert.Empty(t, role)
+}
+
+func TestNotebookRules(t *testing.T) {
+	owner, err := registerUser("Rules", "Owner", "password")
+	assert.NoError(t, err)
+	other, err := registerUser("Rules", "Other", "password")
+	assert.NoError(t, err)
+	notebook, err := newNotebook(owner.UserID, "  my   notes ", 0)
+	assert.NoError(t, err)
+	assert.Equal(t, "my notes", notebook.Name)
+
+	for _, name := range []string{"", "   ", "a name that is far too long for a notebook"} {
+		_, err = newNotebook(owner.UserID, name, 0)
+		assert.Equal(t, http.StatusBadRequest, errorCode(err), name)
+	}
+	_, err = newNotebook(other.UserID, "sneaky", notebook.NotebookID)
+	assert.Equal(t, http.StatusNotFound, errorCode(err), "other users should not see the notebook")
+	_, err = shareNotebookWith(owner.UserID, notebook.NotebookID, other.UserID, roleViewer)
+	assert.NoError(t, err)
+	_, err = newNotebook(other.UserID, "sneaky", notebook.NotebookID)
+	assert.Equal(t, http.StatusForbidden, errorCode(err), "only the owner can add notebooks inside one")
+	_, err = shareNotebookWith(owner.UserID, notebook.NotebookID, owner.UserID, roleViewer)
+	assert.Equal(t, http.StatusBadRequest, errorCode(err))
+	_, err = shareNotebookWith(owner.UserID, notebook.NotebookID, 999999999, roleViewer)
+	assert.Equal(t, http.StatusBadRequest, errorCode(err))
+
+	otherNote, err := saveNewNote(other.UserID, "theirs", "contents", "")
+	assert.NoError(t, err)
+	err = moveNoteTo(other.UserID, otherNote.NoteID, notebook.NotebookID)
+	assert.Equal(t, http.StatusForbidden, errorCode(err), "notes can only be moved into notebooks the user owns")
+	note, err := saveNewNote(owner.UserID, "mine", "contents", "")
+	assert.NoError(t, err)
+	err = moveNoteTo(other.UserID, note.NoteID, 0)
+	assert.Equal(t, http.StatusNotFound, errorCode(err))
+
+	assert.NoError(t, moveNoteTo(owner.UserID, note.NoteID, notebook.NotebookID))
+	_, err = deleteEmptyNotebook(owner.UserID, notebook.NotebookID)
+	assert.Equal(t, http.StatusBadRequest, errorCode(err), "notebooks with notes in them should not be deleted")
+	assert.NoError(t, moveNoteTo(owner.UserID, note.NoteID, 0))
+	_, err = deleteEmptyNotebook(other.UserID, notebook.NotebookID)
+	assert.Equal(t, http.StatusForbidden, errorCode(err))
+	_, err = deleteEmptyNotebook(owner.UserID, notebook.NotebookID)
+	assert.NoError(t, err)
+}
+
+//Gets the status an error would be shown with
+func errorCode(err error) int {
+	if err == nil {
+		return http.StatusOK
+	}
+	code, _ := errorResponse(err)
+	return code
+}
+
+func TestNotebookPages(t *testing.T) {
+	owner, err := registerUser("Notebook Page", "Owner", "password")
+	assert.NoError(t, err)
+	friend, err := registerUser("Notebook Page", "Friend", "password")
+	assert.NoError(t, err)
+
+	rec := formRequest("/Notebooks/Create/", owner.UserID, url.Values{"name": {"<b>work</b>"}})
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	location := rec.Header().Get("Location")
+	notebookID, err := strconv.Atoi(location[len("/Notebooks/"):])
+	assert.NoError(t, err)
+	rec = formRequest("/Notebooks/Create/", owner.UserID, url.Values{"name": {"projects"}, "parent": {strconv.Itoa(notebookID)}})
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	childPath := rec.Header().Get("Location")
+
+	note, err := saveNewNote(owner.UserID, "plan", "wildebeest", "")
+	assert.NoError(t, err)
+	rec = formRequest("/Notes/Move/"+strconv.Itoa(note.NoteID), owner.UserID, url.Values{"notebook": {childPath[len("/Notebooks/"):]}})
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	assert.Equal(t, childPath, rec.Header().Get("Location"))
+
+	rec = apiRequest("GET", childPath, owner.UserID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "wildebeest")
+	assert.Contains(t, rec.Body.String(), "&lt;b&gt;work&lt;/b&gt;</a> &gt; <a href=\""+childPath+"\">projects</a>", "the breadcrumbs should lead back to the top")
+	rec = apiRequest("GET", "/Notebooks/", owner.UserID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "&lt;b&gt;work&lt;/b&gt;")
+	assert.NotContains(t, rec.Body.String(), "projects", "only top level notebooks should be listed")
+
+	rec = apiRequest("GET", childPath, friend.UserID, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = formRequest("/Notebooks/Share/"+strconv.Itoa(notebookID), friend.UserID, url.Values{"userid": {strconv.Itoa(friend.UserID)}, "role": {"viewer"}})
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = formRequest("/Notebooks/Share/"+strconv.Itoa(notebookID), owner.UserID, url.Values{"userid": {strconv.Itoa(friend.UserID)}, "role": {"viewer"}})
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	rec = apiRequest("GET", "/Notebooks/Share/"+strconv.Itoa(notebookID), owner.UserID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "<td>"+strconv.Itoa(friend.UserID)+"</td>")
+
+	rec = apiRequest("GET", childPath, friend.UserID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "wildebeest")
+	assert.NotContains(t, rec.Body.String(), "Delete Notebook", "only the owner should be offered the owner actions")
+	rec = apiRequest("GET", "/Notes/History/"+strconv.Itoa(note.NoteID), friend.UserID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code, "notes in a shared notebook should be readable")
+	rec = apiRequest("GET", "/Notebooks/", friend.UserID, nil)
+	assert.Contains(t, rec.Body.String(), "&lt;b&gt;work&lt;/b&gt;")
+
+	//Revoking the share takes the notes in it away again. Only the owner can
+	rec = formRequest("/Notebooks/RevokeAccess/"+strconv.Itoa(notebookID), friend.UserID, url.Values{"userid": {strconv.Itoa(friend.UserID)}})
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = apiRequest("GET", "/Notebooks/Share/"+strconv.Itoa(notebookID), owner.UserID, nil)
+	assert.Contains(t, rec.Body.String(), `action="/Notebooks/RevokeAccess/`+strconv.Itoa(notebookID)+`"`)
+	rec = formRequest("/Notebooks/RevokeAccess/"+strconv.Itoa(notebookID), owner.UserID, url.Values{"userid": {strconv.Itoa(friend.UserID)}})
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	assert.Equal(t, "/Notebooks/Share/"+strconv.Itoa(notebookID), rec.Header().Get("Location"))
+	rec = apiRequest("GET", "/Notes/History/"+strconv.Itoa(note.NoteID), friend.UserID, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = formRequest("/Notebooks/RevokeAccess/"+strconv.Itoa(notebookID), owner.UserID, url.Values{"userid": {strconv.Itoa(friend.UserID)}})
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = formRequest("/Notebooks/RevokeAccess/"+strconv.Itoa(notebookID), owner.UserID, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = formRequest("/Notebooks/Delete/"+strconv.Itoa(notebookID), owner.UserID, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = formRequest("/Notes/Move/"+strconv.Itoa(note.NoteID), owner.UserID, url.Values{"notebook": {"0"}})
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	rec = formRequest("/Notebooks/Delete"+childPath[len("/Notebooks"):], owner.UserID, nil)
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	assert.Equal(t, location, rec.Header().Get("Location"), "deleting a notebook should go back to the one it was in")
+}
+
+func TestNotebookAPI(t *testing.T) {
+	owner, err := registerUser("Notebook API", "Owner", "password")
+	assert.NoError(t, err)
+	friend, err := registerUser("Notebook API", "Friend", "password")
+	assert.NoError(t, err)
+
+	rec := apiRequest("POST", "/api/v1/notebooks", owner.UserID, notebookRequest{Name: "recipes"})
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var notebook Notebook
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &notebook))
+	assert.Equal(t, "recipes", notebook.Name)
+	notebookPath := "/api/v1/notebooks/" + strconv.Itoa(notebook.NotebookID)
+	rec = apiRequest("POST", "/api/v1/notebooks", owner.UserID, notebookRequest{Name: "cakes", ParentID: notebook.NotebookID})
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	rec = apiRequest("POST", "/api/v1/notebooks", owner.UserID, notebookRequest{Name: ""})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	note, err := saveNewNote(owner.UserID, "scones", "flour", "")
+	assert.NoError(t, err)
+	rec = apiRequest("PUT", "/api/v1/notes/"+strconv.Itoa(note.NoteID)+"/notebook", owner.UserID, moveRequest{NotebookID: notebook.NotebookID})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var moved Note
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &moved))
+	assert.Equal(t, notebook.NotebookID, moved.NotebookID)
+	rec = apiRequest("PUT", "/api/v1/notes/"+strconv.Itoa(note.NoteID)+"/notebook", friend.UserID, moveRequest{})
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	rec = apiRequest("GET", notebookPath, friend.UserID, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = apiRequest("PUT", notebookPath+"/access", owner.UserID, accessRequest{UserID: friend.UserID, Read: true})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = apiRequest("PUT", notebookPath+"/access", owner.UserID, accessRequest{UserID: friend.UserID, Write: true})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = apiRequest("GET", notebookPath+"/access", owner.UserID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var accessRows []NotebookAccess
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &accessRows))
+	if assert.Len(t, accessRows, 1, "sharing again should change the access rather than add to it") {
+		assert.Equal(t, roleEditor, accessRows[0].Role, "the write flag should still share as an editor")
+	}
+	rec = apiRequest("GET", notebookPath+"/access", friend.UserID, nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = apiRequest("GET", notebookPath, friend.UserID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var contents notebookContents
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &contents))
+	assert.Equal(t, "recipes", contents.Name)
+	assert.True(t, contents.CanWrite)
+	assert.Len(t, contents.Notebooks, 1)
+	if assert.Len(t, contents.Notes, 1) {
+		assert.Equal(t, note.NoteID, contents.Notes[0].NoteID)
+	}
+	rec = apiRequest("PUT", "/api/v1/notes/"+strconv.Itoa(note.NoteID), friend.UserID, noteRequest{Title: "scones", Contents: "flour and butter", Version: 1})
+	assert.Equal(t, http.StatusOK, rec.Code, "write access to a notebook should let the user edit its notes")
+
+	rec = apiRequest("GET", "/api/v1/notebooks", friend.UserID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var list notebookList
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &list))
+	assert.Empty(t, list.Owned)
+	if assert.Len(t, list.Shared, 1) {
+		assert.Equal(t, notebook.NotebookID, list.Shared[0].NotebookID)
+	}
+
+	rec = apiRequest("DELETE", notebookPath, owner.UserID, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = apiRequest("DELETE", notebookPath+"/access/"+strconv.Itoa(friend.UserID), friend.UserID, nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = apiRequest("DELETE", notebookPath+"/access/"+strconv.Itoa(friend.UserID), owner.UserID, nil)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	rec = apiRequest("GET", notebookPath, friend.UserID, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = apiRequest("DELETE", notebookPath+"/access/"+strconv.Itoa(friend.UserID), owner.UserID, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
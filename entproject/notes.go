@@ -0,0 +1,49 @@
+package main
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+//Longest a notes title and contents can be. The database has no limit, but Postgres can not build a search index for
+//text much over a megabyte, so contents are kept well under that
+const (
+	maxNoteTitleLength    = 200
+	maxNoteContentsLength = 200000
+)
+
+//Characters of a notes contents shown in lists of notes
+const notePreviewLength = 150
+
+//Checks a notes title and contents are not too long, with a message saying by how much if they are
+func validateNote(title string, contents string) error {
+	if length := utf8.RuneCountInString(title); length > maxNoteTitleLength {
+		return badRequest("Titles can be at most " + strconv.Itoa(maxNoteTitleLength) + " characters long. This one is " + strconv.Itoa(length) + ".")
+	}
+	if length := utf8.RuneCountInString(contents); length > maxNoteContentsLength {
+		return badRequest("Notes can be at most " + strconv.Itoa(maxNoteContentsLength) + " characters long. This one is " + strconv.Itoa(length) + ", so remove " + strconv.Itoa(length-maxNoteContentsLength) + " or split it into more than one note.")
+	}
+	return nil
+}
+
+//The start of a notes contents on one line, for lists of notes. Long contents are cut at the end of a word and end
+//with an ellipsis
+func (n Note) Preview() string {
+	return previewText(n.Contents, notePreviewLength)
+}
+
+//Shortens text to at most length characters on one line, cutting at a space where it can
+func previewText(text string, length int) string {
+	text = strings.Join(strings.Fields(text), " ")
+	runes := []rune(text)
+	if len(runes) <= length {
+		return text
+	}
+	cut := string(runes[:length])
+	//Only go back to a space if that does not throw away most of the preview
+	if space := strings.LastIndex(cut, " "); space > len(cut)/2 {
+		cut = cut[:space]
+	}
+	return cut + "…"
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestValidateNote(t *testing.T) {
+	assert.NoError(t, validateNote("", ""))
+	assert.NoError(t, validateNote(strings.Repeat("é", maxNoteTitleLength), strings.Repeat("ü", maxNoteContentsLength)), "limits should count characters rather than bytes")
+
+	err := validateNote(strings.Repeat("a", maxNoteTitleLength+1), "")
+	assert.Equal(t, badRequest("Titles can be at most 200 characters long. This one is 201."), err)
+	err = validateNote("title", strings.Repeat("a", maxNoteContentsLength+5))
+	assert.Equal(t, badRequest("Notes can be at most 200000 characters long. This one is 200005, so remove 5 or split it into more than one note."), err)
+}
+
+func TestPreviewText(t *testing.T) {
+	assert.Equal(t, "", previewText("", 10))
+	assert.Equal(t, "short note", previewText("short\n\n  note", 10), "whitespace should be squashed onto one line")
+	assert.Equal(t, "the quick…", previewText("the quick brown fox", 12))
+	assert.Equal(t, "abcdefghij…", previewText("abcdefghijklmnop", 10), "long words should be cut rather than dropped")
+	assert.Equal(t, "ééééé…", previewText("éééééééééé", 5))
+	assert.Equal(t, "short", Note{Contents: "short"}.Preview())
+}
+
+func TestLargeNotes(t *testing.T) {
+	owner, err := registerUser("Large", "Owner", "password")
+	assert.NoError(t, err)
+
+	//Far past the old 30 and 1000 character limits
+	title := strings.Repeat("t", 100)
+	contents := strings.Repeat("lengthy words ", 5000)
+	rec := formRequest("/Notes/Create/", owner.UserID, url.Values{"title": {title}, "content": {contents}})
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	notes, err := store.GetUserNotes(owner.UserID)
+	assert.NoError(t, err)
+	if assert.Len(t, notes, 1) {
+		assert.Equal(t, contents, notes[0].Contents)
+	}
+
+	rec = apiRequest("GET", "/Users/Notes/"+strconv.Itoa(owner.UserID), owner.UserID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), previewText(contents, notePreviewLength))
+	assert.NotContains(t, rec.Body.String(), contents[:1000], "the home page should only show the start of each note")
+
+	rec = formRequest("/Notes/Create/", owner.UserID, url.Values{"title": {strings.Repeat("t", 201)}, "content": {"x"}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Titles can be at most 200 characters long.")
+	rec = formRequest("/Notes/Update/"+strconv.Itoa(notes[0].NoteID), owner.UserID, url.Values{"title": {"t"}, "content": {strings.Repeat("x", maxNoteContentsLength+1)}, "version": {"1"}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = apiRequest("POST", "/api/v1/notes", owner.UserID, noteRequest{Title: "t", Contents: strings.Repeat("x", maxNoteContentsLength+1)})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = apiRequest("PUT", "/api/v1/notes/"+strconv.Itoa(notes[0].NoteID), owner.UserID, noteRequest{Title: strings.Repeat("t", 201), Version: 1})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = apiRequest("POST", "/api/v1/notes", owner.UserID, noteRequest{Title: "t", Contents: strings.Repeat("x", maxJSONBodyBytes)})
+	assert.Equal(t, http.StatusRequestEntityTooLarge, rec.Code)
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"crypto/subtle"
+
+	"golang.org/x/crypto/bcrypt"
+)
+
+//bcrypt cost used for new password hashes. Hashes made with a lower cost are upgraded on the next log in
+var passwordCost = bcrypt.DefaultCost
+
+//bcrypt only uses the first 72 bytes of a password, so longer ones are rejected rather than silently truncated
+const maxPasswordLength = 72
+
+//Hashes a password for storing in the database
+func hashPassword(password string) (string, error) {
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), passwordCost)
+	return string(hash), err
+}
+
+//Checks a password against what is stored for a user. Also reports whether the stored value should be replaced
+//with a fresh hash, either because it is an old plaintext password or because it was hashed with a lower cost
+func verifyPassword(stored string, password string) (ok bool, needsRehash bool) {
+	cost, err := bcrypt.Cost([]byte(stored))
+	if err != nil {
+		//Not a bcrypt hash, so it is a plaintext password from before passwords were hashed
+		match := subtle.ConstantTimeCompare([]byte(stored), []byte(password)) == 1
+		return match, match
+	}
+	if bcrypt.CompareHashAndPassword([]byte(stored), []byte(password)) != nil {
+		return false, false
+	}
+	return true, cost < passwordCost
+}
+
+//Check password and UserID matches and exist when a user logs in.
+//Plaintext or outdated hashes are replaced with a fresh hash the first time the user logs in successfully
+func checkPassword(password string, userID int) (bool, error) {
+	stored, err := store.GetPassword(userID)
+
+	//If there is no matching user
+	if err == errNotFound {
+		return false, nil
+	}
+	if err != nil {
+		return false, err
+	}
+
+	ok, needsRehash := verifyPassword(stored, password)
+	if !ok {
+		return false, nil
+	}
+	if needsRehash {
+		hash, err := hashPassword(password)
+		if err != nil {
+			return false, err
+		}
+		err = store.UpdatePassword(userID, hash)
+		if err != nil {
+			return false, err
+		}
+	}
+	return true, nil
+}
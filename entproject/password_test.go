@@ -0,0 +1,91 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"golang.org/x/crypto/bcrypt"
+)
+
+func TestHashPassword(t *testing.T) {
+	hash, err := hashPassword("password")
+	assert.NoError(t, err)
+
+	assert.NotEqual(t, "password", hash, "password should not be stored as plaintext")
+	ok, needsRehash := verifyPassword(hash, "password")
+	assert.True(t, ok)
+	assert.False(t, needsRehash)
+
+	ok, _ = verifyPassword(hash, "wrong")
+	assert.False(t, ok)
+}
+
+func TestVerifyPlaintextPassword(t *testing.T) {
+	ok, needsRehash := verifyPassword("password", "password")
+	assert.True(t, ok)
+	assert.True(t, needsRehash, "plaintext passwords should be upgraded")
+
+	ok, needsRehash = verifyPassword("password", "wrong")
+	assert.False(t, ok)
+	assert.False(t, needsRehash)
+}
+
+func TestVerifyLowCostPassword(t *testing.T) {
+	hash, err := bcrypt.GenerateFromPassword([]byte("password"), bcrypt.MinCost)
+	assert.NoError(t, err)
+
+	ok, needsRehash := verifyPassword(string(hash), "password")
+	assert.True(t, ok)
+	assert.True(t, needsRehash, "hashes below the current cost should be upgraded")
+}
+
+func TestCheckPasswordUpgradesPlaintext(t *testing.T) {
+	//Users created before passwords were hashed have their password stored as plaintext
+	user, err := store.CreateUser(User{GivenName: "Plain", FamilyName: "Text", Password: "secret"})
+	assert.NoError(t, err)
+	userID := user.UserID
+
+	ok, err := checkPassword("wrong", userID)
+	assert.NoError(t, err)
+	assert.False(t, ok)
+	ok, err = checkPassword("secret", userID)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+
+	stored, err := store.GetPassword(userID)
+	assert.NoError(t, err)
+	assert.NotEqual(t, "secret", stored, "plaintext password should be replaced after logging in")
+	assert.NoError(t, bcrypt.CompareHashAndPassword([]byte(stored), []byte("secret")))
+
+	//Logging in still works against the new hash
+	ok, err = checkPassword("secret", userID)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestCreateUserHashesPassword(t *testing.T) {
+	newUser, err := registerUser("Hashed", "User", "password")
+	assert.NoError(t, err)
+
+	stored, err := store.GetPassword(newUser.UserID)
+	assert.NoError(t, err)
+	assert.NotEqual(t, "password", stored)
+	ok, err := checkPassword("password", newUser.UserID)
+	assert.NoError(t, err)
+	assert.True(t, ok)
+}
+
+func TestCreateUserPasswordTooLong(t *testing.T) {
+	tooLong := strings.Repeat("a", maxPasswordLength+1)
+	rec := formRequest("/Users/Create", 0, url.Values{"givenName": {"Long"}, "familyName": {"Password"}, "password": {tooLong}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Passwords can be at most 72 bytes long.")
+	rec = apiRequest("POST", "/api/v1/users", 0, userRequest{GivenName: "Long", FamilyName: "Password", Password: tooLong})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	rec = formRequest("/Users/Create", 0, url.Values{"givenName": {"Long"}, "familyName": {"Password"}, "password": {tooLong[1:]}})
+	assert.Equal(t, http.StatusOK, rec.Code)
+}
@@ -0,0 +1,988 @@
+package main
+
+import (
+	"database/sql"
+	"html/template"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/lib/pq"
+)
+
+//Store backed by a Postgres database
+type pgStore struct {
+	db *sql.DB
+}
+
+//Connects to the database and checks its schema is up to date. Run "entproject migrate up" to update it
+func newPGStore(dsn string) (*pgStore, error) {
+	db, err := sql.Open("postgres", dsn)
+	if err != nil {
+		return nil, err
+	}
+	m, err := newMigrator(db)
+	if err == nil {
+		err = m.check()
+	}
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+	return &pgStore{db: db}, nil
+}
+
+func (s *pgStore) Close() error {
+	return s.db.Close()
+}
+
+//Gets a list of all users within the database and their details
+func (s *pgStore) GetUsers() ([]User, error) {
+	rows, err := s.db.Query(`SELECT userID, givenName, familyName FROM "User" ORDER BY userID`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var users []User
+	var user User
+
+	//Put SQL data into object
+	for rows.Next() {
+		err = rows.Scan(&user.UserID, &user.GivenName, &user.FamilyName)
+		if err != nil {
+			return nil, err
+		}
+		//Adds each user to user list
+		users = append(users, user)
+	}
+	return users, rows.Err()
+}
+
+//Gets a single user and their details
+func (s *pgStore) GetUser(userID int) (User, error) {
+	var user User
+
+	err := s.db.QueryRow(`SELECT userID, givenName, familyName FROM "User" WHERE userID = $1`, userID).Scan(&user.UserID, &user.GivenName, &user.FamilyName)
+	if err == sql.ErrNoRows {
+		return user, errNotFound
+	}
+	return user, err
+}
+
+//Inserts a new user
+func (s *pgStore) CreateUser(user User) (User, error) {
+	query := `INSERT INTO "User" (GivenName, FamilyName, Password) VALUES ($1, $2, $3) RETURNING UserID;`
+	//Used to return UserID so we can display it to the user
+	err := s.db.QueryRow(query, user.GivenName, user.FamilyName, user.Password).Scan(&user.UserID)
+	return user, err
+}
+
+//Gets the stored password for a user
+func (s *pgStore) GetPassword(userID int) (string, error) {
+	var stored string
+
+	err := s.db.QueryRow(`SELECT Password FROM "User" WHERE UserID = $1`, userID).Scan(&stored)
+	if err == sql.ErrNoRows {
+		return "", errNotFound
+	}
+	return stored, err
+}
+
+//Replaces the stored password hash for a user
+func (s *pgStore) UpdatePassword(userID int, hash string) error {
+	_, err := s.db.Exec(`UPDATE "User" SET Password = $1 WHERE UserID = $2`, hash, userID)
+	return err
+}
+
+//Selects a notes tags, in order, as an array. Goes after the other note columns in a query on the note table
+const noteTagsSQL = `ARRAY(SELECT tag.name FROM notetag JOIN tag ON tag.tagid = notetag.tagid WHERE notetag.noteid = note.noteid ORDER BY tag.name)`
+
+//The note columns scanNotes reads, in order. Notes that are not in a notebook have a NotebookID of 0
+const noteColumnsSQL = `note.noteid, note.userid, note.title, note.contents, note.datecreated, note.dateupdated, note.version, COALESCE(note.notebookid, 0), ` + noteTagsSQL
+
+//The shared roles that allow an action, as a quoted SQL list such as 'editor', 'co-owner'
+func rolesSQL(action capability) string {
+	var roles []string
+	for _, role := range sharedRoles {
+		if role.can(action) {
+			roles = append(roles, "'"+string(role)+"'")
+		}
+	}
+	return strings.Join(roles, ", ")
+}
+
+//Condition for a note having been shared with user $1, either directly or through its notebook or any notebook that
+//notebook is inside. Owning one of those notebooks counts too. When write is set the role must allow editing
+func sharedNoteSQL(write bool) string {
+	noteWrite, notebookWrite := "", ""
+	if write {
+		noteWrite = " AND noteaccess.role IN (" + rolesSQL(capEdit) + ")"
+		notebookWrite = " AND notebookaccess.role IN (" + rolesSQL(capEdit) + ")"
+	}
+	return `(EXISTS (SELECT 1 FROM noteaccess WHERE noteaccess.noteid = note.noteid AND noteaccess.userid = $1` + noteWrite + `)
+		OR EXISTS (WITH RECURSIVE parents AS (
+				SELECT notebook.notebookid, notebook.parentid, notebook.userid FROM notebook WHERE notebook.notebookid = note.notebookid
+				UNION
+				SELECT notebook.notebookid, notebook.parentid, notebook.userid FROM notebook JOIN parents ON notebook.notebookid = parents.parentid)
+			SELECT 1 FROM parents WHERE parents.userid = $1
+				OR EXISTS (SELECT 1 FROM notebookaccess WHERE notebookaccess.notebookid = parents.notebookid AND notebookaccess.userid = $1` + notebookWrite + `)))`
+}
+
+//Scans every row of a note query
+func scanNotes(rows *sql.Rows) ([]Note, error) {
+	defer rows.Close()
+
+	var notes []Note
+
+	for rows.Next() {
+		//Put SQL data into object
+		var note Note
+		err := rows.Scan(&note.NoteID, &note.UserID, &note.Title, &note.Contents, &note.DateCreated, &note.DateUpdated, &note.Version, &note.NotebookID, pq.Array(&note.Tags))
+		if err != nil {
+			return nil, err
+		}
+		notes = append(notes, note)
+	}
+	return notes, rows.Err()
+}
+
+//gets a list of users notes from database where the are either the owner or have read permission, leaving out the trash
+func (s *pgStore) GetUserNotes(userID int) ([]Note, error) {
+	rows, err := s.db.Query(`SELECT `+noteColumnsSQL+` FROM note WHERE note.datedeleted IS NULL AND (note.userid = $1 OR `+sharedNoteSQL(false)+`) ORDER BY note.noteid`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanNotes(rows)
+}
+
+//Gets a single note, as long as it is not in the trash
+func (s *pgStore) GetNote(noteID int) (Note, error) {
+	var note Note
+
+	err := s.db.QueryRow(`SELECT `+noteColumnsSQL+` FROM note WHERE note.noteid = $1 AND note.datedeleted IS NULL`, noteID).Scan(&note.NoteID, &note.UserID, &note.Title, &note.Contents, &note.DateCreated, &note.DateUpdated, &note.Version, &note.NotebookID, pq.Array(&note.Tags))
+	if err == sql.ErrNoRows {
+		return note, errNotFound
+	}
+	return note, err
+}
+
+//Inserts the given note data into the note table, along with its first revision
+func (s *pgStore) CreateNote(note Note) (Note, error) {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return note, err
+	}
+	defer tx.Rollback()
+
+	query := `INSERT INTO Note (UserID, Title, Contents, DateCreated, DateUpdated, Version, NotebookID) VALUES ($1, $2, $3, $4, $5, 1, NULLIF($6, 0)) RETURNING NoteID, Version;`
+	err = tx.QueryRow(query, note.UserID, note.Title, note.Contents, note.DateCreated, note.DateUpdated, note.NotebookID).Scan(&note.NoteID, &note.Version)
+	if err != nil {
+		return note, err
+	}
+	err = addRevision(tx, note, note.UserID, note.DateCreated)
+	if err != nil {
+		return note, err
+	}
+	//New notes start without tags, SetNoteTags adds them
+	note.Tags = []string{}
+	return note, tx.Commit()
+}
+
+//Updates note with new values and records them as a new revision, as long as nobody else has saved it since
+//note.Version was loaded
+func (s *pgStore) UpdateNote(note Note, authorID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	query := `UPDATE Note SET title = $1, contents = $2, dateupdated = $3, version = version + 1 WHERE Note.noteid = $4 AND Note.version = $5 AND Note.datedeleted IS NULL`
+	result, err := tx.Exec(query, note.Title, note.Contents, note.DateUpdated, note.NoteID, note.Version)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return errConflict
+	}
+	note.Version++
+	err = addRevision(tx, note, authorID, note.DateUpdated)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+//Records a notes title and contents as a revision
+func addRevision(tx *sql.Tx, note Note, authorID int, date time.Time) error {
+	query := `INSERT INTO NoteRevision (NoteID, UserID, Title, Contents, DateCreated, Version) VALUES ($1, $2, $3, $4, $5, $6)`
+	_, err := tx.Exec(query, note.NoteID, authorID, note.Title, note.Contents, date, note.Version)
+	return err
+}
+
+//Deletes given note
+func (s *pgStore) DeleteNote(noteID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	//First deletes the note access, revisions, tags and attachments for the note
+	_, err = tx.Exec(`DELETE FROM NoteAccess WHERE NoteAccess.noteid = $1`, noteID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM Attachment WHERE Attachment.noteid = $1`, noteID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM NoteTag WHERE NoteTag.noteid = $1`, noteID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM NoteRevision WHERE NoteRevision.noteid = $1`, noteID)
+	if err != nil {
+		return err
+	}
+	//Deletes the note
+	_, err = tx.Exec(`DELETE FROM note WHERE note.noteid = $1`, noteID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+//Gives a note to a new owner, dropping their access row and keeping the old owner on as previousOwner if it is set
+func (s *pgStore) TransferNote(noteID int, ownerID int, previousOwner Role, date time.Time) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var oldOwnerID int
+	err = tx.QueryRow(`SELECT userid FROM Note WHERE noteid = $1 AND datedeleted IS NULL FOR UPDATE`, noteID).Scan(&oldOwnerID)
+	if err == sql.ErrNoRows {
+		return errNotFound
+	}
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`UPDATE Note SET userid = $1, notebookid = NULL WHERE noteid = $2`, ownerID, noteID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM NoteAccess WHERE noteid = $1 AND userid = $2`, noteID, ownerID)
+	if err != nil {
+		return err
+	}
+	if previousOwner != "" {
+		query := `INSERT INTO NoteAccess (UserID, NoteID, Role, GrantedBy, DateGranted) VALUES ($1, $2, $3, $1, $4)`
+		_, err = tx.Exec(query, oldOwnerID, noteID, previousOwner, date)
+		if err != nil {
+			return err
+		}
+	}
+	return tx.Commit()
+}
+
+//Moves a note to the trash
+func (s *pgStore) TrashNote(noteID int, dateDeleted time.Time) error {
+	result, err := s.db.Exec(`UPDATE Note SET datedeleted = $1 WHERE noteid = $2 AND datedeleted IS NULL`, dateDeleted, noteID)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return errNotFound
+	}
+	return nil
+}
+
+//Scans every row of a query for notes in the trash, which selects noteColumnsSQL then note.datedeleted
+func scanTrash(rows *sql.Rows) ([]TrashedNote, error) {
+	defer rows.Close()
+
+	var trash []TrashedNote
+	for rows.Next() {
+		var note TrashedNote
+		err := rows.Scan(&note.NoteID, &note.UserID, &note.Title, &note.Contents, &note.DateCreated, &note.DateUpdated, &note.Version, &note.NotebookID, pq.Array(&note.Tags), &note.DateDeleted)
+		if err != nil {
+			return nil, err
+		}
+		trash = append(trash, note)
+	}
+	return trash, rows.Err()
+}
+
+//Gets the notes in a users trash, most recently deleted first
+func (s *pgStore) GetTrash(userID int) ([]TrashedNote, error) {
+	rows, err := s.db.Query(`SELECT `+noteColumnsSQL+`, note.datedeleted FROM note WHERE note.userid = $1 AND note.datedeleted IS NOT NULL ORDER BY note.datedeleted DESC, note.noteid`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanTrash(rows)
+}
+
+//Gets a note in the trash
+func (s *pgStore) GetTrashedNote(noteID int) (TrashedNote, error) {
+	rows, err := s.db.Query(`SELECT `+noteColumnsSQL+`, note.datedeleted FROM note WHERE note.noteid = $1 AND note.datedeleted IS NOT NULL`, noteID)
+	if err != nil {
+		return TrashedNote{}, err
+	}
+	trash, err := scanTrash(rows)
+	if err != nil {
+		return TrashedNote{}, err
+	}
+	if len(trash) == 0 {
+		return TrashedNote{}, errNotFound
+	}
+	return trash[0], nil
+}
+
+//Takes a note out of the trash. Its access rows were never deleted, so it is shared just as it was
+func (s *pgStore) RestoreNote(noteID int) error {
+	result, err := s.db.Exec(`UPDATE Note SET datedeleted = NULL WHERE noteid = $1 AND datedeleted IS NOT NULL`, noteID)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return errNotFound
+	}
+	return nil
+}
+
+//Gets the IDs of the notes that went in the trash before deletedBefore
+func (s *pgStore) GetExpiredTrash(deletedBefore time.Time) ([]int, error) {
+	rows, err := s.db.Query(`SELECT noteid FROM Note WHERE datedeleted < $1 ORDER BY noteid`, deletedBefore)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var noteIDs []int
+	for rows.Next() {
+		var noteID int
+		err := rows.Scan(&noteID)
+		if err != nil {
+			return nil, err
+		}
+		noteIDs = append(noteIDs, noteID)
+	}
+	return noteIDs, rows.Err()
+}
+
+//Gets every revision of a note, newest first
+func (s *pgStore) GetRevisions(noteID int) ([]NoteRevision, error) {
+	rows, err := s.db.Query(`SELECT revisionid, noteid, userid, title, contents, datecreated, version FROM NoteRevision WHERE noteid = $1 ORDER BY revisionid DESC`, noteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []NoteRevision
+	var revision NoteRevision
+
+	for rows.Next() {
+		//Put SQL data into object
+		err := rows.Scan(&revision.RevisionID, &revision.NoteID, &revision.UserID, &revision.Title, &revision.Contents, &revision.DateCreated, &revision.Version)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, revision)
+	}
+	return revisions, rows.Err()
+}
+
+//Gets one revision of a note
+func (s *pgStore) GetRevision(noteID int, revisionID int) (NoteRevision, error) {
+	var revision NoteRevision
+
+	err := s.db.QueryRow(`SELECT revisionid, noteid, userid, title, contents, datecreated, version FROM NoteRevision WHERE noteid = $1 AND revisionid = $2`, noteID, revisionID).Scan(&revision.RevisionID, &revision.NoteID, &revision.UserID, &revision.Title, &revision.Contents, &revision.DateCreated, &revision.Version)
+	if err == sql.ErrNoRows {
+		return revision, errNotFound
+	}
+	return revision, err
+}
+
+//Gets the notes a user can read that match a search, best match first
+func (s *pgStore) SearchNotes(userID int, query searchQuery) ([]SearchResult, error) {
+	if query.empty() {
+		return nil, nil
+	}
+	//The query is built from fixed SQL and numbered placeholders only, everything the user typed is passed as a value
+	args := []interface{}{userID}
+	rank, headline, from := "0", "''", "note"
+	where := []string{"note.datedeleted IS NULL"}
+	if len(query.Groups) > 0 {
+		from = "note, (SELECT " + searchTSQuery(query, &args) + " AS query) q"
+		args = append(args, "StartSel="+headlineStart+", StopSel="+headlineStop+", MaxWords=25, MinWords=10, MaxFragments=2, FragmentDelimiter=\" … \"")
+		rank = "ts_rank(note.search, q.query)"
+		headline = "ts_headline('english', coalesce(note.contents, ''), q.query, $" + strconv.Itoa(len(args)) + ")"
+		where = append(where, "note.search @@ q.query")
+	}
+	where = append(where, searchFilterSQL(query.Filter, &args)...)
+
+	rows, err := s.db.Query(`SELECT `+noteColumnsSQL+`,
+			`+rank+` AS rank, `+headline+`
+		FROM `+from+`
+		WHERE `+strings.Join(where, " AND ")+`
+		ORDER BY rank DESC, note.noteid`, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []SearchResult
+	for rows.Next() {
+		//Put SQL data into object
+		var result SearchResult
+		var headline string
+		err := rows.Scan(&result.NoteID, &result.UserID, &result.Title, &result.Contents, &result.DateCreated, &result.DateUpdated, &result.Version, &result.NotebookID, pq.Array(&result.Tags), &result.Rank, &headline)
+		if err != nil {
+			return nil, err
+		}
+		result.Snippet = template.HTML(headlineHTML(headline))
+		if len(query.Groups) == 0 {
+			//There are no matches to show, so the snippet is the start of the note
+			result.Snippet = template.HTML(query.snippet(result.Contents))
+		}
+		results = append(results, result)
+	}
+	return results, rows.Err()
+}
+
+//Builds the conditions for the notes a filter lets through, adding its values to args. $1 must be the user searching
+func searchFilterSQL(filter searchFilter, args *[]interface{}) []string {
+	owned := "note.userid = $1"
+	shared := sharedNoteSQL(filter.Writable)
+
+	var where []string
+	switch filter.Scope {
+	case scopeOwned:
+		where = append(where, owned)
+	case scopeShared:
+		where = append(where, "note.userid <> $1", shared)
+	default:
+		where = append(where, "("+owned+" OR "+shared+")")
+	}
+	if filter.OwnerID != 0 {
+		*args = append(*args, filter.OwnerID)
+		where = append(where, "note.userid = $"+strconv.Itoa(len(*args)))
+	}
+
+	for _, tag := range filter.Tags {
+		*args = append(*args, tag)
+		where = append(where, "EXISTS (SELECT 1 FROM notetag JOIN tag ON tag.tagid = notetag.tagid WHERE notetag.noteid = note.noteid AND tag.name = $"+strconv.Itoa(len(*args))+")")
+	}
+
+	dates := []struct {
+		condition string
+		date      time.Time
+	}{
+		{"note.datecreated >= ", filter.CreatedFrom},
+		{"note.datecreated < ", dayAfter(filter.CreatedTo)},
+		{"note.dateupdated >= ", filter.UpdatedFrom},
+		{"note.dateupdated < ", dayAfter(filter.UpdatedTo)},
+	}
+	for _, d := range dates {
+		if !d.date.IsZero() {
+			*args = append(*args, d.date)
+			where = append(where, d.condition+"$"+strconv.Itoa(len(*args)))
+		}
+	}
+	return where
+}
+
+//Builds the tsquery expression for a search, adding each terms text to args and referring to it by its placeholder
+func searchTSQuery(query searchQuery, args *[]interface{}) string {
+	var groups []string
+	for _, group := range query.Groups {
+		var terms []string
+		for _, term := range group {
+			var expr string
+			switch {
+			case term.Prefix:
+				//The parser only keeps letters and digits in a prefix, so this is always valid tsquery syntax
+				*args = append(*args, term.Text+":*")
+				expr = "to_tsquery('english', $" + strconv.Itoa(len(*args)) + ")"
+			case term.Phrase:
+				*args = append(*args, term.Text)
+				expr = "phraseto_tsquery('english', $" + strconv.Itoa(len(*args)) + ")"
+			default:
+				*args = append(*args, term.Text)
+				expr = "plainto_tsquery('english', $" + strconv.Itoa(len(*args)) + ")"
+			}
+			if term.Negated {
+				expr = "!!" + expr
+			}
+			terms = append(terms, expr)
+		}
+		groups = append(groups, "("+strings.Join(terms, " && ")+")")
+	}
+	return strings.Join(groups, " || ")
+}
+
+//The noteAccess columns scanAccessRow reads, in order. Access given before grants were recorded has a GrantedBy of 0
+//and no DateGranted
+const noteAccessColumnsSQL = `noteaccessid, noteid, userid, role, COALESCE(grantedby, 0), dategranted`
+
+//Scans one noteAccess row selected with noteAccessColumnsSQL
+func scanAccessRow(scan func(dest ...interface{}) error) (NoteAccess, error) {
+	var noteAccess NoteAccess
+	var dateGranted sql.NullTime
+	err := scan(&noteAccess.NoteAccessID, &noteAccess.NoteID, &noteAccess.UserID, &noteAccess.Role, &noteAccess.GrantedBy, &dateGranted)
+	noteAccess.DateGranted = dateGranted.Time
+	return noteAccess, err
+}
+
+//Scans every row of a noteAccess query
+func scanAccess(rows *sql.Rows) ([]NoteAccess, error) {
+	defer rows.Close()
+
+	var matches []NoteAccess
+	for rows.Next() {
+		//Put SQL data into object
+		noteAccess, err := scanAccessRow(rows.Scan)
+		if err != nil {
+			return nil, err
+		}
+		matches = append(matches, noteAccess)
+	}
+	return matches, rows.Err()
+}
+
+//Gets all noteAccess rows included in a note
+func (s *pgStore) GetAccess(noteID int) ([]NoteAccess, error) {
+	rows, err := s.db.Query(`SELECT `+noteAccessColumnsSQL+` FROM NoteAccess WHERE noteid = $1 ORDER BY noteaccessid`, noteID)
+	if err != nil {
+		return nil, err
+	}
+	return scanAccess(rows)
+}
+
+//Replaces the tags on a note, adding any tags that have not been used before
+func (s *pgStore) SetNoteTags(noteID int, tags []string) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	for _, tag := range tags {
+		_, err = tx.Exec(`INSERT INTO Tag (Name) VALUES ($1) ON CONFLICT (Name) DO NOTHING`, tag)
+		if err != nil {
+			return err
+		}
+	}
+	_, err = tx.Exec(`DELETE FROM NoteTag WHERE noteid = $1`, noteID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`INSERT INTO NoteTag (NoteID, TagID) SELECT $1, TagID FROM Tag WHERE Name = ANY($2)`, noteID, pq.Array(tags))
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+//Counts how many of the notes a user can read have each tag
+func (s *pgStore) GetTagCounts(userID int) ([]tagCount, error) {
+	rows, err := s.db.Query(`SELECT tag.name, COUNT(*) FROM tag
+		JOIN notetag ON notetag.tagid = tag.tagid
+		JOIN note ON note.noteid = notetag.noteid
+		WHERE note.datedeleted IS NULL AND (note.userid = $1 OR `+sharedNoteSQL(false)+`)
+		GROUP BY tag.name
+		ORDER BY tag.name`, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var counts []tagCount
+	for rows.Next() {
+		var count tagCount
+		err := rows.Scan(&count.Name, &count.Count)
+		if err != nil {
+			return nil, err
+		}
+		counts = append(counts, count)
+	}
+	return counts, rows.Err()
+}
+
+//Counts the noteAccess rows on each of the given notes
+func (s *pgStore) CountAccess(noteIDs []int) (map[int]int, error) {
+	rows, err := s.db.Query(`SELECT noteid, COUNT(*) FROM NoteAccess WHERE noteid = ANY($1) GROUP BY noteid`, pq.Array(noteIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	counts := make(map[int]int)
+	for rows.Next() {
+		var noteID, count int
+		err := rows.Scan(&noteID, &count)
+		if err != nil {
+			return nil, err
+		}
+		counts[noteID] = count
+	}
+	return counts, rows.Err()
+}
+
+//Gets the noteAccess row a user has on a note
+func (s *pgStore) GetUserAccess(noteID int, userID int) (NoteAccess, error) {
+	noteAccess, err := scanAccessRow(s.db.QueryRow(`SELECT `+noteAccessColumnsSQL+` FROM NoteAccess WHERE noteid = $1 AND userid = $2`, noteID, userID).Scan)
+	if err == sql.ErrNoRows {
+		return noteAccess, errNotFound
+	}
+	return noteAccess, err
+}
+
+//Add new access settings to the database, or updates the ones the user already has on the note
+func (s *pgStore) AddAccess(access NoteAccess) (NoteAccess, error) {
+	query := `INSERT INTO NoteAccess (UserID, NoteID, Role, GrantedBy, DateGranted) VALUES ($1, $2, $3, NULLIF($4, 0), $5)
+		ON CONFLICT (NoteID, UserID) DO UPDATE SET Role = EXCLUDED.Role, GrantedBy = EXCLUDED.GrantedBy, DateGranted = EXCLUDED.DateGranted
+		RETURNING NoteAccessID`
+	err := s.db.QueryRow(query, access.UserID, access.NoteID, access.Role, access.GrantedBy, nullTime(access.DateGranted)).Scan(&access.NoteAccessID)
+	return access, err
+}
+
+//A time to save in a nullable column, with the zero time saved as NULL
+func nullTime(t time.Time) sql.NullTime {
+	return sql.NullTime{Time: t, Valid: !t.IsZero()}
+}
+
+//Updates the access a single user has on a note
+func (s *pgStore) SetUserAccess(access NoteAccess) error {
+	query := `UPDATE NoteAccess SET role = $1, grantedby = NULLIF($2, 0), dategranted = $3 WHERE noteid = $4 AND userid = $5`
+	result, err := s.db.Exec(query, access.Role, access.GrantedBy, nullTime(access.DateGranted), access.NoteID, access.UserID)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return errNotFound
+	}
+	return nil
+}
+
+//Stops sharing a note with a user
+func (s *pgStore) RemoveAccess(noteID int, userID int) error {
+	result, err := s.db.Exec(`DELETE FROM NoteAccess WHERE noteid = $1 AND userid = $2`, noteID, userID)
+	if err != nil {
+		return err
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return errNotFound
+	}
+	return nil
+}
+
+//Gets the attachments on a note, oldest first
+func (s *pgStore) GetAttachments(noteID int) ([]Attachment, error) {
+	rows, err := s.db.Query(`SELECT attachmentid, noteid, userid, filename, contenttype, size, blobkey, datecreated FROM Attachment WHERE noteid = $1 ORDER BY attachmentid`, noteID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attachments []Attachment
+	for rows.Next() {
+		//Put SQL data into object
+		var attachment Attachment
+		err := rows.Scan(&attachment.AttachmentID, &attachment.NoteID, &attachment.UserID, &attachment.FileName, &attachment.ContentType, &attachment.Size, &attachment.BlobKey, &attachment.DateCreated)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, attachment)
+	}
+	return attachments, rows.Err()
+}
+
+//Gets a single attachment
+func (s *pgStore) GetAttachment(attachmentID int) (Attachment, error) {
+	var attachment Attachment
+
+	err := s.db.QueryRow(`SELECT attachmentid, noteid, userid, filename, contenttype, size, blobkey, datecreated FROM Attachment WHERE attachmentid = $1`, attachmentID).Scan(&attachment.AttachmentID, &attachment.NoteID, &attachment.UserID, &attachment.FileName, &attachment.ContentType, &attachment.Size, &attachment.BlobKey, &attachment.DateCreated)
+	if err == sql.ErrNoRows {
+		return attachment, errNotFound
+	}
+	return attachment, err
+}
+
+//Inserts the details of a file attached to a note
+func (s *pgStore) AddAttachment(attachment Attachment) (Attachment, error) {
+	query := `INSERT INTO Attachment (NoteID, UserID, FileName, ContentType, Size, BlobKey, DateCreated) VALUES ($1, $2, $3, $4, $5, $6, $7) RETURNING AttachmentID`
+	err := s.db.QueryRow(query, attachment.NoteID, attachment.UserID, attachment.FileName, attachment.ContentType, attachment.Size, attachment.BlobKey, attachment.DateCreated).Scan(&attachment.AttachmentID)
+	return attachment, err
+}
+
+//Deletes the details of an attachment
+func (s *pgStore) DeleteAttachment(attachmentID int) error {
+	_, err := s.db.Exec(`DELETE FROM Attachment WHERE attachmentid = $1`, attachmentID)
+	return err
+}
+
+//Scans every row of a notebook query
+func scanNotebooks(rows *sql.Rows) ([]Notebook, error) {
+	defer rows.Close()
+
+	var notebooks []Notebook
+	for rows.Next() {
+		//Put SQL data into object
+		var notebook Notebook
+		err := rows.Scan(&notebook.NotebookID, &notebook.UserID, &notebook.ParentID, &notebook.Name, &notebook.DateCreated)
+		if err != nil {
+			return nil, err
+		}
+		notebooks = append(notebooks, notebook)
+	}
+	return notebooks, rows.Err()
+}
+
+//The notebook columns scanNotebooks reads, in order. Top level notebooks have a ParentID of 0
+const notebookColumnsSQL = `notebook.notebookid, notebook.userid, COALESCE(notebook.parentid, 0), notebook.name, notebook.datecreated`
+
+//Gets every notebook a user owns
+func (s *pgStore) GetUserNotebooks(userID int) ([]Notebook, error) {
+	rows, err := s.db.Query(`SELECT `+notebookColumnsSQL+` FROM notebook WHERE notebook.userid = $1 ORDER BY notebook.name, notebook.notebookid`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanNotebooks(rows)
+}
+
+//Gets the notebooks that have been shared with a user
+func (s *pgStore) GetSharedNotebooks(userID int) ([]Notebook, error) {
+	rows, err := s.db.Query(`SELECT `+notebookColumnsSQL+` FROM notebook
+		JOIN notebookaccess ON notebookaccess.notebookid = notebook.notebookid
+		WHERE notebookaccess.userid = $1
+		ORDER BY notebook.name, notebook.notebookid`, userID)
+	if err != nil {
+		return nil, err
+	}
+	return scanNotebooks(rows)
+}
+
+//Gets a single notebook
+func (s *pgStore) GetNotebook(notebookID int) (Notebook, error) {
+	var notebook Notebook
+
+	err := s.db.QueryRow(`SELECT `+notebookColumnsSQL+` FROM notebook WHERE notebook.notebookid = $1`, notebookID).Scan(&notebook.NotebookID, &notebook.UserID, &notebook.ParentID, &notebook.Name, &notebook.DateCreated)
+	if err == sql.ErrNoRows {
+		return notebook, errNotFound
+	}
+	return notebook, err
+}
+
+//Gets the notebooks directly inside a notebook
+func (s *pgStore) GetChildNotebooks(notebookID int) ([]Notebook, error) {
+	rows, err := s.db.Query(`SELECT `+notebookColumnsSQL+` FROM notebook WHERE notebook.parentid = $1 ORDER BY notebook.name, notebook.notebookid`, notebookID)
+	if err != nil {
+		return nil, err
+	}
+	return scanNotebooks(rows)
+}
+
+//Gets the notes directly inside a notebook
+func (s *pgStore) GetNotebookNotes(notebookID int) ([]Note, error) {
+	rows, err := s.db.Query(`SELECT `+noteColumnsSQL+` FROM note WHERE note.notebookid = $1 AND note.datedeleted IS NULL ORDER BY note.noteid`, notebookID)
+	if err != nil {
+		return nil, err
+	}
+	return scanNotes(rows)
+}
+
+//Inserts a new notebook
+func (s *pgStore) CreateNotebook(notebook Notebook) (Notebook, error) {
+	query := `INSERT INTO Notebook (UserID, ParentID, Name, DateCreated) VALUES ($1, NULLIF($2, 0), $3, $4) RETURNING NotebookID`
+	err := s.db.QueryRow(query, notebook.UserID, notebook.ParentID, notebook.Name, notebook.DateCreated).Scan(&notebook.NotebookID)
+	return notebook, err
+}
+
+//Deletes an empty notebook and who it was shared with
+func (s *pgStore) DeleteNotebook(notebookID int) error {
+	tx, err := s.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM NotebookAccess WHERE NotebookAccess.notebookid = $1`, notebookID)
+	if err != nil {
+		return err
+	}
+	//Only notes in the trash can still be in it
+	_, err = tx.Exec(`UPDATE Note SET notebookid = NULL WHERE notebookid = $1`, notebookID)
+	if err != nil {
+		return err
+	}
+	_, err = tx.Exec(`DELETE FROM Notebook WHERE Notebook.notebookid = $1`, notebookID)
+	if err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+//Moves a note into a notebook, or out of its notebook when notebookID is 0
+func (s *pgStore) MoveNote(noteID int, notebookID int) error {
+	result, err := s.db.Exec(`UPDATE Note SET notebookid = NULLIF($1, 0) WHERE noteid = $2 AND datedeleted IS NULL`, notebookID, noteID)
+	if err != nil {
+		return err
+	}
+	updated, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if updated == 0 {
+		return errNotFound
+	}
+	return nil
+}
+
+//Gets every access row on a notebook
+func (s *pgStore) GetNotebookAccess(notebookID int) ([]NotebookAccess, error) {
+	rows, err := s.db.Query(`SELECT notebookaccessid, notebookid, userid, role FROM NotebookAccess WHERE notebookid = $1 ORDER BY notebookaccessid`, notebookID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accessList []NotebookAccess
+	for rows.Next() {
+		var access NotebookAccess
+		err := rows.Scan(&access.NotebookAccessID, &access.NotebookID, &access.UserID, &access.Role)
+		if err != nil {
+			return nil, err
+		}
+		accessList = append(accessList, access)
+	}
+	return accessList, rows.Err()
+}
+
+//Gets the access row a user has on a notebook
+func (s *pgStore) GetUserNotebookAccess(notebookID int, userID int) (NotebookAccess, error) {
+	var access NotebookAccess
+
+	err := s.db.QueryRow(`SELECT notebookaccessid, notebookid, userid, role FROM NotebookAccess WHERE notebookid = $1 AND userid = $2`, notebookID, userID).Scan(&access.NotebookAccessID, &access.NotebookID, &access.UserID, &access.Role)
+	if err == sql.ErrNoRows {
+		return access, errNotFound
+	}
+	return access, err
+}
+
+//Shares a notebook with a user, or changes the access they already have
+func (s *pgStore) SetNotebookAccess(access NotebookAccess) error {
+	query := `INSERT INTO NotebookAccess (NotebookID, UserID, Role) VALUES ($1, $2, $3)
+		ON CONFLICT (NotebookID, UserID) DO UPDATE SET Role = EXCLUDED.Role`
+	_, err := s.db.Exec(query, access.NotebookID, access.UserID, access.Role)
+	return err
+}
+
+//Stops sharing a notebook with a user
+func (s *pgStore) RemoveNotebookAccess(notebookID int, userID int) error {
+	result, err := s.db.Exec(`DELETE FROM NotebookAccess WHERE notebookid = $1 AND userid = $2`, notebookID, userID)
+	if err != nil {
+		return err
+	}
+	removed, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if removed == 0 {
+		return errNotFound
+	}
+	return nil
+}
+
+//Gets every saved shared setting row for an owner
+func (s *pgStore) GetSharedSettings(ownerID int) ([]SharedSettings, error) {
+	rows, err := s.db.Query(`SELECT SharedSettingsID, OwnerID, SharedUserID, Role, Name FROM SharedSettings WHERE OwnerID = $1 ORDER BY Name, SharedSettingsID`, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var settings []SharedSettings
+	var setting SharedSettings
+	for rows.Next() {
+		//Put SQL data into object
+		err = rows.Scan(&setting.SharedSettingsID, &setting.OwnerID, &setting.SharedUserID, &setting.Role, &setting.Name)
+		if err != nil {
+			return nil, err
+		}
+		settings = append(settings, setting)
+	}
+	return settings, rows.Err()
+}
+
+//Inserts one shared setting row
+func (s *pgStore) AddSharedSetting(setting SharedSettings) error {
+	query := `INSERT INTO SharedSettings (OwnerID, SharedUserID, Role, Name) VALUES ($1, $2, $3, $4)`
+	_, err := s.db.Exec(query, setting.OwnerID, setting.SharedUserID, setting.Role, setting.Name)
+	return err
+}
+
+//Inserts a new session
+func (s *pgStore) CreateSession(session Session) error {
+	query := `INSERT INTO Session (SessionID, UserID, DateCreated, LastSeen) VALUES ($1, $2, $3, $4)`
+	_, err := s.db.Exec(query, session.SessionID, session.UserID, session.DateCreated, session.LastSeen)
+	return err
+}
+
+//Gets a session by its ID
+func (s *pgStore) GetSession(sessionID string) (Session, error) {
+	var session Session
+
+	err := s.db.QueryRow(`SELECT SessionID, UserID, DateCreated, LastSeen FROM Session WHERE SessionID = $1`, sessionID).Scan(&session.SessionID, &session.UserID, &session.DateCreated, &session.LastSeen)
+	if err == sql.ErrNoRows {
+		return session, errNotFound
+	}
+	return session, err
+}
+
+//Records that a session has just been used
+func (s *pgStore) TouchSession(sessionID string, lastSeen time.Time) error {
+	_, err := s.db.Exec(`UPDATE Session SET LastSeen = $1 WHERE SessionID = $2`, lastSeen, sessionID)
+	return err
+}
+
+//Deletes a single session
+func (s *pgStore) DeleteSession(sessionID string) error {
+	_, err := s.db.Exec(`DELETE FROM Session WHERE SessionID = $1`, sessionID)
+	return err
+}
+
+//Deletes every session belonging to a user
+func (s *pgStore) DeleteUserSessions(userID int) error {
+	_, err := s.db.Exec(`DELETE FROM Session WHERE UserID = $1`, userID)
+	return err
+}
+
+//Deletes every session past its idle or absolute expiry
+func (s *pgStore) DeleteExpiredSessions(idleBefore time.Time, createdBefore time.Time) error {
+	_, err := s.db.Exec(`DELETE FROM Session WHERE LastSeen < $1 OR DateCreated < $2`, idleBefore, createdBefore)
+	return err
+}
@@ -1,694 +1,574 @@
 package main
 
 import (
-	"database/sql"
+	"flag"
 	"fmt"
-	"strings"
-
-	//"encoding/json"
+	"os"
+	"path/filepath"
 
+	"html/template"
 	"log"
 	"net/http"
+	"net/url"
 	"strconv"
-	"text/template"
 	"time"
+	"unicode/utf8"
 
 	"github.com/gorilla/mux"
-	_ "github.com/lib/pq"
 )
 
 type Note struct {
-	NoteID      int       `json: noteID`
-	UserID      int       `json: userID`
-	Title       string    `json: title`
-	Contents    string    `json: contents`
-	DateCreated time.Time `json: dateCreated`
-	DateUpdated time.Time `json dateUpdated`
+	NoteID      int       `json:"noteID"`
+	UserID      int       `json:"userID"`
+	Title       string    `json:"title"`
+	Contents    string    `json:"contents"`
+	DateCreated time.Time `json:"dateCreated"`
+	DateUpdated time.Time `json:"dateUpdated"`
+	//Goes up by one every time the note is saved, so an editor can tell if it changed since they loaded it
+	Version int `json:"version"`
+	//Filled in when a note is read. Saving a note does not change its tags, SetNoteTags does
+	Tags []string `json:"tags"`
+	//The notebook the note is in, or 0 if it is not in one. Saving a note does not move it, MoveNote does
+	NotebookID int `json:"notebookID"`
+}
+
+//A note in its owners trash
+type TrashedNote struct {
+	Note
+	DateDeleted time.Time `json:"dateDeleted"`
+}
+
+//A file attached to a note. The file itself is kept in the blob store under BlobKey
+type Attachment struct {
+	AttachmentID int `json:"attachmentID"`
+	NoteID       int `json:"noteID"`
+	//The user who uploaded the file
+	UserID   int    `json:"userID"`
+	FileName string `json:"fileName"`
+	//Worked out from the start of the file rather than taken from the upload
+	ContentType string    `json:"contentType"`
+	Size        int64     `json:"size"`
+	BlobKey     string    `json:"-"`
+	DateCreated time.Time `json:"dateCreated"`
+}
+
+//A folder of notes, which can also hold other notebooks
+type Notebook struct {
+	NotebookID int `json:"notebookID"`
+	UserID     int `json:"userID"`
+	//The notebook this one is inside, or 0 for a top level notebook
+	ParentID    int       `json:"parentID"`
+	Name        string    `json:"name"`
+	DateCreated time.Time `json:"dateCreated"`
+}
+
+//The role a user has on every note in a notebook, and in the notebooks inside it
+type NotebookAccess struct {
+	NotebookAccessID int  `json:"notebookAccessID"`
+	NotebookID       int  `json:"notebookID"`
+	UserID           int  `json:"userID"`
+	Role             Role `json:"role"`
 }
 
 type User struct {
-	UserID     int    `json: userID`
-	GivenName  string `json: givenName`
-	FamilyName string `json: familyName`
-	Password   string `json: password`
+	UserID     int    `json:"userID"`
+	GivenName  string `json:"givenName"`
+	FamilyName string `json:"familyName"`
+	Password   string `json:"-"`
 }
 
+//The role a note has been shared with a user as
 type NoteAccess struct {
-	NoteAccessID int  `json: noteAccessID`
-	NoteID       int  `json: noteID`
-	UserID       int  `json: userID`
-	Read         bool `json: read`
-	Write        bool `json: write`
+	NoteAccessID int  `json:"noteAccessID"`
+	NoteID       int  `json:"noteID"`
+	UserID       int  `json:"userID"`
+	Role         Role `json:"role"`
+	//Who shared the note with the user, or last changed their role, and when. 0 and the zero time for access given
+	//before this was recorded
+	GrantedBy   int       `json:"grantedBy"`
+	DateGranted time.Time `json:"dateGranted"`
+}
+
+//A notes title and contents as they were saved at one point in time
+type NoteRevision struct {
+	RevisionID  int       `json:"revisionID"`
+	NoteID      int       `json:"noteID"`
+	UserID      int       `json:"userID"`
+	Title       string    `json:"title"`
+	Contents    string    `json:"contents"`
+	DateCreated time.Time `json:"dateCreated"`
+	//The notes Version once this revision was saved
+	Version int `json:"version"`
 }
 
 type SharedSettings struct {
-	SharedSettingsID int
-	OwnerID          int
-	SharedUserID     int
-	Read             bool
-	Write            bool
-	Name             string
+	SharedSettingsID int    `json:"sharedSettingsID"`
+	OwnerID          int    `json:"ownerID"`
+	SharedUserID     int    `json:"sharedUserID"`
+	Role             Role   `json:"role"`
+	Name             string `json:"name"`
 }
 
-//var notes []Note
-//var users []User
-
-var db *sql.DB
-
 func main() {
-	//Router
-	r := mux.NewRouter()
-
-	/*//mock data
-	//mock users
-	users = append(users, User{UserID: 1, GivenName: "John", FamilyName: "Snow", Password: "hello123"})
-	users = append(users, User{UserID: 2, GivenName: "Bob", FamilyName: "Williams", Password: "hi"})
-	//mock notes
-	notes = append(notes, Note{NoteID: 1, UserID: 1, Title: "my note", Contents: "hi this is a note", DateCreated: time.Now(), DateUpdated: time.Now()})
-	notes = append(notes, Note{NoteID: 2, UserID: 1, Title: "my note 2", Contents: "note2", DateCreated: time.Now(), DateUpdated: time.Now()})
-	notes = append(notes, Note{NoteID: 3, UserID: 2, Title: "my note 3", Contents: "hi cat note", DateCreated: time.Now(), DateUpdated: time.Now()})
-	notes = append(notes, Note{NoteID: 4, UserID: 1, Title: "my note 4", Contents: "hello world", DateCreated: time.Now(), DateUpdated: time.Now()})
-	notes = append(notes, Note{NoteID: 5, UserID: 2, Title: "my note 5", Contents: "hi dog", DateCreated: time.Now(), DateUpdated: time.Now()})
-	notes = append(notes, Note{NoteID: 6, UserID: 2, Title: "my note 6", Contents: "pup hi note", DateCreated: time.Now(), DateUpdated: time.Now()})
-	notes = append(notes, Note{NoteID: 7, UserID: 1, Title: "my note 7", Contents: "hello doggo", DateCreated: time.Now(), DateUpdated: time.Now()})
-	notes = append(notes, Note{NoteID: 8, UserID: 2, Title: "my note 8", Contents: "note is world", DateCreated: time.Now(), DateUpdated: time.Now()})*/
-
-	//set up db
-	setupDB()
-	defer db.Close()
-	//Route Handlers
-	//r.HandleFunc("/Notes", getNotes).Methods("GET")
-	//r.HandleFunc("/Notes/{NoteID}", getNote).Methods("GET")
-	r.HandleFunc("/Users/Notes/{UserID}", getUserNotes).Methods("GET")
-	r.HandleFunc("/Notes/Create/", createNote)         //.Methods("POST")
-	r.HandleFunc("/Notes/Update/{NoteID}", updateNote) //.Methods("PUT")
-	r.HandleFunc("/Notes/Delete/{NoteID}", deleteNote) //.Methods("DELETE")
-	r.HandleFunc("/Users/Create", createUser)          //.Methods("POST")
-	r.HandleFunc("/Users", getUsers).Methods("GET")
-	r.HandleFunc("/Users/LogIn", logIn)                  //.Methods("POST")
-	r.HandleFunc("/Notes/Search/", search)               //.Methods("POST")
-	r.HandleFunc("/Notes/Analyse/{NoteID}", analyseNote) //.Methods("POST")
-	r.HandleFunc("/Notes/Share/{NoteID}", shareNote)
-	r.HandleFunc("/Notes/ViewAccess/{NoteID}", access)
-	r.HandleFunc("/Notes/EditAccess/{NoteID}", editAccess)
-	r.HandleFunc("/Notes/CreateSharedSetting/{NoteID}", saveSharedSettingOnNote)
-	r.HandleFunc("/Users/Logout", logOut)
-
-	log.Fatal(http.ListenAndServe(":8080", r))
-}
-
-func openDB() (db *sql.DB) {
-	//Opens database called "EnterpriseNoteApp"
-	db, err := sql.Open("postgres", "user=postgres password=password dbname=EnterpriseNoteApp sslmode=disable")
-
-	if err != nil {
-		log.Fatal(err)
+	//Schema migrations are run with "entproject migrate" instead of starting the server
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		err := runMigrate(os.Args[2:], os.Getenv, os.Stdout)
+		if err == flag.ErrHelp {
+			return
+		}
+		if err != nil {
+			fmt.Fprintln(os.Stderr, err)
+			os.Exit(1)
+		}
+		return
 	}
 
-	return db
-}
-
-//Connects to database and creates database tables if they dont already exist
-func setupDB() *sql.DB {
-	//Open db from setupDB file
-	db = openDB()
-
-	//Create queries
-	createUserTableQuery := `CREATE TABLE IF NOT EXISTS "User"(
-		UserID SERIAL PRIMARY KEY,
-		GivenName VARCHAR(30),
-		FamilyName VARCHAR(30),
-		Password VARCHAR(30)
-	);`
-
-	createNoteTableQuery := `CREATE TABLE IF NOT EXISTS Note(
-		NoteID SERIAL PRIMARY KEY,
-		UserID INT,
-		Title VARCHAR(30),
-		Contents VARCHAR(1000),
-		DateCreated DATE,
-		DateUpdated DATE,
-		FOREIGN KEY (UserID) REFERENCES "User"(UserID)
-		);`
-
-	createNoteAccessQuery := `CREATE TABLE IF NOT EXISTS NoteAccess (
-		NoteAccessID SERIAL PRIMARY KEY,
-		NoteID INT,
-		UserID INT,
-		Read BOOL,
-		Write BOOL,
-		FOREIGN KEY (NoteID) REFERENCES Note(NoteID),
-		FOREIGN KEY (UserID) REFERENCES "User"(UserID)
-	);`
-
-	createSharedSettingsQuery := `CREATE TABLE IF NOT EXISTS SharedSettings  (
-		SharedSettingsID SERIAL PRIMARY KEY,
-		OwnerID INT, 
-		SharedUserID INT,
-		Read bool,
-		Write bool,
-		Name VARCHAR(30),
-		FOREIGN KEY (OwnerID) REFERENCES "User"(UserID)
-	);`
-
-	//Execute queries
-	_, err := db.Exec(createUserTableQuery)
-	if err != nil {
-		log.Fatal(err)
+	//Load configuration from the config file, environment and flags
+	cfg, err := loadConfig(os.Args[1:], os.Getenv, os.Stderr)
+	if err == flag.ErrHelp {
+		return
 	}
-
-	_, err = db.Exec(createNoteTableQuery)
 	if err != nil {
-		log.Fatal(err)
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
 	}
+	config = cfg
+	currentLogLevel, _ = parseLogLevel(config.LogLevel)
 
-	_, err = db.Exec(createNoteAccessQuery)
+	//set up the store
+	store, err = openStore(config)
 	if err != nil {
 		log.Fatal(err)
 	}
-
-	_, err = db.Exec(createSharedSettingsQuery)
+	defer store.Close()
+	blobs, err = openBlobStore(config)
 	if err != nil {
 		log.Fatal(err)
 	}
-	return db
-}
-
-//Used for Postman
-/*func getNotes(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	rows, err := db.Query(`SELECT * FROM Note`)
-	if err != nil {
-		log.Fatal(err)
+	go purgeTrashEvery(trashPurgeInterval, config.trashRetention())
+	if config.Store == "memory" {
+		logWarn("running in demo mode with sample data, nothing is saved when the server stops")
+		logWarn("demo users: 1 (John Snow, password hello123) and 2 (Bob Williams, password hi)")
 	}
-	var notes []Note
-	var note Note
-
-	for rows.Next() {
 
-		err = rows.Scan(&note.NoteID, &note.UserID, &note.Title, &note.Contents, &note.DateCreated, &note.DateUpdated)
-		if err != nil {
-			log.Fatal(err)
-		}
-		notes = append(notes, note)
+	if config.useTLS() {
+		logInfo("listening for HTTPS on %s", config.Addr)
+		log.Fatal(http.ListenAndServeTLS(config.Addr, config.TLSCert, config.TLSKey, newRouter()))
 	}
+	logInfo("listening for HTTP on %s", config.Addr)
+	log.Fatal(http.ListenAndServe(config.Addr, newRouter()))
+}
 
-	//Error check
-	err = rows.Err()
-	if err != nil {
-		log.Fatal(err)
-	}
+//Builds the router with the HTML pages and the JSON API
+func newRouter() *mux.Router {
+	//Router
+	r := mux.NewRouter()
 
-	json.NewEncoder(w).Encode(notes)
-}*/
+	//Route Handlers
+	r.Handle("/Users/Notes/{UserID:[0-9]{1,9}}", appHandler(getUserNotes)).Methods("GET")
+	r.Handle("/Notes/Create/", appHandler(createNote)).Methods("GET", "POST")
+	r.Handle("/Notes/Update/{NoteID:[0-9]{1,9}}", appHandler(updateNote)).Methods("GET", "POST")
+	r.Handle("/Notes/View/{NoteID:[0-9]{1,9}}", appHandler(viewNote)).Methods("GET")
+	r.Handle("/Notes/Preview/", appHandler(previewNote)).Methods("POST")
+	r.Handle("/Notes/Delete/{NoteID:[0-9]{1,9}}", appHandler(deleteNote)).Methods("GET", "POST")
+	r.Handle("/Notes/Trash/", appHandler(listTrash)).Methods("GET")
+	r.Handle("/Notes/Trash/Restore/{NoteID:[0-9]{1,9}}", appHandler(restoreFromTrash)).Methods("POST")
+	r.Handle("/Notes/Trash/Delete/{NoteID:[0-9]{1,9}}", appHandler(purgeFromTrash)).Methods("POST")
+	r.Handle("/Notes/Attachments/{NoteID:[0-9]{1,9}}", appHandler(attachFile)).Methods("POST")
+	r.Handle("/Notes/Attachments/{NoteID:[0-9]{1,9}}/{AttachmentID:[0-9]{1,9}}", appHandler(downloadAttachment)).Methods("GET")
+	r.Handle("/Notes/Attachments/Delete/{NoteID:[0-9]{1,9}}/{AttachmentID:[0-9]{1,9}}", appHandler(deleteAttachment)).Methods("POST")
+	r.Handle("/Users/Create", appHandler(createUser)).Methods("GET", "POST")
+	r.Handle("/Users", appHandler(getUsers)).Methods("GET")
+	r.Handle("/Users/LogIn", appHandler(logIn)).Methods("GET", "POST")
+	r.Handle("/Notes/Search/", appHandler(search)).Methods("GET", "POST")
+	r.Handle("/Notes/Analyse/{NoteID:[0-9]{1,9}}", appHandler(analyseNote)).Methods("GET", "POST")
+	r.Handle("/Notes/Share/{NoteID:[0-9]{1,9}}", appHandler(shareNote)).Methods("GET", "POST")
+	r.Handle("/Notes/ViewAccess/{NoteID:[0-9]{1,9}}", appHandler(access)).Methods("GET")
+	r.Handle("/Notes/EditAccess/{NoteID:[0-9]{1,9}}", appHandler(editAccess)).Methods("GET", "POST")
+	r.Handle("/Notes/RevokeAccess/{NoteID:[0-9]{1,9}}", appHandler(revokeNoteAccess)).Methods("POST")
+	r.Handle("/Notes/Transfer/{NoteID:[0-9]{1,9}}", appHandler(transferNotePage)).Methods("GET", "POST")
+	r.Handle("/Notes/Leave/{NoteID:[0-9]{1,9}}", appHandler(leaveNotePage)).Methods("POST")
+	r.Handle("/Notes/CreateSharedSetting/{NoteID:[0-9]{1,9}}", appHandler(saveSharedSettingOnNote)).Methods("GET", "POST")
+	//Logging out changes state, so it is POST only. A link on another site could otherwise log users out, since their
+	//session cookie is sent when following it
+	r.Handle("/Users/Logout", appHandler(logOut)).Methods("POST")
+	r.Handle("/Users/LogoutAll", appHandler(logOutAll)).Methods("POST")
+	r.Handle("/Users/Home", appHandler(home)).Methods("GET")
+	r.Handle("/Users/Dashboard", appHandler(userDashboard)).Methods("GET")
+	r.Handle("/Notebooks/", appHandler(listNotebooks)).Methods("GET")
+	r.Handle("/Notebooks/{NotebookID:[0-9]{1,9}}", appHandler(viewNotebook)).Methods("GET")
+	r.Handle("/Notebooks/Create/", appHandler(createNotebook)).Methods("POST")
+	r.Handle("/Notebooks/Delete/{NotebookID:[0-9]{1,9}}", appHandler(deleteNotebook)).Methods("POST")
+	r.Handle("/Notebooks/Share/{NotebookID:[0-9]{1,9}}", appHandler(shareNotebook)).Methods("GET", "POST")
+	r.Handle("/Notebooks/RevokeAccess/{NotebookID:[0-9]{1,9}}", appHandler(revokeNotebookShare)).Methods("POST")
+	r.Handle("/Notes/Move/{NoteID:[0-9]{1,9}}", appHandler(moveNote)).Methods("POST")
+	r.Handle("/Notes/History/{NoteID:[0-9]{1,9}}", appHandler(noteHistory)).Methods("GET")
+	r.Handle("/Notes/Diff/{NoteID:[0-9]{1,9}}", appHandler(noteDiff)).Methods("GET")
+	r.Handle("/Notes/Restore/{NoteID:[0-9]{1,9}}/{RevisionID:[0-9]{1,9}}", appHandler(restoreNote)).Methods("POST")
+
+	//mux only runs middleware for matched routes, so these get their request ID directly
+	r.NotFoundHandler = withRequestID(appHandler(func(w http.ResponseWriter, r *http.Request) error {
+		return notFound("That page does not exist.")
+	}))
+	r.MethodNotAllowedHandler = withRequestID(appHandler(func(w http.ResponseWriter, r *http.Request) error {
+		return &appError{Code: http.StatusMethodNotAllowed, Message: "That page can not be used this way."}
+	}))
+
+	//JSON API
+	r.PathPrefix("/api/").Handler(apiRouter())
+
+	//Every request gets an ID for its log lines, and a panic in any handler becomes a 500 instead of a dropped connection.
+	//Routes with a note are then checked against the users role on it
+	r.Use(withRequestID, recoverPanics, authoriseNoteRoutes(false))
+
+	return r
+}
+
+//Parses a template from the configured template directory
+func parseTemplate(name string) (*template.Template, error) {
+	return template.ParseFiles(filepath.Join(config.TemplateDir, name))
+}
+
+//Parses an ID typed into a form or sent in a request body. IDs are positive and must fit in a Postgres INT
+func parseID(s string) (int, error) {
+	id, err := strconv.ParseInt(s, 10, 32)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid id %q", s)
+	}
+	return int(id), nil
+}
+
+//Gets an ID from the route. The route patterns only match short runs of digits, so this always parses
+func routeID(r *http.Request, name string) int {
+	id, _ := strconv.Atoi(mux.Vars(r)[name])
+	return id
+}
+
+//Gets the logged in users session. Redirects to the log in page and returns a nil session if nobody is logged in
+func requireSession(w http.ResponseWriter, r *http.Request) (*Session, error) {
+	session, err := checkLoggedIn(r)
+	if err != nil {
+		return nil, err
+	}
+	if session == nil {
+		http.Redirect(w, r, "/Users/LogIn", http.StatusSeeOther)
+	}
+	return session, nil
+}
 
-//Displays a list of all users within the database and their details
-func getUsers(w http.ResponseWriter, r *http.Request) {
+//Displays a list of all users and their details
+func getUsers(w http.ResponseWriter, r *http.Request) error {
 	//Check if the user is logged in
-	cookie := checkLoggedIn(r)
-	if cookie == nil {
-		http.Redirect(w, r, "/Users/LogIn", http.StatusSeeOther)
-		return
+	session, err := requireSession(w, r)
+	if session == nil {
+		return err
 	}
 	//User List template
-	t, err := template.ParseFiles("templates\\UserList.html")
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	//Gets user list from database
-	users := getUsersSQL()
-
-	err = t.Execute(w, users)
+	t, err := parseTemplate("UserList.html")
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-}
 
-//Gets a list of all users within the database and their details
-func getUsersSQL() []User {
-	rows, err := db.Query(`SELECT userID, givenName, familyName FROM "User"`)
+	//Gets user list
+	users, err := store.GetUsers()
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
 
-	var users []User
-	var user User
-
-	//Put SQL data into object
-	for rows.Next() {
-		err = rows.Scan(&user.UserID, &user.GivenName, &user.FamilyName)
-		if err != nil {
-			log.Fatal(err)
-		}
-		//Adds each user to user list
-		users = append(users, user)
-	}
-	return users
+	return t.Execute(w, users)
 }
 
-//Used for Postman
-/*func getNote(w http.ResponseWriter, r *http.Request) {
-	w.Header().Set("Content-Type", "application/json")
-	params := mux.Vars(r)
-	rows, err := db.Query(`SELECT * FROM note WHERE note.noteid = ` + params["NoteID"])
-	if err != nil {
-		log.Fatal(err)
-	}
-	var note Note
-	for rows.Next() {
-
-		err = rows.Scan(&note.NoteID, &note.UserID, &note.Title, &note.Contents, &note.DateCreated, &note.DateUpdated)
-		if err != nil {
-			log.Fatal(err)
-		}
-
-	}
-	json.NewEncoder(w).Encode(note)
-
-}*/
-
 //Gets all user notes
-func getUserNotes(w http.ResponseWriter, r *http.Request) {
-	params := mux.Vars(r)
+func getUserNotes(w http.ResponseWriter, r *http.Request) error {
 	//Checks if the user is logged in
-	cookie := checkLoggedIn(r)
-	if cookie == nil {
-		http.Redirect(w, r, "/Users/LogIn", http.StatusSeeOther)
-		return
+	session, err := requireSession(w, r)
+	if session == nil {
+		return err
 	}
 	//Checks the users ID of the given route
-	if cookie.Value == params["UserID"] {
-		t, err := template.ParseFiles("templates\\userhome.html")
+	if session.UserID == routeID(r, "UserID") {
+		t, err := parseTemplate("userhome.html")
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
-		//gets a list of users notes from database
-		userNotes := getUserNotesSQL(params["UserID"])
-
-		err = t.Execute(w, userNotes)
+		//gets a list of notes the user owns or can read, narrowed down to the tags in the query string
+		tags, err := parseTags(r.URL.Query().Get("tags"))
 		if err != nil {
-			log.Fatal(err)
-
+			return err
 		}
-	} else {
-		//if they are trying to go to another users notes then redirect them to log in
-		http.Redirect(w, r, "/Users/LogIn", http.StatusSeeOther)
-	}
-
-}
-
-//gets a list of users notes from database where the are either the owner or have read permission
-func getUserNotesSQL(params string) []Note {
-	rows, err := db.Query(`SELECT DISTINCT note.noteid,note.userid,note.title,note.contents,note.datecreated,note.dateupdated FROM note LEFT JOIN noteaccess ON note.noteid = noteaccess.noteid WHERE note.userid = ` + params + ` OR (noteaccess.userid = ` + params + ` AND noteaccess.read = true)`)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	var userNotes []Note
-	var note Note
-
-	for rows.Next() {
-		//Put SQL data into object
-		err = rows.Scan(&note.NoteID, &note.UserID, &note.Title, &note.Contents, &note.DateCreated, &note.DateUpdated)
+		userNotes, err := store.GetUserNotes(session.UserID)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
-		//Adds each note to userNotes
-		userNotes = append(userNotes, note)
-	}
-	return userNotes
+		counts, err := store.GetTagCounts(session.UserID)
+		if err != nil {
+			return err
+		}
+		return t.Execute(w, struct {
+			UserID int
+			Notes  []Note
+			Tags   []string
+			Cloud  []cloudTag
+		}{session.UserID, filterByTags(userNotes, tags), tags, tagCloud(counts)})
+	}
+	//if they are trying to go to another users notes then redirect them to log in
+	http.Redirect(w, r, "/Users/LogIn", http.StatusSeeOther)
+	return nil
 }
 
 //Creates a note
-func createNote(w http.ResponseWriter, r *http.Request) {
+func createNote(w http.ResponseWriter, r *http.Request) error {
 	//Checks if user is logged in
-	cookie := checkLoggedIn(r)
-	if cookie == nil {
-		http.Redirect(w, r, "/Users/LogIn", http.StatusSeeOther)
-		return
+	session, err := requireSession(w, r)
+	if session == nil {
+		return err
 	}
 
-	t, err := template.ParseFiles("templates\\createnote.html")
-	if err != nil {
-		log.Fatal(err)
-	}
-	//Gets saved select settings for owner
-	settings := createNoteSelectSQL(cookie.Value)
-
 	//Inserts the new note with the given form data then redirects back to user home page
 	if r.Method == "POST" {
-		createNoteInsertSQL(cookie.Value, r.FormValue("title"), r.FormValue("content"), r.FormValue("settingSelect"))
-		http.Redirect(w, r, "/Users/Notes/"+cookie.Value, http.StatusSeeOther)
+		tags, _, err := formTags(r)
+		if err != nil {
+			return err
+		}
+		note, err := saveNewNote(session.UserID, r.FormValue("title"), r.FormValue("content"), r.FormValue("settingSelect"))
+		if err != nil {
+			return err
+		}
+		err = store.SetNoteTags(note.NoteID, tags)
+		if err != nil {
+			return err
+		}
+		http.Redirect(w, r, "/Users/Notes/"+strconv.Itoa(session.UserID), http.StatusSeeOther)
+		return nil
 	}
 
-	err = t.Execute(w, settings)
+	t, err := parseTemplate("createnote.html")
 	if err != nil {
-		log.Fatal(err)
-
+		return err
+	}
+	//Gets saved select settings for owner
+	settings, err := sharedSettingNames(session.UserID)
+	if err != nil {
+		return err
 	}
-}
 
-//Gets saved select settings for owner
-func createNoteSelectSQL(userID string) []SharedSettings {
-	var settings []SharedSettings
-	var setting SharedSettings
+	return t.Execute(w, settings)
+}
 
-	rows, err := db.Query(`SELECT DISTINCT name FROM SharedSettings WHERE OwnerID = ` + userID)
+//Gets the names of the shared settings an owner has saved, once each
+func sharedSettingNames(ownerID int) ([]SharedSettings, error) {
+	settings, err := store.GetSharedSettings(ownerID)
 	if err != nil {
-		log.Fatal(err)
+		return nil, err
 	}
-
-	for rows.Next() {
-		//Put SQL data into object
-		err = rows.Scan(&setting.Name)
-		if err != nil {
-			log.Fatal(err)
+	var names []SharedSettings
+	seen := make(map[string]bool)
+	for _, setting := range settings {
+		if !seen[setting.Name] {
+			seen[setting.Name] = true
+			names = append(names, SharedSettings{Name: setting.Name})
 		}
-		//Add each setting to settings
-		settings = append(settings, setting)
 	}
-	return settings
+	return names, nil
 }
 
-//Inserts the given note data into the note table. Return true if successful
-func createNoteInsertSQL(userID string, title string, content string, selectSetting string) bool {
-	var newNote Note
-	var err error
-
-	newNote.UserID, err = strconv.Atoi(userID)
+//Saves a new note, then shares it with everyone in the named shared setting
+func saveNewNote(userID int, title string, content string, selectSetting string) (Note, error) {
+	err := validateNote(title, content)
 	if err != nil {
-		log.Fatal(err)
+		return Note{}, err
 	}
-	newNote.Title = title
-	newNote.Contents = content
 	date := time.Now()
-	newNote.DateCreated = date
-	newNote.DateUpdated = date
-
-	//Prepare query
-	//Inserts the given note data into the note table
-	query := `INSERT INTO Note (UserID, Title, Contents, DateCreated, DateUpdated) VALUES ($1, $2, $3, $4, $5) RETURNING NoteID;`
-	stmt, err := db.Prepare(query)
+	newNote, err := store.CreateNote(Note{UserID: userID, Title: title, Contents: content, DateCreated: date, DateUpdated: date})
 	if err != nil {
-		log.Fatal(err)
-		return false
+		return newNote, err
 	}
 
-	var noteID int
-	err = stmt.QueryRow(newNote.UserID, newNote.Title, newNote.Contents, newNote.DateCreated, newNote.DateUpdated).Scan(&noteID)
+	settings, err := store.GetSharedSettings(userID)
 	if err != nil {
-		log.Fatal(err)
-		return false
+		return newNote, err
 	}
-	newNote.NoteID = noteID
-
-	selectedSetting := selectSetting
-
-	var setting SharedSettings
-	//Sets given shared setting onto the note
-	rows, err := db.Query(`SELECT SharedSettings.SharedUserID, SharedSettings.Read, SharedSettings.Write FROM SharedSettings WHERE OwnerID = ` + userID + `AND SharedSettings.Name = '` + selectedSetting + `'`)
-	if err != nil {
-		log.Fatal(err)
-		return false
-	}
-	for rows.Next() {
-		err = rows.Scan(&setting.SharedUserID, &setting.Read, &setting.Write)
-		if err != nil {
-			log.Fatal(err)
-			return false
-		}
-		//Creates the note access for the new note using the shared settings permissions
-		query := `INSERT INTO NoteAccess (NoteID, UserID, Read, Write) VALUES ($1, $2, $3, $4)`
-		stmt, err := db.Prepare(query)
-		if err != nil {
-			log.Fatal(err)
-			return false
+	for _, setting := range settings {
+		if setting.Name != selectSetting {
+			continue
 		}
-		_, err = stmt.Exec(noteID, setting.SharedUserID, setting.Read, setting.Write)
+		//Creates the note access for the new note using the shared settings role
+		_, err = store.AddAccess(NoteAccess{NoteID: newNote.NoteID, UserID: setting.SharedUserID, Role: setting.Role, GrantedBy: userID, DateGranted: date})
 		if err != nil {
-			log.Fatal(err)
-			return false
+			return newNote, err
 		}
-
 	}
-	return true
+	return newNote, nil
 }
 
 //Edits the notes title and content based on the given form input
-func updateNote(w http.ResponseWriter, r *http.Request) {
-	params := mux.Vars(r)
-
+func updateNote(w http.ResponseWriter, r *http.Request) error {
 	//Checks if the user is logged in
-	cookie := checkLoggedIn(r)
-	if cookie == nil {
-		http.Redirect(w, r, "/Users/LogIn", http.StatusSeeOther)
-		return
+	session, err := requireSession(w, r)
+	if session == nil {
+		return err
 	}
-	//Gets the users writevalue and gets the orignal note
-	writeValue, note := updateNoteSelectSQL(params["NoteID"])
-	id := strconv.Itoa(note.NoteID)
+	//Gets the orignal note. authoriseNoteRoutes has already checked the users role lets them edit it
+	note, role := routeNote(r)
 
-	//If they dont have write permission then redirect them to user home
-	if id != cookie.Value && writeValue == false {
-		http.Redirect(w, r, "/Users/Notes/"+cookie.Value, http.StatusSeeOther)
-	}
-
-	t, err := template.ParseFiles("templates\\updatenote.html")
-	if err != nil {
-		log.Fatal(err)
-	}
 	//Updates the note with the given form values
 	if r.Method == "POST" {
-		updateNoteInsertSQL(r.FormValue("title"), r.FormValue("content"), params["NoteID"])
-		http.Redirect(w, r, "/Users/Notes/"+cookie.Value, http.StatusSeeOther)
-	}
-	err = t.Execute(w, note)
-	if err != nil {
-		log.Fatal(err)
-	}
-}
-
-//Get the writevalue from the user and the orignal note
-func updateNoteSelectSQL(noteID string) (bool, Note) {
-	var writeValue bool
-	var note Note
-	//Gets the users writevalue
-	rows, err := db.Query(`SELECT noteaccess.write From Noteaccess WHERE noteaccess.noteid = ` + noteID)
-	if err != nil {
-		log.Fatal(err)
-	}
-
-	for rows.Next() {
-		err = rows.Scan(&writeValue)
+		//The form carries the version of the note the user started editing, so their save can not silently undo
+		//someone elses
+		version, err := parseID(r.FormValue("version"))
 		if err != nil {
-			log.Fatal(err)
+			return badRequest("The form is missing the version of the note you edited. Reload the page and try again.")
 		}
-	}
-	//Gets the orignal note
-	noterow, err := db.Query(`SELECT note.userid,note.title,note.contents FROM note WHERE note.noteid = ` + noteID)
-
-	for noterow.Next() {
-		err = noterow.Scan(&note.NoteID, &note.Title, &note.Contents)
+		tags, hasTags, err := formTags(r)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
+		err = validateNote(r.FormValue("title"), r.FormValue("content"))
+		if err != nil {
+			return err
+		}
+		note.Title = r.FormValue("title")
+		note.Contents = r.FormValue("content")
+		note.DateUpdated = time.Now()
+		note.Version = version
+		if hasTags {
+			note.Tags = tags
+		}
+		err = store.UpdateNote(note, session.UserID)
+		if err == errConflict {
+			return renderMerge(w, note)
+		}
+		if err != nil {
+			return err
+		}
+		if hasTags {
+			err = store.SetNoteTags(note.NoteID, tags)
+			if err != nil {
+				return err
+			}
+		}
+		http.Redirect(w, r, "/Users/Notes/"+strconv.Itoa(session.UserID), http.StatusSeeOther)
+		return nil
 	}
-	return writeValue, note
-}
-
-//Updates the note with the given form values
-func updateNoteInsertSQL(title string, contents string, noteID string) bool {
-	var newNote Note
-	newNote.Title = title
-	newNote.Contents = contents
-
-	//Updates note with new values
-	query := `UPDATE Note SET title = $1, contents = $2, dateupdated = $3 WHERE Note.noteid =` + noteID
-	stmt, err := db.Prepare(query)
-	if err != nil {
-		log.Fatal(err)
-		return false
-	}
-	//Get todays date
-	date := time.Now()
-	_, err = stmt.Exec(newNote.Title, newNote.Contents, date)
-	if err != nil {
-		log.Fatal(err)
-		return false
-	}
-	return true
-}
-
-//Checks whether user logged in is the owner
-func isOwner(w http.ResponseWriter, r *http.Request) bool {
-	params := mux.Vars(r)
-	//Checks if user is logged in
-	cookie := checkLoggedIn(r)
-	if cookie == nil {
-		http.Redirect(w, r, "/Users/LogIn", http.StatusSeeOther)
-		return false
-	}
-	//Get the userid for a note
-	userValue := isOwnerSQL(params["NoteID"], cookie.Value)
-
-	if strconv.Itoa(userValue) != cookie.Value {
-		http.Redirect(w, r, "/Users/Notes/"+cookie.Value, http.StatusSeeOther)
-		return false
-	}
-	//Returns true if owner
-	return true
-}
 
-//Gets the UserID for a note
-func isOwnerSQL(noteID string, userID string) int {
-	var userValue int
-
-	rows, err := db.Query(`SELECT userid FROM note WHERE note.noteid = ` + noteID + ` AND note.userid = ` + userID)
+	t, err := parseTemplate("updatenote.html")
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-
-	for rows.Next() {
-		//Put SQL data into object
-		err = rows.Scan(&userValue)
+	//Only the owner can move a note, so only they are given notebooks to pick from
+	var notebooks []Notebook
+	if role.can(capMove) {
+		notebooks, err = store.GetUserNotebooks(session.UserID)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
 	}
-	return userValue
+	return t.Execute(w, struct {
+		Note
+		Owner     bool
+		Notebooks []Notebook
+	}{note, role == roleOwner, notebooks})
 }
 
-//Deletes a note
-func deleteNote(w http.ResponseWriter, r *http.Request) {
-	params := mux.Vars(r)
+//Asks the user to confirm deleting a note, then moves it to the owners trash
+func deleteNote(w http.ResponseWriter, r *http.Request) error {
 	//Checks if user is logged in
-	cookie := checkLoggedIn(r)
-	if cookie == nil {
-		http.Redirect(w, r, "/Users/LogIn", http.StatusSeeOther)
-		return
+	session, err := requireSession(w, r)
+	if session == nil {
+		return err
 	}
-	//Checks if the user is the onwer of the note before deleting it
-	if isOwner(w, r) {
-		//Deletes given note
-		deleteNoteSQL(params["NoteID"])
-		http.Redirect(w, r, "/Users/Notes/"+cookie.Value, http.StatusSeeOther)
+	//authoriseNoteRoutes has already checked the users role lets them delete the note
+	note, _ := routeNote(r)
+	//When the delete is confirmed
+	if r.Method == "POST" {
+		err = trashNote(session.UserID, note.NoteID)
+		if err != nil {
+			return err
+		}
+		http.Redirect(w, r, "/Users/Notes/"+strconv.Itoa(session.UserID), http.StatusSeeOther)
+		return nil
 	}
-}
 
-//Deletes given note
-func deleteNoteSQL(NoteID string) bool {
-	//First deletes the note access for the note
-	_, err := db.Exec(`DELETE FROM NoteAccess WHERE NoteAccess.noteid = ` + NoteID)
-	if err != nil {
-		log.Fatal(err)
-		return false
-	}
-	//Deletes the note
-	_, err = db.Exec(`DELETE FROM note WHERE note.noteid = ` + NoteID)
+	t, err := parseTemplate("deletenote.html")
 	if err != nil {
-		log.Fatal(err)
-		return false
+		return err
 	}
-	return true
+	return t.Execute(w, struct {
+		Note
+		Retention string
+	}{note, describeRetention(config.trashRetention())})
 }
 
 //Creates a new user
-func createUser(w http.ResponseWriter, r *http.Request) {
-	t, err := template.ParseFiles("templates\\createaccount.html")
-	if err != nil {
-		log.Fatal(err)
-	}
-	var newUser User
+func createUser(w http.ResponseWriter, r *http.Request) error {
 	//When account data submitted
 	if r.Method == "POST" {
 		//If they dont enter all data then send them back to create account
 		if r.FormValue("givenName") == "" || r.FormValue("familyName") == "" || r.FormValue("password") == "" {
 			http.Redirect(w, r, "/Users/Create", http.StatusSeeOther)
-
-		} else {
-			//Creates the user from the given form data
-			newUser = createUserSQL(r.FormValue("givenName"), r.FormValue("familyName"), r.FormValue("password"))
-			t2, err := template.ParseFiles("templates\\accountcreated.html")
-			if err != nil {
-				log.Fatal(err)
-			}
-
-			err = t2.Execute(w, newUser)
-			if err != nil {
-				log.Fatal(err)
-			}
+			return nil
+		}
+		//bcrypt can not hash longer passwords, so say why rather than sending them back with no explanation
+		if len(r.FormValue("password")) > maxPasswordLength {
+			return badRequest("Passwords can be at most " + strconv.Itoa(maxPasswordLength) + " bytes long.")
+		}
+		//Creates the user from the given form data
+		newUser, err := registerUser(r.FormValue("givenName"), r.FormValue("familyName"), r.FormValue("password"))
+		if err != nil {
+			return err
 		}
-	} else {
-		err = t.Execute(w, nil)
+		t, err := parseTemplate("accountcreated.html")
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
+		return t.Execute(w, newUser)
 	}
-}
 
-//Creates a new user in the database from the given data
-func createUserSQL(givenName string, familyName string, password string) User {
-	var newUser User
-	//Assign input values to newUser
-	newUser.GivenName = givenName
-	newUser.FamilyName = familyName
-	newUser.Password = password
-
-	//Prepare query to insert into DB
-	//Inserts new user
-	query := `INSERT INTO "User" (GivenName, FamilyName, Password) VALUES ($1, $2, $3) RETURNING UserID;`
-	stmt, err := db.Prepare(query)
-	if err != nil {
-		log.Fatal(err)
-	}
-	//Used to return UserID so we can display it to the user
-	userID := 0
-	err = stmt.QueryRow(newUser.GivenName, newUser.FamilyName, newUser.Password).Scan(&userID)
+	t, err := parseTemplate("createaccount.html")
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-	newUser.UserID = userID
-	return newUser
+	return t.Execute(w, nil)
 }
 
-//Check password and UserID matches and exist in db when a user logs in
-func checkPassword(password string, userID int) bool {
-	var newpass string
+//Given names, family names and shared setting names are kept in VARCHAR(30) columns
+const maxNameLength = 30
 
-	query := `SELECT Password FROM "User" WHERE Password = $1 and UserID = $2`
-
-	//Prepare query
-	passwordCheck, err := db.Prepare(query)
-	if err != nil {
-		log.Fatal(err)
+//Checks a name fits in the database, with a message saying which kind of name is too long if it does not
+func validateName(kind string, name string) error {
+	if utf8.RuneCountInString(name) > maxNameLength {
+		return badRequest(kind + " can be at most " + strconv.Itoa(maxNameLength) + " characters long.")
 	}
+	return nil
+}
 
-	err = passwordCheck.QueryRow(password, userID).Scan(&newpass)
-
-	//If rows are empty, no matching password
-	if err == sql.ErrNoRows {
-		return false
+//Creates a new user from the given data, hashing their password
+func registerUser(givenName string, familyName string, password string) (User, error) {
+	if err := validateName("Given names", givenName); err != nil {
+		return User{}, err
+	}
+	if err := validateName("Family names", familyName); err != nil {
+		return User{}, err
 	}
+	hash, err := hashPassword(password)
 	if err != nil {
-		log.Fatal(err.Error())
+		return User{}, err
 	}
-	return true
+	return store.CreateUser(User{GivenName: givenName, FamilyName: familyName, Password: hash})
 }
 
 //Logs a user in
-func logIn(w http.ResponseWriter, r *http.Request) {
+func logIn(w http.ResponseWriter, r *http.Request) error {
 	//Checks if a user is already logged in
-	cookie := checkLoggedIn(r)
-	if cookie != nil {
-		http.Redirect(w, r, "/Users/Notes/"+cookie.Value, http.StatusSeeOther)
-	}
-
-	t, err := template.ParseFiles("templates\\logintemplate.html")
-
+	session, err := checkLoggedIn(r)
 	if err != nil {
-		log.Fatal(err)
+		return err
+	}
+	if session != nil {
+		http.Redirect(w, r, "/Users/Notes/"+strconv.Itoa(session.UserID), http.StatusSeeOther)
+		return nil
 	}
+
 	//Submitted log in data
 	if r.Method == "POST" {
 		idvalue := r.FormValue("id")
@@ -696,439 +576,401 @@ func logIn(w http.ResponseWriter, r *http.Request) {
 		//If they dont enter both userid and password then redirects back to log in
 		if idvalue == "" || passvalue == "" {
 			http.Redirect(w, r, "/Users/LogIn", http.StatusSeeOther)
-
-		} else {
-			var logUser User
-			//Convert input to int
-			id, err := strconv.Atoi(idvalue)
-			if err != nil {
-				log.Fatal(err)
-			}
-			//Set input data to details
-			logUser.UserID = id
-			logUser.Password = passvalue
-			//Checks if the password matches the userid
-			if checkPassword(logUser.Password, logUser.UserID) {
-				//Creates logged-in cookie that stores the userid
-				cookie, err := r.Cookie("logged-in")
-				if err == http.ErrNoCookie {
-					cookie = &http.Cookie{
-						Name:  "logged-in",
-						Value: strconv.Itoa(logUser.UserID),
-						Path:  "/",
-					}
-				}
-				//Sets cookie and redirects to user home
-				http.SetCookie(w, cookie)
-				http.Redirect(w, r, "/Users/Notes/"+cookie.Value, http.StatusSeeOther)
-			} else {
-				http.Redirect(w, r, "/Users/LogIn", http.StatusSeeOther)
-				return
-			}
+			return nil
 		}
-	} else {
-		err = t.Execute(w, nil)
+		var logUser User
+		//Convert input to int
+		id, err := parseID(idvalue)
 		if err != nil {
-			log.Fatal(err)
+			return badRequest("Your User ID should be a number, like the one shown when you created your account.")
 		}
+		//Set input data to details
+		logUser.UserID = id
+		logUser.Password = passvalue
+		//Checks if the password matches the userid
+		match, err := checkPassword(logUser.Password, logUser.UserID)
+		if err != nil {
+			return err
+		}
+		if !match {
+			logWarn("failed log in for user %d from %s", logUser.UserID, r.RemoteAddr)
+			http.Redirect(w, r, "/Users/LogIn", http.StatusSeeOther)
+			return nil
+		}
+		//Starts a new session and stores its token in the session cookie
+		token, err := startSession(logUser.UserID)
+		if err != nil {
+			return err
+		}
+		setSessionCookie(w, token)
+		http.Redirect(w, r, "/Users/Notes/"+strconv.Itoa(logUser.UserID), http.StatusSeeOther)
+		return nil
 	}
 
-}
-
-//Checks whether a user is logged in and returns the cookie
-func checkLoggedIn(r *http.Request) *http.Cookie {
-	cookie, err := r.Cookie("logged-in")
-	if err == http.ErrNoCookie {
-		return nil
+	t, err := parseTemplate("logintemplate.html")
+	if err != nil {
+		return err
 	}
-	return cookie
+	return t.Execute(w, nil)
 }
 
-//Used to search through notes
-func search(w http.ResponseWriter, r *http.Request) {
+//Used to search through notes. The search is read from the query string as well as the form, so searches can be
+//bookmarked
+func search(w http.ResponseWriter, r *http.Request) error {
 	//Checks if a user is already logged in
-	cookie := checkLoggedIn(r)
-	if cookie == nil {
-		http.Redirect(w, r, "/Users/LogIn", http.StatusSeeOther)
-		return
+	session, err := requireSession(w, r)
+	if session == nil {
+		return err
 	}
 	//Searched Notes template
-	t, err := template.ParseFiles("templates\\searchedNotes.html")
+	t, err := parseTemplate("searchedNotes.html")
 	if err != nil {
-		log.Fatal(err)
-	}
-
-	var searchNotes []Note
-
-	//Searches through notes with the given input
-	if r.Method == "POST" {
-		searchNotes = searchSQL(r.FormValue("search"), cookie.Value)
+		return err
 	}
 
-	err = t.Execute(w, searchNotes)
+	//Owners to pick from in the filter
+	users, err := store.GetUsers()
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-}
-
-//Gets notes containing search input to user
-func searchSQL(searchInput string, userid string) []Note {
-	var searchNotes []Note
-	var input = searchInput
 
-	var note Note
+	var results []SearchResult
 
-	fmt.Println(input)
-
-	rows, err := db.Query("SELECT DISTINCT note.NoteID, note.UserId, note.title, note.contents, note.datecreated, note.dateupdated FROM note LEFT JOIN noteaccess ON note.noteid = noteaccess.noteid WHERE (note.userid = " + userid + " OR (noteaccess.userid = " + userid + " AND noteaccess.read = true)) AND note.contents LIKE " + "'%" + searchInput + "%'" + " OR note.Title LIKE " + "'%" + searchInput + "%'")
+	//Searches through notes with the given input and filters
+	err = r.ParseForm()
 	if err != nil {
-		log.Fatal(err)
+		return badRequest("The search could not be read.")
 	}
-
-	for rows.Next() {
-		//Put SQL data into object
-		err = rows.Scan(&note.NoteID, &note.UserID, &note.Title, &note.Contents, &note.DateCreated, &note.DateUpdated)
+	input := r.Form.Get("search")
+	if r.Method == "POST" || len(r.Form) > 0 {
+		query := parseSearchQuery(input)
+		query.Filter, err = parseSearchFilter(r.Form)
 		if err != nil {
-			log.Fatal(err)
+			return err
+		}
+		results, err = store.SearchNotes(session.UserID, query)
+		if err != nil {
+			return err
 		}
-		//Add each note to searchNotes
-		searchNotes = append(searchNotes, note)
-	}
-	err = rows.Err()
-	if err != nil {
-		log.Fatal(err)
 	}
-	return searchNotes
+
+	return t.Execute(w, struct {
+		Search  string
+		Form    url.Values
+		Users   []User
+		Results []SearchResult
+	}{input, r.Form, users, results})
 }
 
-//Searches a term and displays a count. Return true if successful
-func analyseNote(w http.ResponseWriter, r *http.Request) {
-	count := 0
+//Allows a note to be shared to other users
+func shareNote(w http.ResponseWriter, r *http.Request) error {
 	params := mux.Vars(r)
 	//Checks if a user is already logged in
-	cookie := checkLoggedIn(r)
-	if cookie == nil {
-		http.Redirect(w, r, "/Users/LogIn", http.StatusSeeOther)
-		return
-	}
-	//Analyse notes template
-	t, err := template.ParseFiles("templates\\analyseNote.html")
-	if err != nil {
-		log.Fatal(err)
+	session, err := requireSession(w, r)
+	if session == nil {
+		return err
 	}
-	//Analyses the Note with the given input
+	//authoriseNoteRoutes has already checked the users role lets them share the note
+	note, _ := routeNote(r)
+	//When share data is submitted
 	if r.Method == "POST" {
-		count = analyseNoteSQL(r.FormValue("search"), params["NoteID"])
+		//If they dont enter data redirect back to the share page
+		if r.FormValue("userid") == "" {
+			http.Redirect(w, r, "/Notes/Share/"+params["NoteID"], http.StatusSeeOther)
+			return nil
+		}
+		userID, err := parseID(r.FormValue("userid"))
+		if err != nil {
+			return badRequest("The User ID to share with should be a number.")
+		}
+		role, err := formRole(r)
+		if err != nil {
+			return err
+		}
+		_, _, err = shareNoteWith(note, session.UserID, userID, role)
+		if err != nil {
+			return err
+		}
+		//Redirect to home page when submitted
+		http.Redirect(w, r, "/Users/Notes/"+strconv.Itoa(session.UserID), http.StatusSeeOther)
+		return nil
 	}
-	//Passes the noteID and the count to the template
-	err = t.Execute(w, struct {
-		NoteID string
-		Count  int
-	}{params["NoteID"], count})
+
+	//Share template
+	t, err := parseTemplate("share.html")
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
-
+	return t.Execute(w, nil)
 }
 
-//Gets the count of the search input within the note
-func analyseNoteSQL(searchInput string, noteID string) int {
-	count := 0
-	var input string
-	var contents string
-
-	input = searchInput
-
-	rows, err := db.Query("SELECT note.contents FROM Note WHERE Note.Noteid = " + noteID)
-	if err != nil {
-		log.Fatal(err)
-		return 0
+//Saves new note access settings
+func access(w http.ResponseWriter, r *http.Request) error {
+	//Checks if a user is already logged in
+	session, err := requireSession(w, r)
+	if session == nil {
+		return err
 	}
-
-	for rows.Next() {
-		//Put SQL data into object
-		err = rows.Scan(&contents)
-		if err != nil {
-			log.Fatal(err)
-			return 0
-		}
+	//authoriseNoteRoutes has already checked the users role lets them see who the note is shared with
+	note, _ := routeNote(r)
+	//Access teplate
+	t, err := parseTemplate("access.html")
+	if err != nil {
+		return err
 	}
-	err = rows.Err()
+	rows, err := namedAccess(note.NoteID)
 	if err != nil {
-		log.Fatal(err)
-		return 0
+		return err
 	}
-	//Gets the count
-	count = strings.Count(contents, input)
-	return count
-}
 
-//Allows a note to be shared to other users
-func shareNote(w http.ResponseWriter, r *http.Request) {
-	params := mux.Vars(r)
-	//Checks if a user is already logged in
-	cookie := checkLoggedIn(r)
-	if cookie == nil {
-		http.Redirect(w, r, "/Users/LogIn", http.StatusSeeOther)
-		return
-	}
-	//Check if logged in user is the owner of specific note
-	if isOwner(w, r) {
-		//Share template
-		t, err := template.ParseFiles("templates\\share.html")
-		if err != nil {
-			log.Fatal(err)
-		}
-		//When share data is submitted
-		if r.Method == "POST" {
-			//If they dont enter data redirect back to their home page
-			if r.FormValue("userid") != "" {
-				shareNoteSQL(r.FormValue("userid"), r.FormValue("readaccess"), r.FormValue("writeaccess"), params["NoteID"])
-				http.Redirect(w, r, "/Users/Notes/"+cookie.Value, http.StatusSeeOther)
-			} else {
-				//Redirect to home page when submitted
-				http.Redirect(w, r, "/Notes/Share/"+params["NoteID"], http.StatusSeeOther)
-			}
+	return t.Execute(w, struct {
+		Note Note
+		Rows []accessRow
+	}{note, rows})
+}
 
-		}
+//Gets the access rows of everyone a note is shared with. Every role can read the note
+func readAccess(noteID int) ([]NoteAccess, error) {
+	return store.GetAccess(noteID)
+}
 
-		err = t.Execute(w, nil)
-		if err != nil {
-			log.Fatal(err)
-		}
-	}
+//An access row with the names shown on the access pages
+type accessRow struct {
+	NoteAccess
+	Name string
+	//Who granted the access, or "" if that was not recorded
+	GrantedByName string
 }
 
-//Add new access settings to the database based on input
-func shareNoteSQL(userID string, read string, write string, noteID string) bool {
-	var newNoteAccess NoteAccess
-	var err error
-	//Assign input to newNoteAccess
-	newNoteAccess.UserID, err = strconv.Atoi(userID)
+//Gets the access rows on a note along with the names of who they are for and who granted them
+func namedAccess(noteID int) ([]accessRow, error) {
+	accessRows, err := readAccess(noteID)
 	if err != nil {
-		log.Fatal(err)
-		return false
+		return nil, err
 	}
-	//Assign input to newNoteAccess
-	newNoteAccess.NoteID, err = strconv.Atoi(noteID)
+	users, err := store.GetUsers()
 	if err != nil {
-		log.Fatal(err)
-		return false
+		return nil, err
 	}
-
-	readValue := read
-	//If read checkbox is checked
-	if readValue == "on" {
-		newNoteAccess.Read = true
-	} else {
-		newNoteAccess.Read = false
+	names := make(map[int]string)
+	for _, user := range users {
+		names[user.UserID] = user.GivenName + " " + user.FamilyName
 	}
-
-	writeValue := write
-	//If write checkbox is checked
-	if writeValue == "on" {
-		newNoteAccess.Write = true
-		newNoteAccess.Read = true
-	} else {
-		newNoteAccess.Write = false
+	var rows []accessRow
+	for _, access := range accessRows {
+		rows = append(rows, accessRow{NoteAccess: access, Name: names[access.UserID], GrantedByName: names[access.GrantedBy]})
 	}
+	return rows, nil
+}
 
-	//Prepare query
-	query := `INSERT INTO NoteAccess (UserID, NoteID, Read, Write) VALUES ($1, $2, $3, $4)`
-	stmt, err := db.Prepare(query)
-	if err != nil {
-		log.Fatal(err)
-		return false
+//Shares a note with another user as the role given, recording who shared it and when. Sharing with someone it is
+//already shared with changes their role instead, and created is false
+func shareNoteWith(note Note, userID int, sharedUserID int, role Role) (access NoteAccess, created bool, err error) {
+	if sharedUserID == userID {
+		return access, false, badRequest("You can not share a note with yourself.")
+	}
+	if sharedUserID == note.UserID {
+		return access, false, badRequest("That user owns the note, so it does not need sharing with them.")
+	}
+	_, err = store.GetUser(sharedUserID)
+	if err == errNotFound {
+		return access, false, badRequest("That user does not exist.")
 	}
-
-	_, err = stmt.Exec(newNoteAccess.UserID, newNoteAccess.NoteID, newNoteAccess.Read, newNoteAccess.Write)
 	if err != nil {
-		log.Fatal(err)
-		return false
+		return access, false, err
 	}
-
-	return true
+	_, err = store.GetUserAccess(note.NoteID, sharedUserID)
+	if err != nil && err != errNotFound {
+		return access, false, err
+	}
+	created = err == errNotFound
+	access, err = store.AddAccess(NoteAccess{NoteID: note.NoteID, UserID: sharedUserID, Role: role, GrantedBy: userID, DateGranted: time.Now()})
+	return access, created, err
 }
 
-//Saves new note access settings
-func access(w http.ResponseWriter, r *http.Request) {
-	params := mux.Vars(r)
-	//Checks if user is owner of the note
-	if isOwner(w, r) {
-		//Access teplate
-		t, err := template.ParseFiles("templates\\access.html")
-		matches := accessSQL(params["NoteID"])
-
-		err = t.Execute(w, matches)
-		if err != nil {
-			log.Fatal(err)
-		}
+//Changes the role one user has on a note, recording who changed it and when
+func changeAccess(noteID int, sharedUserID int, role Role, grantedBy int) error {
+	err := store.SetUserAccess(NoteAccess{NoteID: noteID, UserID: sharedUserID, Role: role, GrantedBy: grantedBy, DateGranted: time.Now()})
+	if err == errNotFound {
+		return notFound("That note has not been shared with that user.")
 	}
+	return err
 }
 
-//Gets all noteAccess rows included in a note as array of NoteAccess
-func accessSQL(noteID string) []NoteAccess {
-	matching, err := db.Query(`SELECT na.userid, na.noteid, na.Read, na.Write FROM NoteAccess as na INNER JOIN Note on na.noteid = note.noteid WHERE note.noteid =` + noteID + `AND na.read = true`)
-	if err != nil {
-		log.Fatal(err)
+//Stops sharing a note with one user
+func revokeAccess(noteID int, sharedUserID int) error {
+	err := store.RemoveAccess(noteID, sharedUserID)
+	if err == errNotFound {
+		return notFound("That note has not been shared with that user.")
 	}
+	return err
+}
 
-	var matches []NoteAccess
-	var note NoteAccess
-
-	for matching.Next() {
-		//Put SQL data into object
-		err = matching.Scan(&note.UserID, &note.NoteID, &note.Read, &note.Write)
-		if err != nil {
-			log.Fatal(err)
-		}
-		matches = append(matches, note)
+//Reads the user picked in a form on the edit access page
+func formSharedUser(r *http.Request) (int, error) {
+	userID, err := parseID(r.FormValue("userid"))
+	if err != nil {
+		return 0, badRequest("Pick a user the note is shared with.")
 	}
-	return matches
+	return userID, nil
 }
 
 //Allows a user to edit note access settings
-func editAccess(w http.ResponseWriter, r *http.Request) {
-	params := mux.Vars(r)
+func editAccess(w http.ResponseWriter, r *http.Request) error {
 	//Checks if a user is already logged in
-	cookie := checkLoggedIn(r)
-	if cookie == nil {
-		http.Redirect(w, r, "/Users/LogIn", http.StatusSeeOther)
-		return
+	session, err := requireSession(w, r)
+	if session == nil {
+		return err
 	}
-	//Checks if the user is the owner of the note
-	if isOwner(w, r) {
-		t, err := template.ParseFiles("templates\\editaccess.html")
+	//authoriseNoteRoutes has already checked the users role lets them change who the note is shared with
+	note, _ := routeNote(r)
+	//When edit access data is submitted, the role of the one user picked is changed
+	if r.Method == "POST" {
+		sharedUserID, err := formSharedUser(r)
 		if err != nil {
-			log.Fatal(err)
+			return err
 		}
-		//When edit access data is submitted, access is updated based on input
-		if r.Method == "POST" {
-			editAccessSQL(r.FormValue("readaccess"), r.FormValue("writeaccess"), params["NoteID"])
-			http.Redirect(w, r, "/Users/Notes/"+cookie.Value, http.StatusSeeOther)
+		role, err := formRole(r)
+		if err != nil {
+			return err
 		}
-
-		err = t.Execute(w, nil)
+		err = changeAccess(note.NoteID, sharedUserID, role, session.UserID)
 		if err != nil {
-			log.Fatal(err)
-
+			return err
 		}
+		http.Redirect(w, r, "/Notes/EditAccess/"+strconv.Itoa(note.NoteID), http.StatusSeeOther)
+		return nil
 	}
-}
-
-//Updates edit access in database based on user input
-func editAccessSQL(read string, write string, noteID string) bool {
-	var newNoteAccess NoteAccess
 
-	readValue := read
-	//If read checkbox is checked
-	if readValue == "on" {
-		newNoteAccess.Read = true
-	} else {
-		newNoteAccess.Read = false
+	rows, err := namedAccess(note.NoteID)
+	if err != nil {
+		return err
 	}
-
-	writeValue := write
-	//If write checkbox is checked
-	if writeValue == "on" {
-		newNoteAccess.Write = true
-		newNoteAccess.Read = true
-	} else {
-		newNoteAccess.Write = false
+	t, err := parseTemplate("editAccess.html")
+	if err != nil {
+		return err
 	}
+	return t.Execute(w, struct {
+		Note  Note
+		Rows  []accessRow
+		Roles []Role
+	}{note, rows, sharedRoles})
+}
 
-	//Prepare query
-	query := `UPDATE NoteAccess SET read = $1, write = $2 WHERE noteaccess.noteid =` + noteID
-	stmt, err := db.Prepare(query)
+//Stops sharing a note with the user picked on the edit access page
+func revokeNoteAccess(w http.ResponseWriter, r *http.Request) error {
+	//Checks if a user is already logged in
+	session, err := requireSession(w, r)
+	if session == nil {
+		return err
+	}
+	//authoriseNoteRoutes has already checked the users role lets them change who the note is shared with
+	note, _ := routeNote(r)
+	sharedUserID, err := formSharedUser(r)
 	if err != nil {
-		log.Fatal(err)
-		return false
+		return err
 	}
-	//Execute update
-	_, err = stmt.Exec(newNoteAccess.Read, newNoteAccess.Write)
+	err = revokeAccess(note.NoteID, sharedUserID)
 	if err != nil {
-		log.Fatal(err)
-		return false
+		return err
 	}
-
-	return true
+	http.Redirect(w, r, "/Notes/EditAccess/"+strconv.Itoa(note.NoteID), http.StatusSeeOther)
+	return nil
 }
 
 //Allows a user to save certain shared settings and set a name for it
-func saveSharedSettingOnNote(w http.ResponseWriter, r *http.Request) {
-	params := mux.Vars(r)
+func saveSharedSettingOnNote(w http.ResponseWriter, r *http.Request) error {
 	//Checks if a user is already logged in
-	cookie := checkLoggedIn(r)
-	if cookie == nil {
-		http.Redirect(w, r, "/Users/LogIn", http.StatusSeeOther)
-		return
+	session, err := requireSession(w, r)
+	if session == nil {
+		return err
 	}
 
-	t, err := template.ParseFiles("templates\\createSharedSetting.html")
-	if err != nil {
-		log.Fatal(err)
-	}
-	//When user submits their input, insert new SharedSetting row into database then redirect back to their home
+	//authoriseNoteRoutes has already checked the users role lets them share the note
+	note, _ := routeNote(r)
+
+	//When user submits their input, save a shared setting from the notes access then redirect back to their home
 	if r.Method == "POST" {
-		saveSharedSettingOnNoteSQL(r.FormValue("settingName"), params["NoteID"])
-		http.Redirect(w, r, "/Users/Notes/"+cookie.Value, http.StatusSeeOther)
+		err = saveSharedSetting(r.FormValue("settingName"), note.NoteID, session.UserID)
+		if err != nil {
+			return err
+		}
+		http.Redirect(w, r, "/Users/Notes/"+strconv.Itoa(session.UserID), http.StatusSeeOther)
+		return nil
 	}
-	err = t.Execute(w, nil)
+
+	t, err := parseTemplate("createSharedSetting.html")
 	if err != nil {
-		log.Fatal(err)
+		return err
 	}
+	return t.Execute(w, nil)
 }
 
-//Insert new row into SharedSettings table in database with user input
-func saveSharedSettingOnNoteSQL(settingName string, noteID string) bool {
-	var setting SharedSettings
-
-	setting.Name = settingName
-	//Gets the needed data for the insert
-	rows, err := db.Query(`SELECT n.userid as "owner", na.userid, na.read, na.write FROM NoteAccess as na INNER JOIN Note as n ON na.Noteid = n.noteid WHERE N.noteid = ` + noteID)
+//Saves everyone a note is shared with, and their role, as a named shared setting for the user saving it. The caller
+//checks they may share the note
+func saveSharedSetting(settingName string, noteID int, userID int) error {
+	if err := validateName("Shared setting names", settingName); err != nil {
+		return err
+	}
+	accessRows, err := store.GetAccess(noteID)
 	if err != nil {
-		log.Fatal(err)
-		return false
+		return err
 	}
-
-	for rows.Next() {
-		//Put SQL data into object
-		err = rows.Scan(&setting.OwnerID, &setting.SharedUserID, &setting.Read, &setting.Write)
-		if err != nil {
-			log.Fatal(err)
-			return false
+	for _, access := range accessRows {
+		//A co-owner saving the setting is in the access rows themselves, and has no need to share with themselves
+		if access.UserID == userID {
+			continue
 		}
-		//Prepare query
-		query := `INSERT INTO SharedSettings (OwnerID, SharedUserID, Read, Write, Name) VALUES ($1, $2, $3, $4, $5)`
-		stmt, err := db.Prepare(query)
+		err = store.AddSharedSetting(SharedSettings{OwnerID: userID, SharedUserID: access.UserID, Role: access.Role, Name: settingName})
 		if err != nil {
-			log.Fatal(err)
-			return false
-		}
-		_, err = stmt.Exec(setting.OwnerID, setting.SharedUserID, setting.Read, setting.Write, setting.Name)
-		if err != nil {
-			log.Fatal(err)
-			return false
+			return err
 		}
 	}
-	return true
+	return nil
 }
 
 //Logs a user out
-func logOut(w http.ResponseWriter, r *http.Request) {
+func logOut(w http.ResponseWriter, r *http.Request) error {
 	//Checks if a user is already logged in
-	cookie := checkLoggedIn(r)
-	if cookie == nil {
-		http.Redirect(w, r, "/Users/LogIn", http.StatusSeeOther)
-		return
+	session, err := requireSession(w, r)
+	if session == nil {
+		return err
+	}
+	//Ends the session on the server so the token can not be reused, then removes the cookie
+	err = store.DeleteSession(session.SessionID)
+	if err != nil {
+		return err
 	}
-	//Removes the cookie
-	http.SetCookie(w, &http.Cookie{
-		Name:    "logged-in",
-		MaxAge:  -1,
-		Expires: time.Now().Add(-100 * time.Hour), // Set expires for older versions of IE
-		Path:    "/",
-	})
+	clearSessionCookie(w)
 	//Redirect back to log in page
 	http.Redirect(w, r, "/Users/LogIn", http.StatusSeeOther)
+	return nil
+}
+
+//Logs a user out of every session they have, on every device
+func logOutAll(w http.ResponseWriter, r *http.Request) error {
+	//Checks if a user is already logged in
+	session, err := requireSession(w, r)
+	if session == nil {
+		return err
+	}
+	//Ends every session belonging to the user, then removes the cookie
+	err = store.DeleteUserSessions(session.UserID)
+	if err != nil {
+		return err
+	}
+	clearSessionCookie(w)
+	//Redirect back to log in page
+	http.Redirect(w, r, "/Users/LogIn", http.StatusSeeOther)
+	return nil
+}
+
+//Sends a logged in user to their own notes page
+func home(w http.ResponseWriter, r *http.Request) error {
+	session, err := requireSession(w, r)
+	if session == nil {
+		return err
+	}
+	http.Redirect(w, r, "/Users/Notes/"+strconv.Itoa(session.UserID), http.StatusSeeOther)
+	return nil
 }
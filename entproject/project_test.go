@@ -1,7 +1,13 @@
 package main
 
 import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
 	"os"
+	"strconv"
+	"strings"
 	"testing"
 
 	"github.com/stretchr/testify/assert"
@@ -10,67 +16,72 @@ import (
 // --------------------------- Router Tests are found in Router Test.side file located in GitHub and submission ---------------------------
 
 func TestMain(m *testing.M) {
-	setupDB()
-	os.Exit(m.Run())
-}
-
-func TestDatabase(t *testing.T) {
-
-	db := setupDB()
-
-	if assert.NotNil(t, db) {
-		//getUsersSQL() gets existing users from the database and returns them
-		assert.NotNil(t, getUsersSQL(), "getUsersSQL() should return a list of users")
-		//getUserNotesSQL() gets notes from the given user using their UserID and returns them
-		userNotes := getUserNotesSQL("1")
-		assert.NotEmpty(t, userNotes, "getUserNotesSQL() should not be empty")
-		//updateNoteInsertSQL() updates a note based on input and returns true if sucessful
-		assert.True(t, updateNoteInsertSQL("Updated title", "Updated contents", "1"), "updateNoteInsertSQL() should return true")
-		//isOwnerSQL() checks if logged in user is the owner of a note and returns the ownerID
-		ownerID := isOwnerSQL("1", "1")
-		assert.NotZero(t, ownerID, "isOwnerSQL() should not return zero")
-		//deleteNoteSQL() deletes a note based on a given NoteID returns true if sucessful
-		assert.True(t, deleteNoteSQL("2"), "deleteNoteSQL() should return true")
-		//createUserSQL() creates a new user based on input and returns the user
-		newUser := createUserSQL("New", "User", "password")
-		assert.NotNil(t, newUser, "createUserSQL() should return a user")
-		//searchSQL() searches a note based on input on a given NoteID, returns array of notes containing input
-		searchedNotes := searchSQL("content", "1")
-		assert.NotEmpty(t, searchedNotes, "searchedNotes() should not be empty")
-		//analyseNoteSQL() analyses a note based on input on a given NoteID and returns a count
-		newAnalyseNote := analyseNoteSQL("content", "1")
-		assert.NotZero(t, newAnalyseNote, "analyseNoteSQL() should not return zero")
-		//shareNoteSQL() shares a note based on input and returns true if sucessful
-		assert.True(t, shareNoteSQL("1", "on", "on", "4"), "shareNoteSQL() should return true")
-		//accessSQL() gets existing access and returns them
-		newAccess := accessSQL("1")
-		assert.NotEmpty(t, newAccess, "accessSQL() should not be empty")
-		//editAccessSQL() edits an access setting and returns true if successful
-		assert.True(t, editAccessSQL("on", "on", "4"), "editAccessSQL() should return true")
-		//saveSharedSettingOnNoteSQL() saves shared settings based on input and NoteID and returns true if successful
-		assert.True(t, saveSharedSettingOnNoteSQL("test", "400"), "saveSharedSettingOnNoteSQL() should return true")
-		//createNoteSelectSQL() returns the SharedSettings based on logged in user and returns them as array
-		settings := createNoteSelectSQL("1")
-		assert.NotEmpty(t, settings, "createNoteSelectSQL() should not be empty")
-		//createNoteInsertSQL() creates a new note and returns true if successful
-		assert.True(t, createNoteInsertSQL("1", "test title", "test contents", "none"), "createNoteInsertSQL() should return true")
-		//updateNoteSelectSQL() updates a note based on a NoteID
-		writevalue, id := updateNoteSelectSQL("1")
-		//returns true if successfully updated
-		assert.True(t, writevalue, "updateNoteSelectSQL() writevalue should return true")
-		//check if id is not empty
-		assert.NotEqual(t, "", id, "updateNoteSelectSQL() id should not be empty")
+	config.SessionSecret = testSecret
+	//Tests run against the in-memory store with the demo data, or against the Postgres database in NOTEAPP_TEST_DSN
+	//when it is set
+	var err error
+	if dsn := os.Getenv("NOTEAPP_TEST_DSN"); dsn != "" {
+		err = runMigrate([]string{"-dsn", dsn, "up"}, fakeEnv(nil), io.Discard)
+		if err == nil {
+			store, err = newPGStore(dsn)
+		}
+	} else {
+		store, err = openStore(Config{Store: "memory"})
+	}
+	if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
 	}
+	//Attachments are kept in memory whichever store is used, so tests never write files
+	blobs = newMemBlobStore()
+	os.Exit(m.Run())
 }
 
 func TestCheckPassword(t *testing.T) {
 	pass := "password"
-	id := 1
+	user, err := registerUser("Check", "Password", pass)
+	if err != nil {
+		t.Fatal(err)
+	}
+	id := user.UserID
 
 	expected := true
-	observed := checkPassword(pass, id)
+	observed, err := checkPassword(pass, id)
 
+	if err != nil {
+		t.Errorf("Expected no error but returned %v", err)
+	}
 	if observed != expected {
 		t.Errorf("Expected true but returned false")
 	}
 }
+
+func TestNameLengths(t *testing.T) {
+	//Names are counted in characters, as Postgres counts VARCHAR lengths
+	longest := strings.Repeat("é", maxNameLength)
+	tooLong := strings.Repeat("a", maxNameLength+1)
+
+	user, err := registerUser(longest, longest, "password")
+	assert.NoError(t, err)
+	_, err = registerUser(tooLong, "Family", "password")
+	assert.Equal(t, http.StatusBadRequest, errorCode(err))
+	_, err = registerUser("Given", tooLong, "password")
+	assert.Equal(t, http.StatusBadRequest, errorCode(err))
+
+	rec := formRequest("/Users/Create", 0, url.Values{"givenName": {tooLong}, "familyName": {"Family"}, "password": {"password"}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Given names can be at most 30 characters long.")
+	rec = apiRequest("POST", "/api/v1/users", 0, userRequest{GivenName: "Given", FamilyName: tooLong, Password: "password"})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	note, err := saveNewNote(user.UserID, "title", "contents", "")
+	assert.NoError(t, err)
+	id := strconv.Itoa(note.NoteID)
+	rec = formRequest("/Notes/CreateSharedSetting/"+id, user.UserID, url.Values{"settingName": {tooLong}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Shared setting names can be at most 30 characters long.")
+	rec = apiRequest("POST", "/api/v1/notes/"+id+"/sharedsettings", user.UserID, sharedSettingRequest{Name: tooLong})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = apiRequest("POST", "/api/v1/notes/"+id+"/sharedsettings", user.UserID, sharedSettingRequest{Name: longest})
+	assert.Equal(t, http.StatusCreated, rec.Code)
+}
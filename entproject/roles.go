@@ -0,0 +1,161 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+)
+
+//What a user can do with a note. Notes are shared with a role, and sharing a notebook gives that role on every note
+//in it
+type Role string
+
+const (
+	roleViewer    Role = "viewer"
+	roleCommenter Role = "commenter"
+	roleEditor    Role = "editor"
+	roleCoOwner   Role = "co-owner"
+	//The user who created a note. Held in Note.UserID rather than an access row, so it can not be shared
+	roleOwner Role = "owner"
+)
+
+//Roles a note or notebook can be shared with, least first
+var sharedRoles = []Role{roleViewer, roleCommenter, roleEditor, roleCoOwner}
+
+//Something a user may be allowed to do with a note
+type capability string
+
+const (
+	//Read a note, its history and analysis, and download its attachments
+	capView capability = "view"
+	//Comment on a note. Notes have no comments yet, so this is only kept in the matrix for when they do
+	capComment capability = "comment"
+	//Change a notes title, contents and tags, restore old revisions and add or delete attachments
+	capEdit capability = "edit"
+	//Share a note, see and change who it is shared with and save its sharing as a shared setting
+	capShare capability = "share"
+	//Move a note to the trash
+	capDelete capability = "delete"
+	//Move a note between notebooks. Notebooks belong to one user, so only the owner can
+	capMove capability = "move"
+	//Give a note to another user, making them its owner. Only the owner can
+	capTransfer capability = "transfer"
+)
+
+//What each role can do. Every check on a note goes through this
+var roleCapabilities = map[Role][]capability{
+	roleViewer:    {capView},
+	roleCommenter: {capView, capComment},
+	roleEditor:    {capView, capComment, capEdit},
+	roleCoOwner:   {capView, capComment, capEdit, capShare, capDelete},
+	roleOwner:     {capView, capComment, capEdit, capShare, capDelete, capMove, capTransfer},
+}
+
+//How each capability is described in errors, finishing "Your role on this note does not let you ..."
+var capabilityActions = map[capability]string{
+	capView:     "view it",
+	capComment:  "comment on it",
+	capEdit:     "change it",
+	capShare:    "share it or change who it is shared with",
+	capDelete:   "delete it",
+	capMove:     "move it to another notebook",
+	capTransfer: "give it to someone else",
+}
+
+//Whether a role allows something. An empty role, for no access, allows nothing
+func (role Role) can(action capability) bool {
+	for _, allowed := range roleCapabilities[role] {
+		if allowed == action {
+			return true
+		}
+	}
+	return false
+}
+
+//Orders roles from no access up to the owner, so the larger of two roles can be found
+func (role Role) rank() int {
+	if role == roleOwner {
+		return len(sharedRoles) + 1
+	}
+	for i, shared := range sharedRoles {
+		if shared == role {
+			return i + 1
+		}
+	}
+	return 0
+}
+
+//The role that allows more of two
+func maxRole(a Role, b Role) Role {
+	if b.rank() > a.rank() {
+		return b
+	}
+	return a
+}
+
+//Role names for showing to users, such as "Co-owner"
+func (role Role) Title() string {
+	if role == "" {
+		return "No access"
+	}
+	return strings.ToUpper(string(role[:1])) + string(role[1:])
+}
+
+//Checks a role typed into a form or sent to the API is one notes can be shared with
+func parseRole(value string) (Role, error) {
+	for _, role := range sharedRoles {
+		if string(role) == value {
+			return role, nil
+		}
+	}
+	return "", badRequest("Pick a role to share with: viewer, commenter, editor or co-owner.")
+}
+
+//Reads the role picked in a sharing form
+func formRole(r *http.Request) (Role, error) {
+	return parseRole(r.FormValue("role"))
+}
+
+//Works out a users role on a note: owner if they created it, otherwise the most the note, or any notebook it is in,
+//has been shared with them as. Returns "" if they have no access
+func noteRoleFor(note Note, userID int) (Role, error) {
+	if note.UserID == userID {
+		return roleOwner, nil
+	}
+	var role Role
+	noteAccess, err := store.GetUserAccess(note.NoteID, userID)
+	if err != nil && err != errNotFound {
+		return "", err
+	}
+	if err == nil {
+		role = noteAccess.Role
+	}
+	notebookRole, err := notebookRoleFor(note.NotebookID, userID)
+	if err != nil {
+		return "", err
+	}
+	return maxRole(role, notebookRole), nil
+}
+
+//Loads a note and checks the user may do something with it. This is the one place access to notes is decided.
+//Returns a 404 error if the user can not view the note at all, so notes are not given away to people they have not
+//been shared with, and a 403 error if they can view it but their role does not allow the action
+func authoriseNote(noteID int, userID int, action capability) (Note, Role, error) {
+	note, err := store.GetNote(noteID)
+	if err != nil && err != errNotFound {
+		return note, "", err
+	}
+	var role Role
+	if err == nil {
+		role, err = noteRoleFor(note, userID)
+		if err != nil {
+			return note, "", err
+		}
+	}
+	if !role.can(capView) {
+		return note, role, notFound("That note does not exist or has not been shared with you.")
+	}
+	if !role.can(action) {
+		return note, role, forbidden("Your role on this note does not let you " + capabilityActions[action] + ".")
+	}
+	return note, role, nil
+}
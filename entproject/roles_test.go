@@ -0,0 +1,286 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRoleCapabilities(t *testing.T) {
+	capabilities := []capability{capView, capComment, capEdit, capShare, capDelete, capMove, capTransfer}
+	tests := []struct {
+		role    Role
+		allowed []capability
+	}{
+		{"", nil},
+		{roleViewer, []capability{capView}},
+		{roleCommenter, []capability{capView, capComment}},
+		{roleEditor, []capability{capView, capComment, capEdit}},
+		{roleCoOwner, []capability{capView, capComment, capEdit, capShare, capDelete}},
+		{roleOwner, capabilities},
+	}
+	for _, test := range tests {
+		for _, action := range capabilities {
+			assert.Equal(t, contains(test.allowed, action), test.role.can(action), "%q %s", test.role, action)
+		}
+	}
+	for _, action := range capabilities {
+		assert.NotEmpty(t, capabilityActions[action], action)
+	}
+}
+
+func contains(capabilities []capability, action capability) bool {
+	for _, c := range capabilities {
+		if c == action {
+			return true
+		}
+	}
+	return false
+}
+
+func TestParseRole(t *testing.T) {
+	for _, role := range sharedRoles {
+		parsed, err := parseRole(string(role))
+		assert.NoError(t, err)
+		assert.Equal(t, role, parsed)
+	}
+	for _, value := range []string{"", "owner", "Editor", "admin"} {
+		_, err := parseRole(value)
+		assert.Equal(t, http.StatusBadRequest, errorCode(err), value)
+	}
+
+	assert.Equal(t, roleEditor, maxRole(roleViewer, roleEditor))
+	assert.Equal(t, roleOwner, maxRole(roleOwner, roleCoOwner))
+	assert.Equal(t, roleCommenter, maxRole(roleCommenter, ""))
+	assert.Equal(t, "Co-owner", roleCoOwner.Title())
+	assert.Equal(t, "No access", Role("").Title())
+}
+
+func TestAuthoriseNote(t *testing.T) {
+	owner, err := registerUser("Role", "Owner", "password")
+	assert.NoError(t, err)
+	note, err := saveNewNote(owner.UserID, "title", "contents", "")
+	assert.NoError(t, err)
+
+	users := make(map[Role]int)
+	for _, role := range sharedRoles {
+		user, err := registerUser("Role", string(role), "password")
+		assert.NoError(t, err)
+		_, err = store.AddAccess(NoteAccess{NoteID: note.NoteID, UserID: user.UserID, Role: role})
+		assert.NoError(t, err)
+		users[role] = user.UserID
+	}
+	stranger, err := registerUser("Role", "Stranger", "password")
+	assert.NoError(t, err)
+	users[""] = stranger.UserID
+	users[roleOwner] = owner.UserID
+
+	for role, userID := range users {
+		for _, action := range []capability{capView, capComment, capEdit, capShare, capDelete, capMove, capTransfer} {
+			_, got, err := authoriseNote(note.NoteID, userID, action)
+			switch {
+			case role.can(action):
+				assert.NoError(t, err, "%q %s", role, action)
+				assert.Equal(t, role, got)
+			case role.can(capView):
+				assert.Equal(t, http.StatusForbidden, errorCode(err), "%q %s", role, action)
+			default:
+				assert.Equal(t, http.StatusNotFound, errorCode(err), "%q %s", role, action)
+			}
+		}
+	}
+	_, _, err = authoriseNote(999999999, owner.UserID, capView)
+	assert.Equal(t, http.StatusNotFound, errorCode(err))
+}
+
+func TestCoOwnerPages(t *testing.T) {
+	owner, err := registerUser("CoOwner", "Owner", "password")
+	assert.NoError(t, err)
+	coOwner, err := registerUser("CoOwner", "CoOwner", "password")
+	assert.NoError(t, err)
+	commenter, err := registerUser("CoOwner", "Commenter", "password")
+	assert.NoError(t, err)
+	note, err := saveNewNote(owner.UserID, "title", "contents", "")
+	assert.NoError(t, err)
+	_, err = store.AddAccess(NoteAccess{NoteID: note.NoteID, UserID: coOwner.UserID, Role: roleCoOwner})
+	assert.NoError(t, err)
+	id := strconv.Itoa(note.NoteID)
+
+	//A co-owner can share the note on
+	rec := formRequest("/Notes/Share/"+id, coOwner.UserID, url.Values{"userid": {strconv.Itoa(commenter.UserID)}, "role": {"commenter"}})
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	access, err := store.GetUserAccess(note.NoteID, commenter.UserID)
+	assert.NoError(t, err)
+	assert.Equal(t, roleCommenter, access.Role)
+	rec = apiRequest("GET", "/Notes/ViewAccess/"+id, coOwner.UserID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "Commenter")
+
+	//A commenter can read but not change or share it
+	rec = apiRequest("GET", "/Notes/View/"+id, commenter.UserID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = apiRequest("GET", "/Notes/Update/"+id, commenter.UserID, nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = formRequest("/Notes/Share/"+id, commenter.UserID, url.Values{"userid": {strconv.Itoa(owner.UserID)}, "role": {"viewer"}})
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = formRequest("/Notes/Share/"+id, coOwner.UserID, url.Values{"userid": {strconv.Itoa(commenter.UserID)}, "role": {"owner"}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "notes can not be shared as the owner")
+
+	//A co-owner can delete the note, which goes to the owners trash, but can not move it
+	rec = apiRequest("PUT", "/api/v1/notes/"+id+"/notebook", coOwner.UserID, moveRequest{})
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	rec = apiRequest("DELETE", "/api/v1/notes/"+id, coOwner.UserID, nil)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	trash, err := store.GetTrash(owner.UserID)
+	assert.NoError(t, err)
+	if assert.Len(t, trash, 1) {
+		assert.Equal(t, note.NoteID, trash[0].NoteID)
+	}
+}
+
+func TestAccessRequestRole(t *testing.T) {
+	tests := []struct {
+		body accessRequest
+		role Role
+	}{
+		{accessRequest{Role: "co-owner"}, roleCoOwner},
+		{accessRequest{Role: "commenter", Write: true}, roleCommenter},
+		{accessRequest{Role: "viewer", Read: true, Write: true}, roleViewer},
+		{accessRequest{Write: true}, roleEditor},
+		{accessRequest{Read: true}, roleViewer},
+	}
+	for _, test := range tests {
+		role, err := test.body.role()
+		assert.NoError(t, err)
+		assert.Equal(t, test.role, role)
+	}
+	_, err := accessRequest{}.role()
+	assert.Equal(t, http.StatusBadRequest, errorCode(err))
+	_, err = accessRequest{Role: "owner"}.role()
+	assert.Equal(t, http.StatusBadRequest, errorCode(err))
+	//A role that is given but not valid is refused, not replaced by the old flags
+	_, err = accessRequest{Role: "owner", Write: true}.role()
+	assert.Equal(t, http.StatusBadRequest, errorCode(err))
+}
+
+func TestEditAccessPerUser(t *testing.T) {
+	owner, err := registerUser("Access", "Owner", "password")
+	assert.NoError(t, err)
+	first, err := registerUser("Access", "First", "password")
+	assert.NoError(t, err)
+	second, err := registerUser("Access", "Second", "password")
+	assert.NoError(t, err)
+	note, err := saveNewNote(owner.UserID, "title", "contents", "")
+	assert.NoError(t, err)
+	id := strconv.Itoa(note.NoteID)
+	for _, user := range []User{first, second} {
+		rec := formRequest("/Notes/Share/"+id, owner.UserID, url.Values{"userid": {strconv.Itoa(user.UserID)}, "role": {"viewer"}})
+		assert.Equal(t, http.StatusSeeOther, rec.Code)
+	}
+
+	//Every collaborator is listed with who shared the note with them
+	rec := apiRequest("GET", "/Notes/EditAccess/"+id, owner.UserID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	body := rec.Body.String()
+	assert.Contains(t, body, "Access First")
+	assert.Contains(t, body, "Access Second")
+	assert.Contains(t, body, "Access Owner")
+
+	//Changing one users role leaves the other alone
+	rec = formRequest("/Notes/EditAccess/"+id, owner.UserID, url.Values{"userid": {strconv.Itoa(first.UserID)}, "role": {"editor"}})
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	assert.Equal(t, "/Notes/EditAccess/"+id, rec.Header().Get("Location"))
+	access, err := store.GetUserAccess(note.NoteID, first.UserID)
+	assert.NoError(t, err)
+	assert.Equal(t, roleEditor, access.Role)
+	assert.Equal(t, owner.UserID, access.GrantedBy)
+	assert.False(t, access.DateGranted.IsZero())
+	access, err = store.GetUserAccess(note.NoteID, second.UserID)
+	assert.NoError(t, err)
+	assert.Equal(t, roleViewer, access.Role)
+
+	//Revoking one users access leaves the other alone
+	rec = formRequest("/Notes/RevokeAccess/"+id, owner.UserID, url.Values{"userid": {strconv.Itoa(second.UserID)}})
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	_, err = store.GetUserAccess(note.NoteID, second.UserID)
+	assert.Equal(t, errNotFound, err)
+	_, err = store.GetUserAccess(note.NoteID, first.UserID)
+	assert.NoError(t, err)
+	rec = apiRequest("GET", "/Notes/View/"+id, second.UserID, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	//Users the note is not shared with can not be changed or revoked
+	rec = formRequest("/Notes/RevokeAccess/"+id, owner.UserID, url.Values{"userid": {strconv.Itoa(second.UserID)}})
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = formRequest("/Notes/EditAccess/"+id, owner.UserID, url.Values{"userid": {strconv.Itoa(second.UserID)}, "role": {"editor"}})
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = formRequest("/Notes/EditAccess/"+id, owner.UserID, url.Values{"role": {"editor"}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	//The API revokes access the same way
+	rec = apiRequest("DELETE", "/api/v1/notes/"+id+"/access/"+strconv.Itoa(first.UserID), owner.UserID, nil)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	accessRows, err := store.GetAccess(note.NoteID)
+	assert.NoError(t, err)
+	assert.Empty(t, accessRows)
+}
+
+func TestShareNoteTwice(t *testing.T) {
+	owner, err := registerUser("Share", "Owner", "password")
+	assert.NoError(t, err)
+	coOwner, err := registerUser("Share", "CoOwner", "password")
+	assert.NoError(t, err)
+	friend, err := registerUser("Share", "Friend", "password")
+	assert.NoError(t, err)
+	note, err := saveNewNote(owner.UserID, "title", "contents", "")
+	assert.NoError(t, err)
+	_, err = store.AddAccess(NoteAccess{NoteID: note.NoteID, UserID: coOwner.UserID, Role: roleCoOwner})
+	assert.NoError(t, err)
+	id := strconv.Itoa(note.NoteID)
+
+	//Sharing again changes the role rather than adding a second row
+	for _, role := range []string{"viewer", "editor", "commenter"} {
+		rec := formRequest("/Notes/Share/"+id, owner.UserID, url.Values{"userid": {strconv.Itoa(friend.UserID)}, "role": {role}})
+		assert.Equal(t, http.StatusSeeOther, rec.Code)
+	}
+	accessRows, err := store.GetAccess(note.NoteID)
+	assert.NoError(t, err)
+	assert.Len(t, accessRows, 2)
+	access, err := store.GetUserAccess(note.NoteID, friend.UserID)
+	assert.NoError(t, err)
+	assert.Equal(t, roleCommenter, access.Role)
+
+	//Sharing with yourself, the owner or someone who does not exist is refused with a message saying why
+	tests := []struct {
+		userID   int
+		sharedID int
+		message  string
+	}{
+		{owner.UserID, owner.UserID, "You can not share a note with yourself."},
+		{coOwner.UserID, owner.UserID, "That user owns the note"},
+		{owner.UserID, 999999999, "That user does not exist."},
+	}
+	for _, test := range tests {
+		rec := formRequest("/Notes/Share/"+id, test.userID, url.Values{"userid": {strconv.Itoa(test.sharedID)}, "role": {"viewer"}})
+		assert.Equal(t, http.StatusBadRequest, rec.Code, test.message)
+		assert.Contains(t, rec.Body.String(), test.message)
+	}
+	_, err = store.GetUserAccess(note.NoteID, owner.UserID)
+	assert.Equal(t, errNotFound, err)
+
+	//The API changes an existing share the same way, answering 200 rather than 201
+	path := "/api/v1/notes/" + id + "/access"
+	rec := apiRequest("POST", path, owner.UserID, accessRequest{UserID: friend.UserID, Role: "editor"})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	rec = apiRequest("POST", path, owner.UserID, accessRequest{UserID: owner.UserID, Role: "editor"})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = apiRequest("POST", path, owner.UserID, accessRequest{UserID: 999999999, Role: "editor"})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "That user does not exist.")
+	accessRows, err = store.GetAccess(note.NoteID)
+	assert.NoError(t, err)
+	assert.Len(t, accessRows, 2)
+}
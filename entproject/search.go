@@ -0,0 +1,439 @@
+package main
+
+import (
+	"html"
+	"html/template"
+	"net/url"
+	"strings"
+	"time"
+	"unicode"
+)
+
+//One word or phrase in a search
+type searchTerm struct {
+	Text string
+	//"quoted words" must appear together and in order
+	Phrase bool
+	//word* matches any word starting with word
+	Prefix bool
+	//-word only matches notes that do not contain word
+	Negated bool
+}
+
+//A parsed search. A note matches if it matches the filter and every term in any one of the groups. A search with
+//no groups matches every note the filter allows
+type searchQuery struct {
+	Groups [][]searchTerm
+	Filter searchFilter
+}
+
+//Which notes a search looks at
+const (
+	scopeAll    = ""
+	scopeOwned  = "owned"
+	scopeShared = "shared"
+)
+
+//Narrows a search down by who owns a note, when it changed and what the user can do with it
+type searchFilter struct {
+	//scopeOwned for the users own notes, scopeShared for notes shared with them, or scopeAll for both
+	Scope string
+	//Only notes owned by this user, or 0 for any owner
+	OwnerID int
+	//Only notes the user can change
+	Writable bool
+	//Only notes with every one of these tags
+	Tags []string
+	//Only notes created or updated between these dates, inclusive. Zero dates are not checked
+	CreatedFrom time.Time
+	CreatedTo   time.Time
+	UpdatedFrom time.Time
+	UpdatedTo   time.Time
+}
+
+//Layout of the dates in search filters
+const searchDateLayout = "2006-01-02"
+
+//A note found by a search
+type SearchResult struct {
+	Note
+	//How well the note matches, higher is better
+	Rank float64 `json:"rank"`
+	//Part of the notes contents with the matches wrapped in <mark>. Everything else is HTML escaped, so pages show it
+	//as it is
+	Snippet template.HTML `json:"snippet"`
+}
+
+//Whether the search has nothing to look for
+func (q searchQuery) empty() bool {
+	return len(q.Groups) == 0 && q.Filter.empty()
+}
+
+//Whether the filter lets every note through
+func (f searchFilter) empty() bool {
+	return f.Scope == scopeAll && f.OwnerID == 0 && !f.Writable && len(f.Tags) == 0 &&
+		f.CreatedFrom.IsZero() && f.CreatedTo.IsZero() && f.UpdatedFrom.IsZero() && f.UpdatedTo.IsZero()
+}
+
+//Reads a search filter from the scope, owner, writable, tags, createdFrom, createdTo, updatedFrom and updatedTo form
+//or query values. tags is a comma separated list
+func parseSearchFilter(values url.Values) (searchFilter, error) {
+	var filter searchFilter
+	switch scope := values.Get("scope"); scope {
+	case "", "all":
+	case scopeOwned, scopeShared:
+		filter.Scope = scope
+	default:
+		return filter, badRequest("scope should be all, owned or shared")
+	}
+
+	if owner := values.Get("owner"); owner != "" {
+		id, err := parseID(owner)
+		if err != nil {
+			return filter, badRequest("owner should be a user ID")
+		}
+		filter.OwnerID = id
+	}
+
+	switch values.Get("writable") {
+	case "", "false":
+	case "true", "on":
+		filter.Writable = true
+	default:
+		return filter, badRequest("writable should be true or false")
+	}
+
+	tags, err := parseTags(values.Get("tags"))
+	if err != nil {
+		return filter, err
+	}
+	if len(tags) > 0 {
+		filter.Tags = tags
+	}
+
+	dates := []struct {
+		name string
+		date *time.Time
+	}{
+		{"createdFrom", &filter.CreatedFrom},
+		{"createdTo", &filter.CreatedTo},
+		{"updatedFrom", &filter.UpdatedFrom},
+		{"updatedTo", &filter.UpdatedTo},
+	}
+	for _, d := range dates {
+		value := values.Get(d.name)
+		if value == "" {
+			continue
+		}
+		//Days start and end at midnight where the server is, not in UTC
+		date, err := time.ParseInLocation(searchDateLayout, value, time.Local)
+		if err != nil {
+			return filter, badRequest(d.name + " should be a date like " + searchDateLayout)
+		}
+		*d.date = date
+	}
+	if !filter.CreatedTo.IsZero() && filter.CreatedFrom.After(filter.CreatedTo) {
+		return filter, badRequest("createdFrom should not be after createdTo")
+	}
+	if !filter.UpdatedTo.IsZero() && filter.UpdatedFrom.After(filter.UpdatedTo) {
+		return filter, badRequest("updatedFrom should not be after updatedTo")
+	}
+	return filter, nil
+}
+
+//Checks whether a note gets through the filter in memory. canWrite is whether the user searching can change it
+func (f searchFilter) matches(note Note, userID int, canWrite bool) bool {
+	switch {
+	case f.Scope == scopeOwned && note.UserID != userID:
+		return false
+	case f.Scope == scopeShared && note.UserID == userID:
+		return false
+	case f.OwnerID != 0 && note.UserID != f.OwnerID:
+		return false
+	case f.Writable && !canWrite:
+		return false
+	case !hasTags(note, f.Tags):
+		return false
+	}
+	return inDateRange(note.DateCreated, f.CreatedFrom, f.CreatedTo) && inDateRange(note.DateUpdated, f.UpdatedFrom, f.UpdatedTo)
+}
+
+//Whether t is on or after the day from and before the end of the day to. Zero dates are not checked
+func inDateRange(t time.Time, from time.Time, to time.Time) bool {
+	if !from.IsZero() && t.Before(from) {
+		return false
+	}
+	return to.IsZero() || t.Before(dayAfter(to))
+}
+
+//The start of the day after date, so a range can end before it and still take in all of date. A zero date stays zero
+func dayAfter(date time.Time) time.Time {
+	if date.IsZero() {
+		return date
+	}
+	return date.AddDate(0, 0, 1)
+}
+
+//Parses what a user typed into the search box. Words must all match, "quoted phrases" must match in order, word*
+//matches the start of a word, -word excludes notes containing it, and OR between words matches either side
+func parseSearchQuery(input string) searchQuery {
+	var query searchQuery
+	var group []searchTerm
+	endGroup := func() {
+		if len(group) > 0 {
+			query.Groups = append(query.Groups, group)
+		}
+		group = nil
+	}
+
+	runes := []rune(input)
+	for i := 0; i < len(runes); {
+		if unicode.IsSpace(runes[i]) {
+			i++
+			continue
+		}
+		var term searchTerm
+		if runes[i] == '-' && i+1 < len(runes) && !unicode.IsSpace(runes[i+1]) {
+			term.Negated = true
+			i++
+		}
+
+		start := i
+		if runes[i] == '"' {
+			//A phrase runs to the closing quote, or the end of the input if there is none
+			i++
+			start = i
+			for i < len(runes) && runes[i] != '"' {
+				i++
+			}
+			term.Text = string(runes[start:i])
+			term.Phrase = true
+			i++
+		} else {
+			for i < len(runes) && !unicode.IsSpace(runes[i]) {
+				i++
+			}
+			term.Text = string(runes[start:i])
+			if term.Text == "OR" && !term.Negated {
+				endGroup()
+				continue
+			}
+			if strings.HasSuffix(term.Text, "*") {
+				term.Prefix = true
+				//Prefixes are matched against single words, so only letters and digits are kept
+				term.Text = strings.Map(func(r rune) rune {
+					if isWordRune(r) {
+						return r
+					}
+					return -1
+				}, term.Text)
+			}
+		}
+
+		//Terms with no letters or digits can never match a word
+		if len(searchWords(term.Text)) == 0 {
+			continue
+		}
+		if term.Phrase && len(searchWords(term.Text)) == 1 {
+			term.Phrase = false
+		}
+		group = append(group, term)
+	}
+	endGroup()
+	return query
+}
+
+//Whether a rune can be part of a searchable word
+func isWordRune(r rune) bool {
+	return unicode.IsLetter(r) || unicode.IsDigit(r)
+}
+
+//Splits text into lower case words
+func searchWords(text string) []string {
+	return strings.FieldsFunc(strings.ToLower(text), func(r rune) bool {
+		return !isWordRune(r)
+	})
+}
+
+//Where a word starts and ends in some text, in bytes
+type wordSpan struct {
+	start int
+	end   int
+}
+
+//Finds where each word in text starts and ends
+func wordSpans(text string) []wordSpan {
+	var spans []wordSpan
+	start := -1
+	for i, r := range text {
+		if isWordRune(r) && start < 0 {
+			start = i
+		}
+		if !isWordRune(r) && start >= 0 {
+			spans = append(spans, wordSpan{start, i})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		spans = append(spans, wordSpan{start, len(text)})
+	}
+	return spans
+}
+
+//Counts how many times a term appears in a list of words. Used by the in-memory store, which matches whole words
+//where Postgres also matches other forms of the same word
+func (t searchTerm) count(words []string) int {
+	termWords := searchWords(t.Text)
+	count := 0
+	switch {
+	case t.Prefix:
+		for _, word := range words {
+			if strings.HasPrefix(word, termWords[0]) {
+				count++
+			}
+		}
+	case t.Phrase:
+		for i := 0; i+len(termWords) <= len(words); i++ {
+			if equalWords(words[i:i+len(termWords)], termWords) {
+				count++
+			}
+		}
+	default:
+		//Like Postgres, a term that splits into several words needs all of them
+		for i, termWord := range termWords {
+			n := 0
+			for _, word := range words {
+				if word == termWord {
+					n++
+				}
+			}
+			if n == 0 {
+				return 0
+			}
+			if i == 0 || n < count {
+				count = n
+			}
+		}
+	}
+	return count
+}
+
+//Whether two lists of words are the same
+func equalWords(a []string, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+//Checks whether a notes words match the search in memory, and ranks it. Title matches count for more than contents
+//matches, like the weights on the Postgres search column. Every note matches a search with no words
+func (q searchQuery) rank(note Note) (float64, bool) {
+	if len(q.Groups) == 0 {
+		return 0, true
+	}
+	titleWords := searchWords(note.Title)
+	contentWords := searchWords(note.Contents)
+	best, matched := 0.0, false
+
+	for _, group := range q.Groups {
+		rank, ok := 0.0, true
+		for _, term := range group {
+			inTitle, inContents := term.count(titleWords), term.count(contentWords)
+			if term.Negated {
+				ok = ok && inTitle+inContents == 0
+				continue
+			}
+			ok = ok && inTitle+inContents > 0
+			rank += float64(inTitle) + 0.4*float64(inContents)
+		}
+		if ok && (!matched || rank > best) {
+			best, matched = rank, true
+		}
+	}
+	return best, matched
+}
+
+//Words of context shown around the first match in a snippet
+const snippetWords = 25
+
+//Builds a snippet of text around the first word that matches the search, HTML escaped with the matching words
+//wrapped in <mark>
+func (q searchQuery) snippet(text string) string {
+	spans := wordSpans(text)
+
+	//Marks words matching a term that is being looked for, not one being excluded
+	marked := make([]bool, len(spans))
+	first := -1
+	for i, s := range spans {
+		word := strings.ToLower(text[s.start:s.end])
+		for _, group := range q.Groups {
+			for _, term := range group {
+				if term.Negated {
+					continue
+				}
+				for _, termWord := range searchWords(term.Text) {
+					if word == termWord || (term.Prefix && strings.HasPrefix(word, termWord)) {
+						marked[i] = true
+					}
+				}
+			}
+		}
+		if marked[i] && first < 0 {
+			first = i
+		}
+	}
+
+	if len(spans) == 0 {
+		return html.EscapeString(text)
+	}
+	//Shows a window of words starting a little before the first match
+	from := 0
+	if first > 5 {
+		from = first - 5
+	}
+	to := from + snippetWords
+	if to > len(spans) {
+		to = len(spans)
+	}
+
+	var b strings.Builder
+	pos := 0
+	if from > 0 {
+		pos = spans[from].start
+		b.WriteString("… ")
+	}
+	for i := from; i < to; i++ {
+		b.WriteString(html.EscapeString(text[pos:spans[i].start]))
+		word := html.EscapeString(text[spans[i].start:spans[i].end])
+		if marked[i] {
+			word = "<mark>" + word + "</mark>"
+		}
+		b.WriteString(word)
+		pos = spans[i].end
+	}
+	if to < len(spans) {
+		b.WriteString(" …")
+	} else {
+		b.WriteString(html.EscapeString(text[pos:]))
+	}
+	return b.String()
+}
+
+//Markers Postgres puts around matches in a headline. They are swapped for <mark> once the rest has been escaped
+const (
+	headlineStart = "\ue000"
+	headlineStop  = "\ue001"
+)
+
+//Escapes a Postgres headline and turns its match markers into <mark> tags
+func headlineHTML(headline string) string {
+	escaped := html.EscapeString(headline)
+	escaped = strings.ReplaceAll(escaped, headlineStart, "<mark>")
+	return strings.ReplaceAll(escaped, headlineStop, "</mark>")
+}
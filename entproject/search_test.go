@@ -0,0 +1,171 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseSearchQuery(t *testing.T) {
+	assert.Equal(t, searchQuery{Groups: [][]searchTerm{{{Text: "quick"}, {Text: "fox"}}}}, parseSearchQuery("  quick fox "))
+	assert.Equal(t, searchQuery{Groups: [][]searchTerm{{{Text: "quick brown", Phrase: true}, {Text: "fox", Negated: true}}}}, parseSearchQuery(`"quick brown" -fox`))
+	assert.Equal(t, searchQuery{Groups: [][]searchTerm{{{Text: "note", Prefix: true}}, {{Text: "my draft", Negated: true, Phrase: true}}}}, parseSearchQuery(`note* OR -"my draft"`))
+	assert.Equal(t, searchQuery{Groups: [][]searchTerm{{{Text: "a"}}, {{Text: "b"}}}}, parseSearchQuery("a OR OR b OR"))
+
+	//An unclosed quote runs to the end of the input
+	assert.Equal(t, searchQuery{Groups: [][]searchTerm{{{Text: "open phrase", Phrase: true}}}}, parseSearchQuery(`"open phrase`))
+	//A quoted single word is just a word
+	assert.Equal(t, searchQuery{Groups: [][]searchTerm{{{Text: "word"}}}}, parseSearchQuery(`"word"`))
+	//Prefixes only keep letters and digits, so they are always safe to hand to to_tsquery
+	assert.Equal(t, searchQuery{Groups: [][]searchTerm{{{Text: "ab", Prefix: true}}}}, parseSearchQuery("a'|b*"))
+	//Lowercase or is a word, not an operator
+	assert.Equal(t, searchQuery{Groups: [][]searchTerm{{{Text: "this"}, {Text: "or"}, {Text: "that"}}}}, parseSearchQuery("this or that"))
+
+	for _, input := range []string{"", "   ", "%", "*", "-", `""`, "OR", "' -- ;"} {
+		assert.True(t, parseSearchQuery(input).empty(), "parseSearchQuery(%q) should have nothing to look for", input)
+	}
+}
+
+func TestSearchRank(t *testing.T) {
+	note := Note{Title: "Shopping list", Contents: "Milk, eggs and more eggs"}
+	_, ok := parseSearchQuery("milk bread").rank(note)
+	assert.False(t, ok, "every word should be needed")
+	_, ok = parseSearchQuery("milk -eggs").rank(note)
+	assert.False(t, ok)
+	_, ok = parseSearchQuery(`"eggs and milk"`).rank(note)
+	assert.False(t, ok, "phrase words should be in order")
+	_, ok = parseSearchQuery("bread OR shop*").rank(note)
+	assert.True(t, ok)
+
+	title, _ := parseSearchQuery("shopping").rank(note)
+	contents, _ := parseSearchQuery("milk").rank(note)
+	twice, _ := parseSearchQuery("eggs").rank(note)
+	assert.Greater(t, title, contents, "title matches should rank higher")
+	assert.Greater(t, twice, contents, "more matches should rank higher")
+}
+
+func TestSearchSnippet(t *testing.T) {
+	query := parseSearchQuery("fox* -dog")
+	assert.Equal(t, "the <mark>foxes</mark> &amp; the dog", query.snippet("the foxes & the dog"))
+	assert.Equal(t, "&lt;b&gt;no match&lt;/b&gt;", query.snippet("<b>no match</b>"))
+	assert.Equal(t, "", query.snippet(""))
+
+	//Long notes are cut down to a window around the first match
+	long := "one two three four five six seven eight nine ten fox eleven twelve thirteen fourteen fifteen sixteen " +
+		"seventeen eighteen nineteen twenty twentyone twentytwo twentythree twentyfour twentyfive twentysix twentyseven twentyeight twentynine thirty"
+	snippet := query.snippet(long)
+	assert.Equal(t, "… six seven eight nine ten <mark>fox</mark>", snippet[:len("… six seven eight nine ten <mark>fox</mark>")])
+	assert.Contains(t, snippet, "twentynine …")
+	assert.NotContains(t, snippet, "thirty")
+}
+
+func TestHeadlineHTML(t *testing.T) {
+	headline := "<i>a</i> " + headlineStart + "match" + headlineStop + " & more"
+	assert.Equal(t, "&lt;i&gt;a&lt;/i&gt; <mark>match</mark> &amp; more", headlineHTML(headline))
+}
+
+func TestParseSearchFilter(t *testing.T) {
+	filter, err := parseSearchFilter(url.Values{
+		"scope":       {"shared"},
+		"owner":       {"7"},
+		"writable":    {"on"},
+		"createdFrom": {"2024-01-02"},
+		"updatedTo":   {"2024-03-04"},
+	})
+	assert.NoError(t, err)
+	assert.Equal(t, searchFilter{
+		Scope:       scopeShared,
+		OwnerID:     7,
+		Writable:    true,
+		CreatedFrom: time.Date(2024, 1, 2, 0, 0, 0, 0, time.Local),
+		UpdatedTo:   time.Date(2024, 3, 4, 0, 0, 0, 0, time.Local),
+	}, filter)
+
+	filter, err = parseSearchFilter(url.Values{"scope": {"all"}, "writable": {"false"}})
+	assert.NoError(t, err)
+	assert.True(t, filter.empty())
+
+	for _, values := range []url.Values{
+		{"scope": {"mine"}},
+		{"owner": {"abc"}},
+		{"owner": {"0"}},
+		{"writable": {"yes please"}},
+		{"createdFrom": {"02/01/2024"}},
+		{"updatedTo": {"2024-13-01"}},
+		{"createdFrom": {"2024-02-01"}, "createdTo": {"2024-01-01"}},
+	} {
+		_, err := parseSearchFilter(values)
+		assert.Error(t, err, "parseSearchFilter(%v) should fail", values)
+	}
+}
+
+func TestInDateRange(t *testing.T) {
+	day := time.Date(2024, 5, 6, 23, 30, 0, 0, time.UTC)
+	from := time.Date(2024, 5, 6, 0, 0, 0, 0, time.UTC)
+	assert.True(t, inDateRange(day, from, from), "the from and to days should be included")
+	assert.True(t, inDateRange(day, time.Time{}, time.Time{}))
+	assert.False(t, inDateRange(day, from.AddDate(0, 0, 1), time.Time{}))
+	assert.False(t, inDateRange(day, time.Time{}, from.AddDate(0, 0, -1)))
+	//Times are kept, so the range runs from midnight on the from day up to midnight after the to day
+	assert.True(t, inDateRange(from, from, from))
+	assert.False(t, inDateRange(from.Add(-time.Second), from, time.Time{}))
+	assert.False(t, inDateRange(from.AddDate(0, 0, 1), time.Time{}, from))
+}
+
+func TestSearchDaysAreLocal(t *testing.T) {
+	//A server ahead of UTC, where the local day starts the afternoon before in UTC
+	local := time.Local
+	time.Local = time.FixedZone("UTC+10", 10*60*60)
+	defer func() { time.Local = local }()
+
+	filter, err := parseSearchFilter(url.Values{"createdFrom": {"2024-05-06"}, "createdTo": {"2024-05-06"}})
+	assert.NoError(t, err)
+	lateOnTheDay := time.Date(2024, 5, 6, 13, 30, 0, 0, time.UTC)
+	justAfter := time.Date(2024, 5, 6, 14, 30, 0, 0, time.UTC)
+	assert.True(t, inDateRange(lateOnTheDay, filter.CreatedFrom, filter.CreatedTo), "23:30 local time is still the 6th")
+	assert.False(t, inDateRange(justAfter, filter.CreatedFrom, filter.CreatedTo), "00:30 local time is the 7th")
+	assert.Equal(t, "2024-05-06", weekStart(justAfter).Format(searchDateLayout), "a note made just after midnight on Tuesday is in the week of Monday the 6th")
+	assert.Equal(t, "2024-04-29", weekStart(time.Date(2024, 5, 5, 13, 30, 0, 0, time.UTC)).Format(searchDateLayout), "23:30 on Sunday is in the week before")
+}
+
+func TestSearchFiltersAreBookmarkable(t *testing.T) {
+	owner, err := registerUser("Filter", "Owner", "password")
+	assert.NoError(t, err)
+	searcher, err := registerUser("Filter", "Searcher", "password")
+	assert.NoError(t, err)
+	note, err := saveNewNote(owner.UserID, "shared quokka", "quokka facts", "")
+	assert.NoError(t, err)
+	_, err = store.AddAccess(NoteAccess{NoteID: note.NoteID, UserID: searcher.UserID, Role: roleViewer})
+	assert.NoError(t, err)
+	_, err = saveNewNote(searcher.UserID, "own quokka", "more quokka facts", "")
+	assert.NoError(t, err)
+
+	//The search page reads the search from the query string and fills the form back in
+	rec := apiRequest("GET", "/Notes/Search/?search=quokka&scope=shared", searcher.UserID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "shared quokka")
+	assert.NotContains(t, rec.Body.String(), "own quokka")
+	assert.Contains(t, rec.Body.String(), `value="shared" selected`)
+	rec = apiRequest("GET", "/Notes/Search/?scope=owned&writable=true", searcher.UserID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "own quokka")
+	assert.NotContains(t, rec.Body.String(), "shared quokka")
+	rec = apiRequest("GET", "/Notes/Search/?createdFrom=yesterday", searcher.UserID, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	//The API takes the same filters, with or without q
+	rec = apiRequest("GET", "/api/v1/notes/search?owner="+strconv.Itoa(owner.UserID), searcher.UserID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var found []SearchResult
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &found))
+	if assert.Len(t, found, 1) {
+		assert.Equal(t, note.NoteID, found[0].NoteID)
+	}
+	rec = apiRequest("GET", "/api/v1/notes/search", searcher.UserID, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
@@ -0,0 +1,131 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"net/http"
+	"time"
+)
+
+//A logged in users session. Only a hash of the session token is stored, the token itself only lives in the users cookie
+type Session struct {
+	SessionID   string
+	UserID      int
+	DateCreated time.Time
+	LastSeen    time.Time
+}
+
+//Name of the cookie holding the session token
+const sessionCookieName = "session"
+
+//How long a session can go unused before it expires
+var sessionIdleTimeout = 30 * time.Minute
+
+//How long a session can last in total, however active it is
+var sessionMaxAge = 24 * time.Hour
+
+//How stale LastSeen can get before it is written back, so every request does not cost an UPDATE
+const sessionTouchInterval = time.Minute
+
+//Generates a new random session token
+func newSessionToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+//Signs a session token with the configured session secret to get the SessionID stored in the database,
+//so a leaked Session table can not be used to forge or look up cookies without the secret
+func hashSessionToken(token string) string {
+	mac := hmac.New(sha256.New, []byte(config.SessionSecret))
+	mac.Write([]byte(token))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+//Checks whether a session has passed its idle or absolute expiry
+func sessionExpired(session Session, now time.Time) bool {
+	return now.Sub(session.LastSeen) > sessionIdleTimeout || now.Sub(session.DateCreated) > sessionMaxAge
+}
+
+//Checks whether a user is logged in and returns their session. Returns a nil session if there is no valid session
+func checkLoggedIn(r *http.Request) (*Session, error) {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil || cookie.Value == "" {
+		return nil, nil
+	}
+
+	session, err := store.GetSession(hashSessionToken(cookie.Value))
+	if err == errNotFound {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	now := time.Now()
+	if sessionExpired(session, now) {
+		logDebug("session for user %d expired", session.UserID)
+		return nil, store.DeleteSession(session.SessionID)
+	}
+	if now.Sub(session.LastSeen) > sessionTouchInterval {
+		err = store.TouchSession(session.SessionID, now)
+		if err != nil {
+			return nil, err
+		}
+		session.LastSeen = now
+	}
+	return &session, nil
+}
+
+//Sets the session cookie holding the given token
+func setSessionCookie(w http.ResponseWriter, token string) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    token,
+		Path:     "/",
+		MaxAge:   int(sessionMaxAge.Seconds()),
+		HttpOnly: true,
+		Secure:   config.secureCookies(),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+//Removes the session cookie from the browser
+func clearSessionCookie(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		Expires:  time.Now().Add(-100 * time.Hour), // Set expires for older versions of IE
+		HttpOnly: true,
+		Secure:   config.secureCookies(),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+//Starts a new session for a user and returns its token
+func startSession(userID int) (string, error) {
+	//Clears out sessions that have expired so the store does not grow forever
+	now := time.Now()
+	err := store.DeleteExpiredSessions(now.Add(-sessionIdleTimeout), now.Add(-sessionMaxAge))
+	if err != nil {
+		return "", err
+	}
+
+	token, err := newSessionToken()
+	if err != nil {
+		return "", err
+	}
+	err = store.CreateSession(Session{SessionID: hashSessionToken(token), UserID: userID, DateCreated: now, LastSeen: now})
+	if err != nil {
+		return "", err
+	}
+	return token, nil
+}
@@ -0,0 +1,147 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+//Builds a request carrying the given session cookie
+func sessionRequest(path string, token string) *http.Request {
+	req := httptest.NewRequest("GET", path, nil)
+	if token != "" {
+		req.AddCookie(&http.Cookie{Name: sessionCookieName, Value: token})
+	}
+	return req
+}
+
+//Builds a POST request carrying the given session cookie
+func sessionPost(path string, token string) *http.Request {
+	req := sessionRequest(path, token)
+	req.Method = "POST"
+	return req
+}
+
+//Gets the session for a request, failing the test if the lookup errors
+func loggedInSession(t *testing.T, req *http.Request) *Session {
+	session, err := checkLoggedIn(req)
+	assert.NoError(t, err)
+	return session
+}
+
+//Creates a session for a user, failing the test if it can not be created
+func newTestSession(t *testing.T, userID int) string {
+	token, err := startSession(userID)
+	assert.NoError(t, err)
+	return token
+}
+
+func TestSessionExpired(t *testing.T) {
+	now := time.Now()
+
+	assert.False(t, sessionExpired(Session{DateCreated: now, LastSeen: now}, now), "a fresh session should not be expired")
+	assert.True(t, sessionExpired(Session{DateCreated: now, LastSeen: now.Add(-sessionIdleTimeout - time.Second)}, now), "an idle session should be expired")
+	assert.True(t, sessionExpired(Session{DateCreated: now.Add(-sessionMaxAge - time.Second), LastSeen: now}, now), "an old but active session should be expired")
+}
+
+func TestForgedCookieIsRejected(t *testing.T) {
+	//The old cookie held the raw UserID, which must no longer log anyone in
+	req := httptest.NewRequest("GET", "/Users/Notes/1", nil)
+	req.AddCookie(&http.Cookie{Name: "logged-in", Value: "1"})
+	assert.Nil(t, loggedInSession(t, req))
+
+	assert.Nil(t, loggedInSession(t, sessionRequest("/", "1")))
+	token, err := newSessionToken()
+	assert.NoError(t, err)
+	assert.Nil(t, loggedInSession(t, sessionRequest("/", token)))
+}
+
+func TestSessionLogInAndOut(t *testing.T) {
+	token := newTestSession(t, 1)
+
+	session := loggedInSession(t, sessionRequest("/", token))
+	if assert.NotNil(t, session) {
+		assert.Equal(t, 1, session.UserID)
+		assert.NotEqual(t, token, session.SessionID, "only the hash of the token should be stored")
+	}
+
+	//Following a link can not log anyone out
+	rec := httptest.NewRecorder()
+	newRouter().ServeHTTP(rec, sessionRequest("/Users/Logout", token))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.NotNil(t, loggedInSession(t, sessionRequest("/", token)))
+
+	rec = httptest.NewRecorder()
+	newRouter().ServeHTTP(rec, sessionPost("/Users/Logout", token))
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	assert.Nil(t, loggedInSession(t, sessionRequest("/", token)), "session should be invalid after logging out")
+}
+
+func TestLogOutAllSessions(t *testing.T) {
+	first := newTestSession(t, 1)
+	second := newTestSession(t, 1)
+	other := newTestSession(t, 2)
+
+	rec := httptest.NewRecorder()
+	newRouter().ServeHTTP(rec, sessionRequest("/Users/LogoutAll", first))
+	assert.Equal(t, http.StatusMethodNotAllowed, rec.Code)
+	assert.NotNil(t, loggedInSession(t, sessionRequest("/", second)))
+
+	rec = httptest.NewRecorder()
+	newRouter().ServeHTTP(rec, sessionPost("/Users/LogoutAll", first))
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	assert.Nil(t, loggedInSession(t, sessionRequest("/", first)))
+	assert.Nil(t, loggedInSession(t, sessionRequest("/", second)))
+	assert.NotNil(t, loggedInSession(t, sessionRequest("/", other)), "other users sessions should be untouched")
+}
+
+func TestIdleSessionExpires(t *testing.T) {
+	token := newTestSession(t, 1)
+	assert.NoError(t, store.TouchSession(hashSessionToken(token), time.Now().Add(-sessionIdleTimeout-time.Minute)))
+
+	assert.Nil(t, loggedInSession(t, sessionRequest("/", token)))
+	_, err := store.GetSession(hashSessionToken(token))
+	assert.Equal(t, errNotFound, err, "expired session should be deleted")
+}
+
+func TestSessionCookieAttributes(t *testing.T) {
+	rec := httptest.NewRecorder()
+	setSessionCookie(rec, "token")
+
+	header := rec.Header().Get("Set-Cookie")
+	assert.True(t, strings.Contains(header, "HttpOnly"))
+	assert.True(t, strings.Contains(header, "SameSite=Lax"))
+}
+
+func TestSessionCookieSecure(t *testing.T) {
+	saved := config
+	defer func() { config = saved }()
+
+	//Behind a proxy that ends HTTPS the requests arrive as plain HTTP, so the setting decides
+	tests := []struct {
+		secureCookies string
+		tls           bool
+		secure        bool
+	}{
+		{"auto", false, false},
+		{"auto", true, true},
+		{"true", false, true},
+		{"false", true, false},
+	}
+	for _, test := range tests {
+		config.SecureCookies = test.secureCookies
+		config.TLSCert, config.TLSKey = "", ""
+		if test.tls {
+			config.TLSCert, config.TLSKey = "cert.pem", "key.pem"
+		}
+		for _, set := range []func(http.ResponseWriter){func(w http.ResponseWriter) { setSessionCookie(w, "token") }, clearSessionCookie} {
+			rec := httptest.NewRecorder()
+			set(rec)
+			assert.Equal(t, test.secure, strings.Contains(rec.Header().Get("Set-Cookie"), "Secure"), "%+v", test)
+		}
+	}
+}
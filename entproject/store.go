@@ -0,0 +1,186 @@
+package main
+
+import (
+	"fmt"
+	"time"
+)
+
+//Reads and writes users
+type UserStore interface {
+	//Gets every user, without their passwords
+	GetUsers() ([]User, error)
+	//Gets a single user, without their password. Returns errNotFound if the user does not exist
+	GetUser(userID int) (User, error)
+	//Saves a new user and returns it with its UserID set. The password must already be hashed
+	CreateUser(user User) (User, error)
+	//Gets the stored password hash for a user. Returns errNotFound if the user does not exist
+	GetPassword(userID int) (string, error)
+	//Replaces the stored password hash for a user
+	UpdatePassword(userID int, hash string) error
+}
+
+//Reads and writes notes
+type NoteStore interface {
+	//Gets the notes a user owns or has been given any role on, directly or through a notebook
+	GetUserNotes(userID int) ([]Note, error)
+	//Gets a single note. Returns errNotFound if the note does not exist
+	GetNote(noteID int) (Note, error)
+	//Saves a new note, and its first revision, and returns it with its NoteID set and a Version of 1
+	CreateNote(note Note) (Note, error)
+	//Saves a notes title, contents and DateUpdated, adds one to its Version and records the change as a revision by
+	//authorID. Returns errConflict if note.Version is not the saved version, because someone else saved it first
+	UpdateNote(note Note, authorID int) error
+	//Deletes a note for good, whether or not it is in the trash, along with its access rows, revisions, tags and
+	//attachment rows. The attachments files are left in the BlobStore for the caller to delete
+	DeleteNote(noteID int) error
+	//Gives a note to a new owner and takes it out of its notebook, which belongs to the old owner. Any access row the
+	//new owner had on it is removed. The old owner is given previousOwner on it, granted by themselves at date, unless
+	//it is empty. Returns errNotFound if the note does not exist or is in the trash
+	TransferNote(noteID int, ownerID int, previousOwner Role, date time.Time) error
+	//Gets the notes a user can read that match a search, best match first. An empty search finds nothing
+	SearchNotes(userID int, query searchQuery) ([]SearchResult, error)
+}
+
+//Moves notes in and out of their owners trash. Notes in the trash are left out of every other method that finds or
+//changes notes, apart from DeleteNote, until they are restored
+type TrashStore interface {
+	//Moves a note to the trash, keeping its access rows for when it is restored. Returns errNotFound if the note does
+	//not exist or is already in the trash
+	TrashNote(noteID int, dateDeleted time.Time) error
+	//Gets the notes in a users trash, most recently deleted first
+	GetTrash(userID int) ([]TrashedNote, error)
+	//Gets a note in the trash. Returns errNotFound if the note is not in the trash
+	GetTrashedNote(noteID int) (TrashedNote, error)
+	//Takes a note out of the trash. Returns errNotFound if the note is not in the trash
+	RestoreNote(noteID int) error
+	//Gets the IDs of the notes that went in the trash before deletedBefore
+	GetExpiredTrash(deletedBefore time.Time) ([]int, error)
+}
+
+//Reads and changes the tags on notes
+type TagStore interface {
+	//Replaces the tags on a note. The tags must already be normalised
+	SetNoteTags(noteID int, tags []string) error
+	//Counts how many of the notes a user can read have each tag, in tag order
+	GetTagCounts(userID int) ([]tagCount, error)
+}
+
+//Reads and changes the details of files attached to notes. The files themselves are in the BlobStore
+type AttachmentStore interface {
+	//Gets the attachments on a note, oldest first
+	GetAttachments(noteID int) ([]Attachment, error)
+	//Gets a single attachment. Returns errNotFound if the attachment does not exist
+	GetAttachment(attachmentID int) (Attachment, error)
+	//Saves a new attachment and returns it with its AttachmentID set
+	AddAttachment(attachment Attachment) (Attachment, error)
+	//Deletes an attachment
+	DeleteAttachment(attachmentID int) error
+}
+
+//Reads and changes notebooks and who they are shared with
+type NotebookStore interface {
+	//Gets every notebook a user owns, at any level
+	GetUserNotebooks(userID int) ([]Notebook, error)
+	//Gets the notebooks that have been shared with a user
+	GetSharedNotebooks(userID int) ([]Notebook, error)
+	//Gets a single notebook. Returns errNotFound if the notebook does not exist
+	GetNotebook(notebookID int) (Notebook, error)
+	//Gets the notebooks directly inside a notebook
+	GetChildNotebooks(notebookID int) ([]Notebook, error)
+	//Gets the notes directly inside a notebook
+	GetNotebookNotes(notebookID int) ([]Note, error)
+	//Saves a new notebook and returns it with its NotebookID set
+	CreateNotebook(notebook Notebook) (Notebook, error)
+	//Deletes a notebook along with its access rows. The notebook must not hold any notes or notebooks, other than notes
+	//in the trash, which are taken out of it
+	DeleteNotebook(notebookID int) error
+	//Puts a note in a notebook, or takes it out of its notebook when notebookID is 0
+	MoveNote(noteID int, notebookID int) error
+	//Gets every access row on a notebook
+	GetNotebookAccess(notebookID int) ([]NotebookAccess, error)
+	//Gets the access row a user has on a notebook. Returns errNotFound if it has not been shared with them
+	GetUserNotebookAccess(notebookID int, userID int) (NotebookAccess, error)
+	//Shares a notebook with a user, or changes their role if it has already been shared with them
+	SetNotebookAccess(access NotebookAccess) error
+	//Stops sharing a notebook with a user. Returns errNotFound if it was not shared with them
+	RemoveNotebookAccess(notebookID int, userID int) error
+}
+
+//Reads the revisions CreateNote and UpdateNote record each time a note changes
+type RevisionStore interface {
+	//Gets every revision of a note, newest first
+	GetRevisions(noteID int) ([]NoteRevision, error)
+	//Gets one revision of a note. Returns errNotFound if the note has no such revision
+	GetRevision(noteID int, revisionID int) (NoteRevision, error)
+}
+
+//Reads and writes who notes are shared with, and the shared settings used to share new notes
+type AccessStore interface {
+	//Gets every access row on a note
+	GetAccess(noteID int) ([]NoteAccess, error)
+	//Counts the access rows on each of the given notes. Notes that have not been shared are left out
+	CountAccess(noteIDs []int) (map[int]int, error)
+	//Gets the access row a user has on a note. Returns errNotFound if the note has not been shared with them
+	GetUserAccess(noteID int, userID int) (NoteAccess, error)
+	//Shares a note with a user, or changes their role, and who granted it and when, if it has already been shared with
+	//them. Returns the access row, which there is only ever one of for each user on a note
+	AddAccess(access NoteAccess) (NoteAccess, error)
+	//Changes the role one user has on a note, and who granted it and when. Returns errNotFound if the note has not
+	//been shared with them
+	SetUserAccess(access NoteAccess) error
+	//Stops sharing a note with a user. Returns errNotFound if it was not shared with them
+	RemoveAccess(noteID int, userID int) error
+	//Gets every shared setting row belonging to an owner
+	GetSharedSettings(ownerID int) ([]SharedSettings, error)
+	//Saves one shared setting row
+	AddSharedSetting(setting SharedSettings) error
+}
+
+//Reads and writes log in sessions
+type SessionStore interface {
+	//Saves a new session
+	CreateSession(session Session) error
+	//Gets a session by its ID. Returns errNotFound if the session does not exist
+	GetSession(sessionID string) (Session, error)
+	//Records that a session has just been used
+	TouchSession(sessionID string, lastSeen time.Time) error
+	//Deletes a single session
+	DeleteSession(sessionID string) error
+	//Deletes every session belonging to a user
+	DeleteUserSessions(userID int) error
+	//Deletes every session last seen before idleBefore or created before createdBefore
+	DeleteExpiredSessions(idleBefore time.Time, createdBefore time.Time) error
+}
+
+//Everything the app keeps. Postgres is used normally, and an in-memory store for demos and tests
+type Store interface {
+	UserStore
+	NoteStore
+	TrashStore
+	TagStore
+	NotebookStore
+	AttachmentStore
+	RevisionStore
+	AccessStore
+	SessionStore
+	Close() error
+}
+
+//The running servers store
+var store Store
+
+//Opens the store named in the config
+func openStore(cfg Config) (Store, error) {
+	switch cfg.Store {
+	case "postgres":
+		return newPGStore(cfg.DSN)
+	case "memory":
+		s := newMemStore()
+		err := seedDemoData(s)
+		if err != nil {
+			return nil, err
+		}
+		return s, nil
+	}
+	return nil, fmt.Errorf("unknown store %q", cfg.Store)
+}
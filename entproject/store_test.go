@@ -0,0 +1,625 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestMemStore(t *testing.T) {
+	testStore(t, newMemStore())
+}
+
+func TestPostgresStore(t *testing.T) {
+	dsn := os.Getenv("NOTEAPP_TEST_DSN")
+	if dsn == "" {
+		t.Skip("NOTEAPP_TEST_DSN is not set")
+	}
+	s, err := newPGStore(dsn)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	testStore(t, s)
+}
+
+//Checks a store behaves the way the handlers expect. Every store implementation must pass this
+func testStore(t *testing.T, s Store) {
+	now := time.Now().Truncate(24 * time.Hour)
+
+	//Users
+	owner, err := s.CreateUser(User{GivenName: "Store", FamilyName: "Owner", Password: "owner hash"})
+	assert.NoError(t, err)
+	assert.NotZero(t, owner.UserID, "CreateUser() should set the UserID")
+	reader, err := s.CreateUser(User{GivenName: "Store", FamilyName: "Reader", Password: "reader hash"})
+	assert.NoError(t, err)
+
+	user, err := s.GetUser(owner.UserID)
+	assert.NoError(t, err)
+	assert.Equal(t, "Owner", user.FamilyName)
+	assert.Empty(t, user.Password, "GetUser() should not return the password")
+	_, err = s.GetUser(999999999)
+	assert.Equal(t, errNotFound, err)
+
+	users, err := s.GetUsers()
+	assert.NoError(t, err)
+	assert.NotEmpty(t, users, "GetUsers() should return a list of users")
+	for _, user := range users {
+		assert.Empty(t, user.Password, "GetUsers() should not return passwords")
+	}
+
+	password, err := s.GetPassword(owner.UserID)
+	assert.NoError(t, err)
+	assert.Equal(t, "owner hash", password)
+	assert.NoError(t, s.UpdatePassword(owner.UserID, "new hash"))
+	password, err = s.GetPassword(owner.UserID)
+	assert.NoError(t, err)
+	assert.Equal(t, "new hash", password)
+	_, err = s.GetPassword(999999999)
+	assert.Equal(t, errNotFound, err)
+
+	//Notes
+	note, err := s.CreateNote(Note{UserID: owner.UserID, Title: "store title", Contents: "store contents", DateCreated: now, DateUpdated: now})
+	assert.NoError(t, err)
+	assert.NotZero(t, note.NoteID, "CreateNote() should set the NoteID")
+	assert.Equal(t, 1, note.Version, "CreateNote() should start the version at 1")
+	other, err := s.CreateNote(Note{UserID: owner.UserID, Title: "other", Contents: "unrelated", DateCreated: now, DateUpdated: now})
+	assert.NoError(t, err)
+
+	saved, err := s.GetNote(note.NoteID)
+	assert.NoError(t, err)
+	assert.Equal(t, "store contents", saved.Contents)
+	assert.Equal(t, owner.UserID, saved.UserID)
+	_, err = s.GetNote(999999999)
+	assert.Equal(t, errNotFound, err)
+
+	note.Title = "updated title"
+	note.Contents = "updated contents"
+	assert.NoError(t, s.UpdateNote(note, reader.UserID))
+	saved, err = s.GetNote(note.NoteID)
+	assert.NoError(t, err)
+	assert.Equal(t, "updated title", saved.Title)
+	assert.Equal(t, "updated contents", saved.Contents)
+	assert.Equal(t, 2, saved.Version, "UpdateNote() should add one to the version")
+
+	//Saving over a version that has already been replaced is a conflict
+	stale := note
+	stale.Contents = "stale contents"
+	assert.Equal(t, errConflict, s.UpdateNote(stale, reader.UserID))
+	saved, err = s.GetNote(note.NoteID)
+	assert.NoError(t, err)
+	assert.Equal(t, "updated contents", saved.Contents)
+
+	//Revisions
+	revisions, err := s.GetRevisions(note.NoteID)
+	assert.NoError(t, err)
+	if assert.Len(t, revisions, 2, "CreateNote() and UpdateNote() should each record a revision") {
+		assert.Equal(t, "updated contents", revisions[0].Contents, "GetRevisions() should return the newest first")
+		assert.Equal(t, reader.UserID, revisions[0].UserID, "UpdateNote() should record who made the change")
+		assert.Equal(t, 2, revisions[0].Version)
+		assert.Equal(t, "store contents", revisions[1].Contents)
+		assert.Equal(t, owner.UserID, revisions[1].UserID)
+
+		revision, err := s.GetRevision(note.NoteID, revisions[1].RevisionID)
+		assert.NoError(t, err)
+		assert.Equal(t, "store title", revision.Title)
+		_, err = s.GetRevision(other.NoteID, revisions[1].RevisionID)
+		assert.Equal(t, errNotFound, err, "GetRevision() should not return revisions of other notes")
+	}
+
+	userNotes, err := s.GetUserNotes(owner.UserID)
+	assert.NoError(t, err)
+	assert.Len(t, userNotes, 2, "GetUserNotes() should return the notes a user owns")
+	userNotes, err = s.GetUserNotes(reader.UserID)
+	assert.NoError(t, err)
+	assert.Empty(t, userNotes, "GetUserNotes() should not return notes that have not been shared")
+
+	found, err := s.SearchNotes(owner.UserID, parseSearchQuery("updated"))
+	assert.NoError(t, err)
+	if assert.Len(t, found, 1) {
+		assert.Equal(t, note.NoteID, found[0].NoteID)
+	}
+
+	//Access
+	access, err := s.AddAccess(NoteAccess{NoteID: note.NoteID, UserID: reader.UserID, Role: roleViewer})
+	assert.NoError(t, err)
+	assert.NotZero(t, access.NoteAccessID, "AddAccess() should set the NoteAccessID")
+	userNotes, err = s.GetUserNotes(reader.UserID)
+	assert.NoError(t, err)
+	assert.Len(t, userNotes, 1, "GetUserNotes() should return notes shared with read access")
+	found, err = s.SearchNotes(reader.UserID, parseSearchQuery("updated"))
+	assert.NoError(t, err)
+	assert.Len(t, found, 1, "SearchNotes() should find notes shared with read access")
+
+	counts, err := s.CountAccess([]int{note.NoteID, other.NoteID})
+	assert.NoError(t, err)
+	assert.Equal(t, map[int]int{note.NoteID: 1}, counts, "CountAccess() should count the access rows on each note")
+	counts, err = s.CountAccess(nil)
+	assert.NoError(t, err)
+	assert.Empty(t, counts)
+
+	//Sharing with the same user again changes their row rather than adding another
+	again, err := s.AddAccess(NoteAccess{NoteID: note.NoteID, UserID: reader.UserID, Role: roleCommenter, GrantedBy: owner.UserID, DateGranted: now})
+	assert.NoError(t, err)
+	assert.Equal(t, access.NoteAccessID, again.NoteAccessID, "AddAccess() should update the row the user already has")
+	accessRows, err := s.GetAccess(note.NoteID)
+	assert.NoError(t, err)
+	if assert.Len(t, accessRows, 1) {
+		assert.Equal(t, roleCommenter, accessRows[0].Role)
+		assert.Equal(t, owner.UserID, accessRows[0].GrantedBy)
+	}
+	_, err = s.AddAccess(NoteAccess{NoteID: note.NoteID, UserID: reader.UserID, Role: roleViewer})
+	assert.NoError(t, err)
+
+	access, err = s.GetUserAccess(note.NoteID, reader.UserID)
+	assert.NoError(t, err)
+	assert.Equal(t, roleViewer, access.Role)
+	assert.Zero(t, access.GrantedBy, "access added without a grant should have no GrantedBy")
+	assert.True(t, access.DateGranted.IsZero())
+	_, err = s.GetUserAccess(other.NoteID, reader.UserID)
+	assert.Equal(t, errNotFound, err)
+
+	assert.NoError(t, s.SetUserAccess(NoteAccess{NoteID: note.NoteID, UserID: reader.UserID, Role: roleCoOwner, GrantedBy: owner.UserID, DateGranted: now}))
+	access, err = s.GetUserAccess(note.NoteID, reader.UserID)
+	assert.NoError(t, err)
+	assert.Equal(t, roleCoOwner, access.Role)
+	assert.Equal(t, owner.UserID, access.GrantedBy)
+	assert.True(t, now.Equal(access.DateGranted), "SetUserAccess() should record when the role was granted")
+	assert.Equal(t, errNotFound, s.SetUserAccess(NoteAccess{NoteID: other.NoteID, UserID: reader.UserID, Role: roleEditor}))
+
+	//Changing one users role leaves everyone elses alone
+	granted, err := s.AddAccess(NoteAccess{NoteID: note.NoteID, UserID: owner.UserID, Role: roleEditor, GrantedBy: reader.UserID, DateGranted: now})
+	assert.NoError(t, err)
+	assert.Equal(t, reader.UserID, granted.GrantedBy)
+	assert.NoError(t, s.SetUserAccess(NoteAccess{NoteID: note.NoteID, UserID: reader.UserID, Role: roleCommenter}))
+	accessRows, err = s.GetAccess(note.NoteID)
+	assert.NoError(t, err)
+	if assert.Len(t, accessRows, 2) {
+		assert.Equal(t, roleCommenter, accessRows[0].Role)
+		assert.Equal(t, roleEditor, accessRows[1].Role, "SetUserAccess() should only change the one user")
+		assert.Equal(t, reader.UserID, accessRows[1].GrantedBy)
+		assert.True(t, now.Equal(accessRows[1].DateGranted))
+	}
+	assert.NoError(t, s.RemoveAccess(note.NoteID, owner.UserID))
+	assert.Equal(t, errNotFound, s.RemoveAccess(note.NoteID, owner.UserID))
+	accessRows, err = s.GetAccess(note.NoteID)
+	assert.NoError(t, err)
+	assert.Len(t, accessRows, 1, "RemoveAccess() should only remove the one user")
+
+	//Shared settings
+	assert.NoError(t, s.AddSharedSetting(SharedSettings{OwnerID: owner.UserID, SharedUserID: reader.UserID, Role: roleViewer, Name: "team"}))
+	settings, err := s.GetSharedSettings(owner.UserID)
+	assert.NoError(t, err)
+	if assert.Len(t, settings, 1) {
+		assert.Equal(t, "team", settings[0].Name)
+		assert.Equal(t, reader.UserID, settings[0].SharedUserID)
+	}
+	settings, err = s.GetSharedSettings(reader.UserID)
+	assert.NoError(t, err)
+	assert.Empty(t, settings)
+
+	//Search. The words are ones Postgres leaves as they are, so both stores match them the same way
+	searcher, err := s.CreateUser(User{GivenName: "Store", FamilyName: "Searcher", Password: "searcher hash"})
+	assert.NoError(t, err)
+	inTitle, err := s.CreateNote(Note{UserID: searcher.UserID, Title: "zebra", Contents: "a green walrus swims", DateCreated: now, DateUpdated: now})
+	assert.NoError(t, err)
+	inContents, err := s.CreateNote(Note{UserID: searcher.UserID, Title: "notes", Contents: "zebra walrus green", DateCreated: now, DateUpdated: now})
+	assert.NoError(t, err)
+	pelican, err := s.CreateNote(Note{UserID: searcher.UserID, Title: "pelican", Contents: "pelican only", DateCreated: now, DateUpdated: now})
+	assert.NoError(t, err)
+	searches := []struct {
+		query string
+		want  []int
+	}{
+		{"zebra", []int{inTitle.NoteID, inContents.NoteID}},
+		{"ZEBRA walrus", []int{inTitle.NoteID, inContents.NoteID}},
+		{`"green walrus"`, []int{inTitle.NoteID}},
+		{"pelic*", []int{pelican.NoteID}},
+		{"walrus -swims", []int{inContents.NoteID}},
+		{"pelican OR swims", []int{pelican.NoteID, inTitle.NoteID}},
+		{"zebra pelican", nil},
+		{"", nil},
+	}
+	for _, search := range searches {
+		found, err := s.SearchNotes(searcher.UserID, parseSearchQuery(search.query))
+		assert.NoError(t, err)
+		var ids []int
+		for _, result := range found {
+			ids = append(ids, result.NoteID)
+		}
+		assert.Equal(t, search.want, ids, "SearchNotes(%q)", search.query)
+	}
+	found, err = s.SearchNotes(searcher.UserID, parseSearchQuery("zebra"))
+	assert.NoError(t, err)
+	if assert.Len(t, found, 2) {
+		assert.Greater(t, found[0].Rank, found[1].Rank, "SearchNotes() should rank title matches above contents matches")
+		assert.Contains(t, found[1].Snippet, "<mark>zebra</mark>")
+	}
+	found, err = s.SearchNotes(reader.UserID, parseSearchQuery("zebra"))
+	assert.NoError(t, err)
+	assert.Empty(t, found, "SearchNotes() should not find notes that have not been shared")
+
+	//Search filters
+	lastWeek := now.AddDate(0, 0, -7)
+	shared, err := s.CreateNote(Note{UserID: reader.UserID, Title: "zebra shared", Contents: "", DateCreated: lastWeek, DateUpdated: lastWeek})
+	assert.NoError(t, err)
+	_, err = s.AddAccess(NoteAccess{NoteID: shared.NoteID, UserID: searcher.UserID, Role: roleViewer})
+	assert.NoError(t, err)
+	fewDaysAgo := now.AddDate(0, 0, -3)
+	filters := []struct {
+		filter searchFilter
+		want   []int
+	}{
+		{searchFilter{}, []int{inTitle.NoteID, inContents.NoteID, shared.NoteID}},
+		{searchFilter{Scope: scopeOwned}, []int{inTitle.NoteID, inContents.NoteID}},
+		{searchFilter{Scope: scopeShared}, []int{shared.NoteID}},
+		{searchFilter{OwnerID: reader.UserID}, []int{shared.NoteID}},
+		{searchFilter{Writable: true}, []int{inTitle.NoteID, inContents.NoteID}},
+		{searchFilter{CreatedTo: fewDaysAgo}, []int{shared.NoteID}},
+		{searchFilter{CreatedFrom: fewDaysAgo}, []int{inTitle.NoteID, inContents.NoteID}},
+		{searchFilter{UpdatedFrom: lastWeek.AddDate(0, 0, -1), UpdatedTo: fewDaysAgo}, []int{shared.NoteID}},
+		{searchFilter{Scope: scopeShared, Writable: true}, nil},
+	}
+	for _, f := range filters {
+		query := parseSearchQuery("zebra")
+		query.Filter = f.filter
+		found, err := s.SearchNotes(searcher.UserID, query)
+		assert.NoError(t, err)
+		var ids []int
+		for _, result := range found {
+			ids = append(ids, result.NoteID)
+		}
+		assert.ElementsMatch(t, f.want, ids, "SearchNotes(zebra, %+v)", f.filter)
+	}
+	//A filter on its own lists every note it lets through
+	found, err = s.SearchNotes(searcher.UserID, searchQuery{Filter: searchFilter{Scope: scopeShared}})
+	assert.NoError(t, err)
+	if assert.Len(t, found, 1) {
+		assert.Equal(t, shared.NoteID, found[0].NoteID)
+	}
+
+	//Tags
+	assert.Equal(t, []string{}, inTitle.Tags, "CreateNote() should return a note without tags")
+	assert.NoError(t, s.SetNoteTags(inTitle.NoteID, []string{"mammal", "striped"}))
+	assert.NoError(t, s.SetNoteTags(inContents.NoteID, []string{"mammal"}))
+	assert.NoError(t, s.SetNoteTags(shared.NoteID, []string{"mammal", "shared"}))
+	tagged, err := s.GetNote(inTitle.NoteID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"mammal", "striped"}, tagged.Tags)
+	tagged.Title = "zebra renamed"
+	assert.NoError(t, s.UpdateNote(tagged, searcher.UserID))
+	tagged, err = s.GetNote(inTitle.NoteID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"mammal", "striped"}, tagged.Tags, "UpdateNote() should keep the tags")
+	assert.NoError(t, s.SetNoteTags(inContents.NoteID, []string{"striped"}))
+	assert.NoError(t, s.SetNoteTags(inContents.NoteID, []string{"striped"}), "SetNoteTags() should be safe to repeat")
+	tagged, err = s.GetNote(inContents.NoteID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"striped"}, tagged.Tags, "SetNoteTags() should replace the tags")
+
+	userNotes, err = s.GetUserNotes(searcher.UserID)
+	assert.NoError(t, err)
+	for _, userNote := range userNotes {
+		if userNote.NoteID == shared.NoteID {
+			assert.Equal(t, []string{"mammal", "shared"}, userNote.Tags, "GetUserNotes() should fill in tags")
+		}
+	}
+	tagCounts, err := s.GetTagCounts(searcher.UserID)
+	assert.NoError(t, err)
+	assert.Equal(t, []tagCount{{"mammal", 2}, {"shared", 1}, {"striped", 2}}, tagCounts)
+	tagCounts, err = s.GetTagCounts(owner.UserID)
+	assert.NoError(t, err)
+	assert.Empty(t, tagCounts, "GetTagCounts() should only count notes the user can read")
+
+	query := searchQuery{Filter: searchFilter{Tags: []string{"mammal"}}}
+	found, err = s.SearchNotes(searcher.UserID, query)
+	assert.NoError(t, err)
+	var ids []int
+	for _, result := range found {
+		ids = append(ids, result.NoteID)
+		if result.NoteID == shared.NoteID {
+			assert.Equal(t, []string{"mammal", "shared"}, result.Tags, "SearchNotes() should fill in tags")
+		}
+	}
+	assert.ElementsMatch(t, []int{inTitle.NoteID, shared.NoteID}, ids)
+	query = parseSearchQuery("zebra")
+	query.Filter.Tags = []string{"mammal", "striped"}
+	found, err = s.SearchNotes(searcher.UserID, query)
+	assert.NoError(t, err)
+	if assert.Len(t, found, 1, "SearchNotes() should need every tag") {
+		assert.Equal(t, inTitle.NoteID, found[0].NoteID)
+	}
+
+	//Attachments
+	firstKey, err := newBlobKey()
+	assert.NoError(t, err)
+	secondKey, err := newBlobKey()
+	assert.NoError(t, err)
+	first, err := s.AddAttachment(Attachment{NoteID: note.NoteID, UserID: owner.UserID, FileName: "first.txt", ContentType: "text/plain; charset=utf-8", Size: 5, BlobKey: firstKey, DateCreated: now})
+	assert.NoError(t, err)
+	assert.NotZero(t, first.AttachmentID, "AddAttachment() should set the AttachmentID")
+	second, err := s.AddAttachment(Attachment{NoteID: note.NoteID, UserID: reader.UserID, FileName: "second.png", ContentType: "image/png", Size: 2048, BlobKey: secondKey, DateCreated: now.Add(time.Minute)})
+	assert.NoError(t, err)
+	attachment, err := s.GetAttachment(second.AttachmentID)
+	assert.NoError(t, err)
+	assert.Equal(t, second.BlobKey, attachment.BlobKey)
+	assert.Equal(t, int64(2048), attachment.Size)
+	assert.Equal(t, reader.UserID, attachment.UserID)
+	_, err = s.GetAttachment(999999999)
+	assert.Equal(t, errNotFound, err)
+	attachments, err := s.GetAttachments(note.NoteID)
+	assert.NoError(t, err)
+	if assert.Len(t, attachments, 2) {
+		assert.Equal(t, first.AttachmentID, attachments[0].AttachmentID, "GetAttachments() should list the oldest first")
+	}
+	attachments, err = s.GetAttachments(other.NoteID)
+	assert.NoError(t, err)
+	assert.Empty(t, attachments)
+	assert.NoError(t, s.DeleteAttachment(first.AttachmentID))
+	_, err = s.GetAttachment(first.AttachmentID)
+	assert.Equal(t, errNotFound, err)
+
+	//Trash. A note in the trash is hidden from everything else until it is restored, and keeps its access rows
+	assert.NoError(t, s.SetNoteTags(other.NoteID, []string{"binned"}))
+	_, err = s.AddAccess(NoteAccess{NoteID: other.NoteID, UserID: reader.UserID, Role: roleEditor})
+	assert.NoError(t, err)
+	assert.NoError(t, s.TrashNote(other.NoteID, now))
+	assert.Equal(t, errNotFound, s.TrashNote(other.NoteID, now), "TrashNote() should not trash a note twice")
+	assert.Equal(t, errNotFound, s.TrashNote(999999999, now))
+	_, err = s.GetNote(other.NoteID)
+	assert.Equal(t, errNotFound, err, "GetNote() should not return notes in the trash")
+	for _, userID := range []int{owner.UserID, reader.UserID} {
+		userNotes, err := s.GetUserNotes(userID)
+		assert.NoError(t, err)
+		for _, userNote := range userNotes {
+			assert.NotEqual(t, other.NoteID, userNote.NoteID, "GetUserNotes() should leave out notes in the trash")
+		}
+	}
+	found, err = s.SearchNotes(owner.UserID, parseSearchQuery("unrelated"))
+	assert.NoError(t, err)
+	assert.Empty(t, found, "SearchNotes() should leave out notes in the trash")
+	tagCounts, err = s.GetTagCounts(owner.UserID)
+	assert.NoError(t, err)
+	assert.NotContains(t, tagCounts, tagCount{"binned", 1}, "GetTagCounts() should leave out notes in the trash")
+	assert.Equal(t, errConflict, s.UpdateNote(Note{NoteID: other.NoteID, Title: "t", Contents: "c", DateUpdated: now, Version: other.Version}, owner.UserID))
+
+	trash, err := s.GetTrash(owner.UserID)
+	assert.NoError(t, err)
+	if assert.Len(t, trash, 1) {
+		assert.Equal(t, other.NoteID, trash[0].NoteID)
+		assert.Equal(t, "unrelated", trash[0].Contents)
+		assert.Equal(t, []string{"binned"}, trash[0].Tags)
+		assert.True(t, now.Equal(trash[0].DateDeleted))
+	}
+	trash, err = s.GetTrash(reader.UserID)
+	assert.NoError(t, err)
+	assert.Empty(t, trash, "GetTrash() should only list the users own notes")
+	trashed, err := s.GetTrashedNote(other.NoteID)
+	assert.NoError(t, err)
+	assert.Equal(t, owner.UserID, trashed.UserID)
+	_, err = s.GetTrashedNote(note.NoteID)
+	assert.Equal(t, errNotFound, err, "GetTrashedNote() should not return notes that are not in the trash")
+	expired, err := s.GetExpiredTrash(now)
+	assert.NoError(t, err)
+	assert.NotContains(t, expired, other.NoteID)
+	expired, err = s.GetExpiredTrash(now.Add(time.Second))
+	assert.NoError(t, err)
+	assert.Contains(t, expired, other.NoteID)
+
+	assert.NoError(t, s.RestoreNote(other.NoteID))
+	assert.Equal(t, errNotFound, s.RestoreNote(other.NoteID), "RestoreNote() should only restore notes in the trash")
+	_, err = s.GetNote(other.NoteID)
+	assert.NoError(t, err)
+	userAccess, err := s.GetUserAccess(other.NoteID, reader.UserID)
+	assert.NoError(t, err)
+	assert.Equal(t, roleEditor, userAccess.Role, "a restored note should be shared as it was before")
+	trash, err = s.GetTrash(owner.UserID)
+	assert.NoError(t, err)
+	assert.Empty(t, trash)
+	assert.NoError(t, s.SetNoteTags(other.NoteID, nil))
+
+	//Deleting a note also deletes its access rows, revisions, tags and attachment rows
+	assert.NoError(t, s.SetNoteTags(note.NoteID, []string{"deleted"}))
+	assert.NoError(t, s.DeleteNote(note.NoteID))
+	_, err = s.GetNote(note.NoteID)
+	assert.Equal(t, errNotFound, err)
+	accessRows, err = s.GetAccess(note.NoteID)
+	assert.NoError(t, err)
+	assert.Empty(t, accessRows)
+	revisions, err = s.GetRevisions(note.NoteID)
+	assert.NoError(t, err)
+	assert.Empty(t, revisions)
+	tagCounts, err = s.GetTagCounts(owner.UserID)
+	assert.NoError(t, err)
+	assert.Empty(t, tagCounts)
+	attachments, err = s.GetAttachments(note.NoteID)
+	assert.NoError(t, err)
+	assert.Empty(t, attachments)
+	_, err = s.GetAttachment(second.AttachmentID)
+	assert.Equal(t, errNotFound, err)
+
+	//Notebooks. Sharing a notebook shares every note in it and in the notebooks inside it
+	keeper, err := s.CreateUser(User{GivenName: "Store", FamilyName: "Keeper", Password: "keeper hash"})
+	assert.NoError(t, err)
+	visitor, err := s.CreateUser(User{GivenName: "Store", FamilyName: "Visitor", Password: "visitor hash"})
+	assert.NoError(t, err)
+	top, err := s.CreateNotebook(Notebook{UserID: keeper.UserID, Name: "top", DateCreated: now})
+	assert.NoError(t, err)
+	assert.NotZero(t, top.NotebookID, "CreateNotebook() should set the NotebookID")
+	inner, err := s.CreateNotebook(Notebook{UserID: keeper.UserID, ParentID: top.NotebookID, Name: "inner", DateCreated: now})
+	assert.NoError(t, err)
+	savedNotebook, err := s.GetNotebook(inner.NotebookID)
+	assert.NoError(t, err)
+	assert.Equal(t, top.NotebookID, savedNotebook.ParentID)
+	assert.Equal(t, "inner", savedNotebook.Name)
+	_, err = s.GetNotebook(999999999)
+	assert.Equal(t, errNotFound, err)
+	notebooks, err := s.GetUserNotebooks(keeper.UserID)
+	assert.NoError(t, err)
+	assert.Len(t, notebooks, 2)
+	notebooks, err = s.GetChildNotebooks(top.NotebookID)
+	assert.NoError(t, err)
+	if assert.Len(t, notebooks, 1) {
+		assert.Equal(t, inner.NotebookID, notebooks[0].NotebookID)
+	}
+
+	filed, err := s.CreateNote(Note{UserID: keeper.UserID, Title: "filed", Contents: "okapi", DateCreated: now, DateUpdated: now, NotebookID: inner.NotebookID})
+	assert.NoError(t, err)
+	loose, err := s.CreateNote(Note{UserID: keeper.UserID, Title: "loose", Contents: "okapi", DateCreated: now, DateUpdated: now})
+	assert.NoError(t, err)
+	savedNote, err := s.GetNote(filed.NoteID)
+	assert.NoError(t, err)
+	assert.Equal(t, inner.NotebookID, savedNote.NotebookID, "CreateNote() should save the notebook")
+	assert.NoError(t, s.MoveNote(loose.NoteID, top.NotebookID))
+	notebookNotes, err := s.GetNotebookNotes(top.NotebookID)
+	assert.NoError(t, err)
+	if assert.Len(t, notebookNotes, 1) {
+		assert.Equal(t, loose.NoteID, notebookNotes[0].NoteID)
+		assert.Equal(t, top.NotebookID, notebookNotes[0].NotebookID)
+	}
+	assert.Equal(t, errNotFound, s.MoveNote(999999999, top.NotebookID))
+
+	visible, err := s.GetUserNotes(visitor.UserID)
+	assert.NoError(t, err)
+	assert.Empty(t, visible)
+	assert.NoError(t, s.SetNotebookAccess(NotebookAccess{NotebookID: top.NotebookID, UserID: visitor.UserID, Role: roleViewer}))
+	visible, err = s.GetUserNotes(visitor.UserID)
+	assert.NoError(t, err)
+	var visibleIDs []int
+	for _, note := range visible {
+		visibleIDs = append(visibleIDs, note.NoteID)
+	}
+	assert.ElementsMatch(t, []int{filed.NoteID, loose.NoteID}, visibleIDs, "GetUserNotes() should include notes in shared notebooks and the notebooks inside them")
+	found, err = s.SearchNotes(visitor.UserID, parseSearchQuery("okapi"))
+	assert.NoError(t, err)
+	assert.Len(t, found, 2, "SearchNotes() should include notes in shared notebooks")
+	query = parseSearchQuery("okapi")
+	query.Filter.Writable = true
+	found, err = s.SearchNotes(visitor.UserID, query)
+	assert.NoError(t, err)
+	assert.Empty(t, found, "read access to a notebook should not count as write access")
+
+	assert.NoError(t, s.SetNotebookAccess(NotebookAccess{NotebookID: top.NotebookID, UserID: visitor.UserID, Role: roleEditor}))
+	notebookAccess, err := s.GetNotebookAccess(top.NotebookID)
+	assert.NoError(t, err)
+	assert.Len(t, notebookAccess, 1, "SetNotebookAccess() should change access that is already there rather than add to it")
+	userNotebookAccess, err := s.GetUserNotebookAccess(top.NotebookID, visitor.UserID)
+	assert.NoError(t, err)
+	assert.Equal(t, roleEditor, userNotebookAccess.Role)
+	_, err = s.GetUserNotebookAccess(inner.NotebookID, visitor.UserID)
+	assert.Equal(t, errNotFound, err)
+	found, err = s.SearchNotes(visitor.UserID, query)
+	assert.NoError(t, err)
+	assert.Len(t, found, 2)
+	sharedNotebooks, err := s.GetSharedNotebooks(visitor.UserID)
+	assert.NoError(t, err)
+	if assert.Len(t, sharedNotebooks, 1) {
+		assert.Equal(t, top.NotebookID, sharedNotebooks[0].NotebookID)
+	}
+
+	assert.NoError(t, s.MoveNote(filed.NoteID, 0))
+	savedNote, err = s.GetNote(filed.NoteID)
+	assert.NoError(t, err)
+	assert.Zero(t, savedNote.NotebookID, "MoveNote() with 0 should take the note out of its notebook")
+	//Notes in the trash do not count towards a notebook, and are taken out of it when it is deleted
+	binned, err := s.CreateNote(Note{UserID: keeper.UserID, Title: "binned", Contents: "in the trash", DateCreated: now, DateUpdated: now, NotebookID: inner.NotebookID})
+	assert.NoError(t, err)
+	assert.NoError(t, s.TrashNote(binned.NoteID, now))
+	assert.Equal(t, errNotFound, s.MoveNote(binned.NoteID, top.NotebookID), "MoveNote() should not move notes in the trash")
+	notebookNotes, err = s.GetNotebookNotes(inner.NotebookID)
+	assert.NoError(t, err)
+	assert.Empty(t, notebookNotes)
+	assert.NoError(t, s.DeleteNotebook(inner.NotebookID))
+	_, err = s.GetNotebook(inner.NotebookID)
+	assert.Equal(t, errNotFound, err)
+	trashed, err = s.GetTrashedNote(binned.NoteID)
+	assert.NoError(t, err)
+	assert.Zero(t, trashed.NotebookID)
+	assert.NoError(t, s.DeleteNote(binned.NoteID))
+	_, err = s.GetTrashedNote(binned.NoteID)
+	assert.Equal(t, errNotFound, err, "DeleteNote() should delete notes in the trash")
+
+	//Revoking a notebook share takes away the role it gave on the notes in it
+	assert.NoError(t, s.RemoveNotebookAccess(top.NotebookID, visitor.UserID))
+	assert.Equal(t, errNotFound, s.RemoveNotebookAccess(top.NotebookID, visitor.UserID))
+	_, err = s.GetUserNotebookAccess(top.NotebookID, visitor.UserID)
+	assert.Equal(t, errNotFound, err)
+	sharedNotebooks, err = s.GetSharedNotebooks(visitor.UserID)
+	assert.NoError(t, err)
+	assert.Empty(t, sharedNotebooks)
+	visible, err = s.GetUserNotes(visitor.UserID)
+	assert.NoError(t, err)
+	assert.Empty(t, visible, "RemoveNotebookAccess() should stop the notes in the notebook being shared")
+
+	//Transferring a note takes it out of the old owners notebook and drops the new owners access row, which their
+	//ownership replaces
+	_, err = s.AddAccess(NoteAccess{NoteID: loose.NoteID, UserID: visitor.UserID, Role: roleViewer})
+	assert.NoError(t, err)
+	assert.NoError(t, s.TransferNote(loose.NoteID, visitor.UserID, roleEditor, now))
+	savedNote, err = s.GetNote(loose.NoteID)
+	assert.NoError(t, err)
+	assert.Equal(t, visitor.UserID, savedNote.UserID)
+	assert.Zero(t, savedNote.NotebookID, "TransferNote() should take the note out of its notebook")
+	_, err = s.GetUserAccess(loose.NoteID, visitor.UserID)
+	assert.Equal(t, errNotFound, err)
+	access, err = s.GetUserAccess(loose.NoteID, keeper.UserID)
+	assert.NoError(t, err)
+	assert.Equal(t, roleEditor, access.Role, "TransferNote() should keep the old owner on with the role given")
+	assert.Equal(t, keeper.UserID, access.GrantedBy)
+	assert.True(t, now.Equal(access.DateGranted))
+	assert.NoError(t, s.TransferNote(loose.NoteID, keeper.UserID, "", now))
+	accessRows, err = s.GetAccess(loose.NoteID)
+	assert.NoError(t, err)
+	assert.Empty(t, accessRows, "TransferNote() without a role should not keep the old owner on")
+	assert.Equal(t, errNotFound, s.TransferNote(999999999, keeper.UserID, "", now))
+
+	//Sessions
+	session := Session{SessionID: hashSessionToken("store test " + time.Now().String()), UserID: owner.UserID, DateCreated: time.Now(), LastSeen: time.Now()}
+	assert.NoError(t, s.CreateSession(session))
+	savedSession, err := s.GetSession(session.SessionID)
+	assert.NoError(t, err)
+	assert.Equal(t, owner.UserID, savedSession.UserID)
+
+	lastSeen := time.Now().Add(-time.Hour)
+	assert.NoError(t, s.TouchSession(session.SessionID, lastSeen))
+	savedSession, err = s.GetSession(session.SessionID)
+	assert.NoError(t, err)
+	assert.WithinDuration(t, lastSeen, savedSession.LastSeen, time.Second)
+
+	assert.NoError(t, s.DeleteExpiredSessions(time.Now().Add(-time.Minute), time.Now().Add(-24*time.Hour)))
+	_, err = s.GetSession(session.SessionID)
+	assert.Equal(t, errNotFound, err, "DeleteExpiredSessions() should delete idle sessions")
+
+	assert.NoError(t, s.CreateSession(session))
+	assert.NoError(t, s.DeleteSession(session.SessionID))
+	_, err = s.GetSession(session.SessionID)
+	assert.Equal(t, errNotFound, err)
+
+	assert.NoError(t, s.CreateSession(session))
+	assert.NoError(t, s.DeleteUserSessions(owner.UserID))
+	_, err = s.GetSession(session.SessionID)
+	assert.Equal(t, errNotFound, err)
+}
+
+func TestSeedDemoData(t *testing.T) {
+	s := newMemStore()
+	assert.NoError(t, seedDemoData(s))
+
+	ok, err := func() (bool, error) {
+		saved := store
+		store = s
+		defer func() { store = saved }()
+		return checkPassword("hello123", 1)
+	}()
+	assert.NoError(t, err)
+	assert.True(t, ok, "demo user 1 should log in with the documented password")
+
+	notes, err := s.GetUserNotes(2)
+	assert.NoError(t, err)
+	assert.Len(t, notes, 4)
+	counts, err := s.GetTagCounts(2)
+	assert.NoError(t, err)
+	assert.Equal(t, []tagCount{{"animals", 3}, {"greetings", 1}}, counts)
+}
@@ -0,0 +1,123 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+//Longest a tag can be, and the most tags a note can have
+const (
+	maxTagLength = 30
+	maxNoteTags  = 20
+)
+
+//How many of a users notes have a tag
+type tagCount struct {
+	Name  string `json:"name"`
+	Count int    `json:"count"`
+}
+
+//A tag in the tag cloud. Size goes from 1 for the least used tags to 5 for the most used
+type cloudTag struct {
+	tagCount
+	Size int
+}
+
+//Tidies up tags as a user typed them. Tags are lower case with single spaces between words, blank and repeated tags
+//are dropped, and the rest are sorted
+func normaliseTags(tags []string) ([]string, error) {
+	seen := make(map[string]bool)
+	result := []string{}
+	for _, tag := range tags {
+		tag = strings.ToLower(strings.Join(strings.Fields(tag), " "))
+		if tag == "" || seen[tag] {
+			continue
+		}
+		if utf8.RuneCountInString(tag) > maxTagLength {
+			return nil, badRequest("Tags can be at most " + strconv.Itoa(maxTagLength) + " characters long.")
+		}
+		seen[tag] = true
+		result = append(result, tag)
+	}
+	if len(result) > maxNoteTags {
+		return nil, badRequest("A note can have at most " + strconv.Itoa(maxNoteTags) + " tags.")
+	}
+	sort.Strings(result)
+	return result, nil
+}
+
+//Reads a comma separated list of tags
+func parseTags(input string) ([]string, error) {
+	return normaliseTags(strings.Split(input, ","))
+}
+
+//The tags on a note, comma separated, for filling in the tags field of a form
+func (n Note) TagList() string {
+	return strings.Join(n.Tags, ", ")
+}
+
+//Whether a note has every one of the tags
+func hasTags(note Note, tags []string) bool {
+	for _, tag := range tags {
+		found := false
+		for _, noteTag := range note.Tags {
+			if noteTag == tag {
+				found = true
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+//Gets the notes that have every one of the tags
+func filterByTags(notes []Note, tags []string) []Note {
+	if len(tags) == 0 {
+		return notes
+	}
+	var matches []Note
+	for _, note := range notes {
+		if hasTags(note, tags) {
+			matches = append(matches, note)
+		}
+	}
+	return matches
+}
+
+//Sizes each tag by how often it is used compared with the most used tag
+func tagCloud(counts []tagCount) []cloudTag {
+	most := 1
+	for _, count := range counts {
+		if count.Count > most {
+			most = count.Count
+		}
+	}
+	var cloud []cloudTag
+	for _, count := range counts {
+		size := 3
+		if most > 1 {
+			size = 1 + 4*(count.Count-1)/(most-1)
+		}
+		cloud = append(cloud, cloudTag{count, size})
+	}
+	return cloud
+}
+
+//Reads the tags field of a form, and whether the form has one. Forms without a tags field should leave a notes tags
+//as they are
+func formTags(r *http.Request) ([]string, bool, error) {
+	err := r.ParseForm()
+	if err != nil {
+		return nil, false, badRequest("The form could not be read.")
+	}
+	if _, ok := r.Form["tags"]; !ok {
+		return nil, false, nil
+	}
+	tags, err := parseTags(r.Form.Get("tags"))
+	return tags, true, err
+}
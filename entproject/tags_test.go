@@ -0,0 +1,121 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNormaliseTags(t *testing.T) {
+	tags, err := parseTags(" Work ,urgent,,  to   do , work")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"to do", "urgent", "work"}, tags)
+
+	tags, err = parseTags("")
+	assert.NoError(t, err)
+	assert.Empty(t, tags)
+
+	_, err = parseTags(strings.Repeat("x", maxTagLength+1))
+	assert.Error(t, err)
+	var many []string
+	for i := 0; i <= maxNoteTags; i++ {
+		many = append(many, strconv.Itoa(i))
+	}
+	_, err = normaliseTags(many)
+	assert.Error(t, err)
+}
+
+func TestTagCloud(t *testing.T) {
+	cloud := tagCloud([]tagCount{{"a", 1}, {"b", 5}, {"c", 3}})
+	assert.Equal(t, []cloudTag{{tagCount{"a", 1}, 1}, {tagCount{"b", 5}, 5}, {tagCount{"c", 3}, 3}}, cloud)
+	assert.Equal(t, 3, tagCloud([]tagCount{{"only", 1}})[0].Size)
+	assert.Empty(t, tagCloud(nil))
+}
+
+func TestFilterByTags(t *testing.T) {
+	notes := []Note{{NoteID: 1, Tags: []string{"a", "b"}}, {NoteID: 2, Tags: []string{"b"}}, {NoteID: 3}}
+	assert.Equal(t, notes, filterByTags(notes, nil))
+	assert.Equal(t, notes[:2], filterByTags(notes, []string{"b"}))
+	assert.Equal(t, notes[:1], filterByTags(notes, []string{"b", "a"}))
+	assert.Empty(t, filterByTags(notes, []string{"c"}))
+}
+
+func TestNoteTagPages(t *testing.T) {
+	owner, err := registerUser("Tags", "Owner", "password")
+	assert.NoError(t, err)
+	home := "/Users/Notes/" + strconv.Itoa(owner.UserID)
+
+	//Tags are typed into the create form
+	rec := formRequest("/Notes/Create/", owner.UserID, url.Values{"title": {"tagged"}, "content": {"penguin"}, "tags": {"Birds, cold"}})
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	_, err = saveNewNote(owner.UserID, "untagged", "walrus", "")
+	assert.NoError(t, err)
+	notes, err := store.GetUserNotes(owner.UserID)
+	assert.NoError(t, err)
+	note := notes[0]
+	assert.Equal(t, []string{"birds", "cold"}, note.Tags)
+	path := "/Notes/Update/" + strconv.Itoa(note.NoteID)
+
+	//The home page shows the tags and can be narrowed down to them
+	rec = apiRequest("GET", home, owner.UserID, nil)
+	assert.Contains(t, rec.Body.String(), ">birds (1)</a>")
+	assert.Contains(t, rec.Body.String(), "untagged")
+	rec = apiRequest("GET", home+"?tags=birds,cold", owner.UserID, nil)
+	assert.Contains(t, rec.Body.String(), "penguin")
+	assert.NotContains(t, rec.Body.String(), "walrus")
+
+	//The update form edits the tags, and forms without a tags field leave them alone
+	rec = apiRequest("GET", path, owner.UserID, nil)
+	assert.Contains(t, rec.Body.String(), `name="tags" value="birds, cold"`)
+	rec = formRequest(path, owner.UserID, url.Values{"title": {"tagged"}, "content": {"penguin"}, "version": {"1"}, "tags": {"birds"}})
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	rec = formRequest(path, owner.UserID, url.Values{"title": {"tagged"}, "content": {"penguins"}, "version": {"2"}})
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	note, err = store.GetNote(note.NoteID)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"birds"}, note.Tags)
+	rec = formRequest(path, owner.UserID, url.Values{"title": {"tagged"}, "content": {"penguins"}, "version": {"3"}, "tags": {strings.Repeat("x", maxTagLength+1)}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	//Search can be narrowed down to tags too
+	rec = apiRequest("GET", "/Notes/Search/?tags=birds", owner.UserID, nil)
+	assert.Contains(t, rec.Body.String(), "penguins")
+	assert.NotContains(t, rec.Body.String(), "walrus")
+}
+
+func TestAPINoteTags(t *testing.T) {
+	owner, err := registerUser("API Tags", "Owner", "password")
+	assert.NoError(t, err)
+
+	rec := apiRequest("POST", "/api/v1/notes", owner.UserID, noteRequest{Title: "tagged", Tags: &[]string{"Fish", "fish", "sea"}})
+	assert.Equal(t, http.StatusCreated, rec.Code)
+	var note Note
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &note))
+	assert.Equal(t, []string{"fish", "sea"}, note.Tags)
+	path := "/api/v1/notes/" + strconv.Itoa(note.NoteID)
+
+	//Leaving the tags out keeps them, an empty list removes them
+	rec = apiRequest("PUT", path, owner.UserID, noteRequest{Title: "renamed", Version: 1})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &note))
+	assert.Equal(t, []string{"fish", "sea"}, note.Tags)
+
+	rec = apiRequest("GET", "/api/v1/notes?tags=sea", owner.UserID, nil)
+	var notes []Note
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &notes))
+	assert.Len(t, notes, 1)
+	rec = apiRequest("GET", "/api/v1/tags", owner.UserID, nil)
+	var counts []tagCount
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &counts))
+	assert.Equal(t, []tagCount{{"fish", 1}, {"sea", 1}}, counts)
+
+	rec = apiRequest("PUT", path, owner.UserID, noteRequest{Title: "renamed", Version: 2, Tags: &[]string{}})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &note))
+	assert.Empty(t, note.Tags)
+}
@@ -0,0 +1,95 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+//Gives a note to another user, who becomes its owner. The note leaves the old owners notebook, since notebooks belong
+//to one user, and any role the new owner had on it is dropped as they now own it. The old owner keeps editor access
+//if keepAccess is set, otherwise they lose the note altogether
+func transferNote(note Note, newOwnerID int, keepAccess bool) error {
+	if newOwnerID == note.UserID {
+		return badRequest("You already own that note.")
+	}
+	_, err := store.GetUser(newOwnerID)
+	if err == errNotFound {
+		return badRequest("That user does not exist.")
+	}
+	if err != nil {
+		return err
+	}
+	var previousOwner Role
+	if keepAccess {
+		previousOwner = roleEditor
+	}
+	return store.TransferNote(note.NoteID, newOwnerID, previousOwner, time.Now())
+}
+
+//Takes a user off a note that has been shared with them directly. Returns the role they still have on it through its
+//notebook, or "" if they no longer have any. The owner can not leave their own note, and a note only shared through a
+//notebook stays shared until the notebooks owner revokes it
+func leaveNote(note Note, userID int) (Role, error) {
+	if note.UserID == userID {
+		return "", badRequest("You own that note. Give it to someone else or delete it instead.")
+	}
+	err := store.RemoveAccess(note.NoteID, userID)
+	if err == errNotFound {
+		return "", badRequest("That note is shared with you through a notebook, not on its own. Ask the notebook's owner to stop sharing the notebook with you.")
+	}
+	if err != nil {
+		return "", err
+	}
+	return notebookRoleFor(note.NotebookID, userID)
+}
+
+//Lets the owner of a note give it to another user
+func transferNotePage(w http.ResponseWriter, r *http.Request) error {
+	//Checks if a user is already logged in
+	session, err := requireSession(w, r)
+	if session == nil {
+		return err
+	}
+	//authoriseNoteRoutes has already checked the user owns the note
+	note, _ := routeNote(r)
+	if r.Method == "POST" {
+		newOwnerID, err := parseID(r.FormValue("userid"))
+		if err != nil {
+			return badRequest("The User ID to give the note to should be a number.")
+		}
+		err = transferNote(note, newOwnerID, r.FormValue("keep") != "")
+		if err != nil {
+			return err
+		}
+		http.Redirect(w, r, "/Users/Notes/"+strconv.Itoa(session.UserID), http.StatusSeeOther)
+		return nil
+	}
+
+	t, err := parseTemplate("transfer.html")
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, note)
+}
+
+//Takes the logged in user off a note that has been shared with them
+func leaveNotePage(w http.ResponseWriter, r *http.Request) error {
+	//Checks if a user is already logged in
+	session, err := requireSession(w, r)
+	if session == nil {
+		return err
+	}
+	note, _ := routeNote(r)
+	remaining, err := leaveNote(note, session.UserID)
+	if err != nil {
+		return err
+	}
+	//The note page says why they can still see it
+	if remaining != "" {
+		http.Redirect(w, r, "/Notes/View/"+strconv.Itoa(note.NoteID)+"?left=1", http.StatusSeeOther)
+		return nil
+	}
+	http.Redirect(w, r, "/Users/Notes/"+strconv.Itoa(session.UserID), http.StatusSeeOther)
+	return nil
+}
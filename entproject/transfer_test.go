@@ -0,0 +1,161 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestTransferNote(t *testing.T) {
+	owner, err := registerUser("Transfer", "Owner", "password")
+	assert.NoError(t, err)
+	receiver, err := registerUser("Transfer", "Receiver", "password")
+	assert.NoError(t, err)
+	notebook, err := store.CreateNotebook(Notebook{UserID: owner.UserID, Name: "owners notebook"})
+	assert.NoError(t, err)
+	note, err := saveNewNote(owner.UserID, "handed over", "contents", "")
+	assert.NoError(t, err)
+	assert.NoError(t, moveNoteTo(owner.UserID, note.NoteID, notebook.NotebookID))
+	_, err = store.AddAccess(NoteAccess{NoteID: note.NoteID, UserID: receiver.UserID, Role: roleViewer})
+	assert.NoError(t, err)
+	id := strconv.Itoa(note.NoteID)
+
+	//Only the owner sees the transfer button, and everyone else the one to leave
+	rec := apiRequest("GET", "/Notes/View/"+id, owner.UserID, nil)
+	assert.Contains(t, rec.Body.String(), "/Notes/Transfer/"+id)
+	assert.NotContains(t, rec.Body.String(), "/Notes/Leave/"+id)
+	rec = apiRequest("GET", "/Notes/View/"+id, receiver.UserID, nil)
+	assert.NotContains(t, rec.Body.String(), "/Notes/Transfer/"+id)
+	assert.Contains(t, rec.Body.String(), "/Notes/Leave/"+id)
+	rec = apiRequest("GET", "/Notes/Transfer/"+id, owner.UserID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "handed over")
+	rec = formRequest("/Notes/Transfer/"+id, receiver.UserID, url.Values{"userid": {strconv.Itoa(receiver.UserID)}})
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	rec = formRequest("/Notes/Transfer/"+id, owner.UserID, url.Values{"userid": {strconv.Itoa(owner.UserID)}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = formRequest("/Notes/Transfer/"+id, owner.UserID, url.Values{"userid": {"999999999"}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = formRequest("/Notes/Transfer/"+id, owner.UserID, url.Values{"userid": {"someone"}})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+
+	//The receiver becomes the owner and the old owner stays on as an editor
+	rec = formRequest("/Notes/Transfer/"+id, owner.UserID, url.Values{"userid": {strconv.Itoa(receiver.UserID)}, "keep": {"on"}})
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	saved, err := store.GetNote(note.NoteID)
+	assert.NoError(t, err)
+	assert.Equal(t, receiver.UserID, saved.UserID)
+	assert.Zero(t, saved.NotebookID, "the note should leave the old owners notebook")
+	_, role, err := authoriseNote(note.NoteID, owner.UserID, capEdit)
+	assert.NoError(t, err)
+	assert.Equal(t, roleEditor, role)
+	_, role, err = authoriseNote(note.NoteID, receiver.UserID, capTransfer)
+	assert.NoError(t, err)
+	assert.Equal(t, roleOwner, role)
+	_, err = store.GetUserAccess(note.NoteID, receiver.UserID)
+	assert.Equal(t, errNotFound, err, "the new owner should not keep their old access row")
+
+	//Without keeping access the old owner loses the note
+	rec = formRequest("/Notes/Transfer/"+id, owner.UserID, url.Values{"userid": {strconv.Itoa(owner.UserID)}})
+	assert.Equal(t, http.StatusForbidden, rec.Code, "the old owner can no longer transfer it")
+	rec = formRequest("/Notes/Transfer/"+id, receiver.UserID, url.Values{"userid": {strconv.Itoa(owner.UserID)}})
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	saved, err = store.GetNote(note.NoteID)
+	assert.NoError(t, err)
+	assert.Equal(t, owner.UserID, saved.UserID)
+	rec = apiRequest("GET", "/Notes/View/"+id, receiver.UserID, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+}
+
+func TestLeaveNote(t *testing.T) {
+	owner, err := registerUser("Leave", "Owner", "password")
+	assert.NoError(t, err)
+	reader, err := registerUser("Leave", "Reader", "password")
+	assert.NoError(t, err)
+	note, err := saveNewNote(owner.UserID, "title", "contents", "")
+	assert.NoError(t, err)
+	_, err = store.AddAccess(NoteAccess{NoteID: note.NoteID, UserID: reader.UserID, Role: roleViewer})
+	assert.NoError(t, err)
+	id := strconv.Itoa(note.NoteID)
+
+	rec := formRequest("/Notes/Leave/"+id, owner.UserID, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code, "owners can not leave their own notes")
+	rec = formRequest("/Notes/Leave/"+id, reader.UserID, nil)
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	rec = apiRequest("GET", "/Notes/View/"+id, reader.UserID, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	//Notes only shared through a notebook have no button to leave, and stay shared until the notebook is unshared
+	notebook, err := store.CreateNotebook(Notebook{UserID: owner.UserID, Name: "shared"})
+	assert.NoError(t, err)
+	assert.NoError(t, moveNoteTo(owner.UserID, note.NoteID, notebook.NotebookID))
+	assert.NoError(t, store.SetNotebookAccess(NotebookAccess{NotebookID: notebook.NotebookID, UserID: reader.UserID, Role: roleViewer}))
+	rec = apiRequest("GET", "/Notes/View/"+id, reader.UserID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "/Notes/Leave/"+id)
+	rec = formRequest("/Notes/Leave/"+id, reader.UserID, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	assert.Contains(t, rec.Body.String(), "stop sharing the notebook with you")
+
+	//Leaving a note also shared through a notebook says it can still be seen
+	_, err = store.AddAccess(NoteAccess{NoteID: note.NoteID, UserID: reader.UserID, Role: roleEditor})
+	assert.NoError(t, err)
+	rec = apiRequest("GET", "/Notes/View/"+id, reader.UserID, nil)
+	assert.Contains(t, rec.Body.String(), "/Notes/Leave/"+id)
+	rec = formRequest("/Notes/Leave/"+id, reader.UserID, nil)
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	assert.Equal(t, "/Notes/View/"+id+"?left=1", rec.Header().Get("Location"))
+	rec = apiRequest("GET", "/Notes/View/"+id+"?left=1", reader.UserID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "still shared with you as Viewer through its notebook")
+	_, err = store.GetUserAccess(note.NoteID, reader.UserID)
+	assert.Equal(t, errNotFound, err)
+}
+
+func TestAPITransferAndLeave(t *testing.T) {
+	owner, err := registerUser("API", "Giver", "password")
+	assert.NoError(t, err)
+	receiver, err := registerUser("API", "Receiver", "password")
+	assert.NoError(t, err)
+	note, err := saveNewNote(owner.UserID, "title", "contents", "")
+	assert.NoError(t, err)
+	path := "/api/v1/notes/" + strconv.Itoa(note.NoteID)
+
+	rec := apiRequest("POST", path+"/transfer", owner.UserID, transferRequest{})
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = apiRequest("POST", path+"/transfer", owner.UserID, transferRequest{UserID: receiver.UserID, KeepAccess: true})
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var saved Note
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &saved))
+	assert.Equal(t, receiver.UserID, saved.UserID)
+	rec = apiRequest("POST", path+"/transfer", owner.UserID, transferRequest{UserID: owner.UserID})
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+
+	//The old owner, now an editor, can leave
+	rec = apiRequest("POST", path+"/leave", receiver.UserID, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+	rec = apiRequest("POST", path+"/leave", owner.UserID, nil)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	rec = apiRequest("GET", path, owner.UserID, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+
+	//Leaving a note still shared through a notebook says which role is left
+	notebook, err := store.CreateNotebook(Notebook{UserID: receiver.UserID, Name: "shared"})
+	assert.NoError(t, err)
+	assert.NoError(t, moveNoteTo(receiver.UserID, note.NoteID, notebook.NotebookID))
+	assert.NoError(t, store.SetNotebookAccess(NotebookAccess{NotebookID: notebook.NotebookID, UserID: owner.UserID, Role: roleCommenter}))
+	_, err = store.AddAccess(NoteAccess{NoteID: note.NoteID, UserID: owner.UserID, Role: roleEditor})
+	assert.NoError(t, err)
+	rec = apiRequest("POST", path+"/leave", owner.UserID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var left leaveResponse
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &left))
+	assert.Equal(t, roleCommenter, left.NotebookRole)
+	rec = apiRequest("POST", path+"/leave", owner.UserID, nil)
+	assert.Equal(t, http.StatusBadRequest, rec.Code)
+}
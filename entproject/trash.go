@@ -0,0 +1,152 @@
+package main
+
+import (
+	"net/http"
+	"strconv"
+	"time"
+)
+
+//How often notes that have been in the trash too long are looked for
+const trashPurgeInterval = time.Hour
+
+//Describes how long notes stay in the trash, in days when it is a whole number of them
+func describeRetention(retention time.Duration) string {
+	day := 24 * time.Hour
+	switch {
+	case retention == day:
+		return "1 day"
+	case retention%day == 0:
+		return strconv.Itoa(int(retention/day)) + " days"
+	}
+	return retention.String()
+}
+
+//Moves a note to its owners trash, if the users role lets them delete it. The note keeps its sharing, revisions, tags
+//and attachments, but nobody can see it until the owner restores it
+func trashNote(userID int, noteID int) error {
+	_, _, err := authoriseNote(noteID, userID, capDelete)
+	if err != nil {
+		return err
+	}
+	return store.TrashNote(noteID, time.Now())
+}
+
+//Loads a note from the users trash. Notes in other users trash are treated as missing
+func ownedTrashedNote(userID int, noteID int) (TrashedNote, error) {
+	note, err := store.GetTrashedNote(noteID)
+	if err != nil && err != errNotFound {
+		return note, err
+	}
+	if err == errNotFound || note.UserID != userID {
+		return note, notFound("That note is not in your trash.")
+	}
+	return note, nil
+}
+
+//Takes a note out of the users trash, shared with the same people as before it was deleted
+func restoreTrashedNote(userID int, noteID int) (Note, error) {
+	trashed, err := ownedTrashedNote(userID, noteID)
+	if err != nil {
+		return Note{}, err
+	}
+	err = store.RestoreNote(noteID)
+	if err != nil {
+		return Note{}, err
+	}
+	return trashed.Note, nil
+}
+
+//Deletes a note in the users trash for good, along with its attachments
+func purgeTrashedNote(userID int, noteID int) error {
+	_, err := ownedTrashedNote(userID, noteID)
+	if err != nil {
+		return err
+	}
+	return deleteNoteAndAttachments(noteID)
+}
+
+//Deletes every note that went in the trash longer than the retention period before now. Keeps going past notes that
+//can not be deleted, and returns how many were
+func purgeExpiredTrash(now time.Time, retention time.Duration) (int, error) {
+	noteIDs, err := store.GetExpiredTrash(now.Add(-retention))
+	if err != nil {
+		return 0, err
+	}
+	purged := 0
+	for _, noteID := range noteIDs {
+		if err := deleteNoteAndAttachments(noteID); err != nil {
+			logError("purging note %d from the trash: %v", noteID, err)
+			continue
+		}
+		purged++
+	}
+	return purged, nil
+}
+
+//Purges expired notes from the trash straight away and then every interval, for as long as the server runs
+func purgeTrashEvery(interval time.Duration, retention time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		purged, err := purgeExpiredTrash(time.Now(), retention)
+		if err != nil {
+			logError("purging the trash: %v", err)
+		} else if purged > 0 {
+			logInfo("purged %d notes that were in the trash for longer than %s", purged, retention)
+		}
+		<-ticker.C
+	}
+}
+
+//Lists the notes in the logged in users trash
+func listTrash(w http.ResponseWriter, r *http.Request) error {
+	//Checks if a user is already logged in
+	session, err := requireSession(w, r)
+	if session == nil {
+		return err
+	}
+	trash, err := store.GetTrash(session.UserID)
+	if err != nil {
+		return err
+	}
+
+	t, err := parseTemplate("trash.html")
+	if err != nil {
+		return err
+	}
+	return t.Execute(w, struct {
+		Trash     []TrashedNote
+		Retention string
+	}{trash, describeRetention(config.trashRetention())})
+}
+
+//Takes a note back out of the trash
+func restoreFromTrash(w http.ResponseWriter, r *http.Request) error {
+	//Checks if a user is already logged in
+	session, err := requireSession(w, r)
+	if session == nil {
+		return err
+	}
+	note, err := restoreTrashedNote(session.UserID, routeID(r, "NoteID"))
+	if err != nil {
+		return err
+	}
+	http.Redirect(w, r, "/Notes/View/"+strconv.Itoa(note.NoteID), http.StatusSeeOther)
+	return nil
+}
+
+//Deletes a note in the trash for good
+func purgeFromTrash(w http.ResponseWriter, r *http.Request) error {
+	//Checks if a user is already logged in
+	session, err := requireSession(w, r)
+	if session == nil {
+		return err
+	}
+	err = purgeTrashedNote(session.UserID, routeID(r, "NoteID"))
+	if err != nil {
+		return err
+	}
+	http.Redirect(w, r, "/Notes/Trash/", http.StatusSeeOther)
+	return nil
+}
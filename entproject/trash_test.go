@@ -0,0 +1,160 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDescribeRetention(t *testing.T) {
+	assert.Equal(t, "30 days", describeRetention(720*time.Hour))
+	assert.Equal(t, "1 day", describeRetention(24*time.Hour))
+	assert.Equal(t, "36h0m0s", describeRetention(36*time.Hour))
+}
+
+func TestTrashPages(t *testing.T) {
+	owner, err := registerUser("Trash", "Owner", "password")
+	assert.NoError(t, err)
+	reader, err := registerUser("Trash", "Reader", "password")
+	assert.NoError(t, err)
+	note, err := saveNewNote(owner.UserID, "binned note", "contents", "")
+	assert.NoError(t, err)
+	_, err = store.AddAccess(NoteAccess{NoteID: note.NoteID, UserID: reader.UserID, Role: roleViewer})
+	assert.NoError(t, err)
+	id := strconv.Itoa(note.NoteID)
+
+	//Deleting asks first
+	rec := apiRequest("GET", "/Notes/Delete/"+id, owner.UserID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "binned note")
+	assert.Contains(t, rec.Body.String(), `method="POST"`)
+	_, err = store.GetNote(note.NoteID)
+	assert.NoError(t, err, "showing the delete page should not delete the note")
+
+	//A viewer can not delete
+	rec = formRequest("/Notes/Delete/"+id, reader.UserID, nil)
+	assert.Equal(t, http.StatusForbidden, rec.Code)
+	_, err = store.GetNote(note.NoteID)
+	assert.NoError(t, err)
+
+	rec = formRequest("/Notes/Delete/"+id, owner.UserID, nil)
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	rec = apiRequest("GET", "/Notes/View/"+id, reader.UserID, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code, "notes in the trash should not be shared")
+	rec = apiRequest("GET", "/Notes/View/"+id, owner.UserID, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = apiRequest("GET", "/Notes/Trash/", owner.UserID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.Contains(t, rec.Body.String(), "binned note")
+	assert.Contains(t, rec.Body.String(), "/Notes/Trash/Restore/"+id)
+	rec = apiRequest("GET", "/Notes/Trash/", reader.UserID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.NotContains(t, rec.Body.String(), "binned note")
+
+	//Restoring brings back the sharing
+	rec = formRequest("/Notes/Trash/Restore/"+id, reader.UserID, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = formRequest("/Notes/Trash/Restore/"+id, owner.UserID, nil)
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	assert.Equal(t, "/Notes/View/"+id, rec.Header().Get("Location"))
+	rec = apiRequest("GET", "/Notes/View/"+id, reader.UserID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+
+	//Deleting from the trash is for good, and takes the attachments with it
+	attachment, err := saveAttachment(note.NoteID, owner.UserID, "file.txt", strings.NewReader("file"))
+	assert.NoError(t, err)
+	rec = formRequest("/Notes/Trash/Delete/"+id, owner.UserID, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code, "only notes in the trash can be deleted for good")
+	assert.NoError(t, trashNote(owner.UserID, note.NoteID))
+	rec = formRequest("/Notes/Trash/Delete/"+id, reader.UserID, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = formRequest("/Notes/Trash/Delete/"+id, owner.UserID, nil)
+	assert.Equal(t, http.StatusSeeOther, rec.Code)
+	_, err = store.GetTrashedNote(note.NoteID)
+	assert.Equal(t, errNotFound, err)
+	_, err = blobs.Open(attachment.BlobKey)
+	assert.Equal(t, errNotFound, err)
+}
+
+func TestPurgeExpiredTrash(t *testing.T) {
+	owner, err := registerUser("Trash", "Purger", "password")
+	assert.NoError(t, err)
+	old, err := saveNewNote(owner.UserID, "old", "deleted long ago", "")
+	assert.NoError(t, err)
+	recent, err := saveNewNote(owner.UserID, "recent", "deleted just now", "")
+	assert.NoError(t, err)
+	kept, err := saveNewNote(owner.UserID, "kept", "never deleted", "")
+	assert.NoError(t, err)
+	attachment, err := saveAttachment(old.NoteID, owner.UserID, "old.txt", strings.NewReader("old"))
+	assert.NoError(t, err)
+
+	now := time.Now()
+	assert.NoError(t, store.TrashNote(old.NoteID, now.Add(-48*time.Hour)))
+	assert.NoError(t, store.TrashNote(recent.NoteID, now.Add(-time.Hour)))
+
+	purged, err := purgeExpiredTrash(now, 24*time.Hour)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, purged)
+	_, err = store.GetTrashedNote(old.NoteID)
+	assert.Equal(t, errNotFound, err)
+	_, err = blobs.Open(attachment.BlobKey)
+	assert.Equal(t, errNotFound, err, "purging a note should delete its files")
+	_, err = store.GetTrashedNote(recent.NoteID)
+	assert.NoError(t, err, "notes in the trash for less than the retention period should be kept")
+	_, err = store.GetNote(kept.NoteID)
+	assert.NoError(t, err)
+}
+
+func TestTrashAPI(t *testing.T) {
+	owner, err := registerUser("Trash", "APIOwner", "password")
+	assert.NoError(t, err)
+	other, err := registerUser("Trash", "APIOther", "password")
+	assert.NoError(t, err)
+	note, err := saveNewNote(owner.UserID, "api trash", "contents", "")
+	assert.NoError(t, err)
+	notePath := "/api/v1/notes/" + strconv.Itoa(note.NoteID)
+	trashPath := "/api/v1/trash/" + strconv.Itoa(note.NoteID)
+
+	rec := apiRequest("GET", "/api/v1/trash", owner.UserID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	assert.JSONEq(t, `[]`, rec.Body.String())
+
+	rec = apiRequest("DELETE", notePath, owner.UserID, nil)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	rec = apiRequest("GET", notePath, owner.UserID, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = apiRequest("GET", "/api/v1/trash", owner.UserID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var trash []TrashedNote
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &trash))
+	if assert.Len(t, trash, 1) {
+		assert.Equal(t, note.NoteID, trash[0].NoteID)
+		assert.False(t, trash[0].DateDeleted.IsZero())
+	}
+
+	rec = apiRequest("POST", trashPath+"/restore", other.UserID, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = apiRequest("POST", trashPath+"/restore", owner.UserID, nil)
+	assert.Equal(t, http.StatusOK, rec.Code)
+	var restored Note
+	assert.NoError(t, json.Unmarshal(rec.Body.Bytes(), &restored))
+	assert.Equal(t, "api trash", restored.Title)
+	rec = apiRequest("POST", trashPath+"/restore", owner.UserID, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = apiRequest("DELETE", trashPath, owner.UserID, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code, "notes have to be in the trash to be deleted for good")
+
+	rec = apiRequest("DELETE", notePath, owner.UserID, nil)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	rec = apiRequest("DELETE", trashPath, other.UserID, nil)
+	assert.Equal(t, http.StatusNotFound, rec.Code)
+	rec = apiRequest("DELETE", trashPath, owner.UserID, nil)
+	assert.Equal(t, http.StatusNoContent, rec.Code)
+	rec = apiRequest("GET", "/api/v1/trash", owner.UserID, nil)
+	assert.JSONEq(t, `[]`, rec.Body.String())
+}